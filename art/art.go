@@ -0,0 +1,297 @@
+package art
+
+import (
+	"github.com/tPhume/gokv/store"
+	"strings"
+)
+
+// Package contains an adaptive radix tree implementation of store.Store
+// the tree branches on one byte of the key at a time, and bytes shared by every key below a node are stored once
+// on that node (path compression), so a lookup compares each byte of the key once instead of whole keys at every level
+// which suits long keys sharing prefixes such as tenant/region/service/...
+// nodes adapt their layout to their number of children (see node.go), keys are visited in byte order
+
+var (
+	KeyDoesNotExist = store.KeyDoesNotExist
+)
+
+type RadixTree struct {
+	// nil when the tree is empty
+	root *node
+}
+
+func NewRadixTree() *RadixTree {
+	return &RadixTree{}
+}
+
+// inserting an existing key replaces its value
+func (t *RadixTree) Insert(key string, value store.Value) error {
+	t.root = t.insert(t.root, key, 0, store.CopyValue(value))
+	return nil
+}
+
+func (t *RadixTree) Update(key string, value store.Value) error {
+	l := t.find(key)
+	if l == nil {
+		return KeyDoesNotExist
+	}
+
+	l.value = store.CopyValue(value)
+
+	return nil
+}
+
+func (t *RadixTree) Search(key string) store.Value {
+	l := t.find(key)
+	if l == nil {
+		return nil
+	}
+
+	return store.CopyValue(l.value)
+}
+
+func (t *RadixTree) Remove(key string) error {
+	root, removed := t.remove(t.root, key, 0)
+	if !removed {
+		return KeyDoesNotExist
+	}
+
+	t.root = root
+
+	return nil
+}
+
+// Scan skips every subtree whose keys all fall outside of the range, without visiting them
+func (t *RadixTree) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	if t.root != nil {
+		t.walk(t.root, nil, opts, limit(opts, fn))
+	}
+
+	return nil
+}
+
+// ScanPrefix is Scan restricted to the keys starting with prefix, opts can narrow the range further
+// it goes straight down to the node below which every key starts with prefix
+func (t *RadixTree) ScanPrefix(prefix string, opts store.ScanOptions, fn store.ScanFunc) error {
+	n, depth := t.root, 0
+	for n != nil {
+		rest := prefix[depth:]
+		if len(rest) <= len(n.prefix) {
+			// every key below n starts with prefix, or none does
+			if strings.HasPrefix(n.prefix, rest) {
+				t.walk(n, []byte(prefix[:depth]), opts, limit(opts, fn))
+			}
+
+			return nil
+		}
+
+		if !strings.HasPrefix(rest, n.prefix) {
+			return nil
+		}
+
+		depth += len(n.prefix)
+		n = n.findChild(prefix[depth])
+		depth++
+	}
+
+	return nil
+}
+
+// returns the leaf of key, nil if it does not exist
+func (t *RadixTree) find(key string) *leaf {
+	n, depth := t.root, 0
+	for n != nil {
+		if !strings.HasPrefix(key[depth:], n.prefix) {
+			return nil
+		}
+
+		depth += len(n.prefix)
+		if depth == len(key) {
+			return n.leaf
+		}
+
+		n = n.findChild(key[depth])
+		depth++
+	}
+
+	return nil
+}
+
+// inserts key below n, where depth bytes of key led to n, and returns the node to use in place of n
+func (t *RadixTree) insert(n *node, key string, depth int, value store.Value) *node {
+	if n == nil {
+		return newLeaf(key, depth, value)
+	}
+
+	// key leaves the compressed path, which is split at the first differing byte
+	common := commonPrefix(n.prefix, key[depth:])
+	if common < len(n.prefix) {
+		parent := newNode(node4, n.prefix[:common], nil)
+		parent.addChild(n.prefix[common], n)
+		n.prefix = n.prefix[common+1:]
+
+		if depth+common == len(key) {
+			parent.leaf = &leaf{key: key, value: value}
+		} else {
+			parent.addChild(key[depth+common], newLeaf(key, depth+common+1, value))
+		}
+
+		return parent
+	}
+
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.leaf != nil {
+			n.leaf.value = value
+		} else {
+			n.leaf = &leaf{key: key, value: value}
+		}
+
+		return n
+	}
+
+	b := key[depth]
+	if child := n.findChild(b); child != nil {
+		if replaced := t.insert(child, key, depth+1, value); replaced != child {
+			n.setChild(b, replaced)
+		}
+
+		return n
+	}
+
+	return n.addChild(b, newLeaf(key, depth+1, value))
+}
+
+// removes key below n, where depth bytes of key led to n, and returns the node to use in place of n
+func (t *RadixTree) remove(n *node, key string, depth int) (*node, bool) {
+	if n == nil || !strings.HasPrefix(key[depth:], n.prefix) {
+		return n, false
+	}
+
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.leaf == nil {
+			return n, false
+		}
+
+		n.leaf = nil
+		return n.compact(), true
+	}
+
+	b := key[depth]
+	child := n.findChild(b)
+	if child == nil {
+		return n, false
+	}
+
+	replaced, removed := t.remove(child, key, depth+1)
+	if !removed {
+		return n, false
+	}
+
+	if replaced == nil {
+		n = n.removeChild(b)
+	} else if replaced != child {
+		n.setChild(b, replaced)
+	}
+
+	return n.compact(), true
+}
+
+// drops a node that holds nothing anymore, and merges a node with a single child and no key into the child
+func (n *node) compact() *node {
+	if n.leaf != nil || n.num > 1 {
+		return n
+	}
+
+	if n.num == 0 {
+		return nil
+	}
+
+	var b byte
+	var child *node
+	n.each(false, func(childByte byte, c *node) bool {
+		b, child = childByte, c
+		return false
+	})
+
+	// the byte itself, string(b) would encode a byte from 0x80 up as a two byte rune
+	child.prefix = n.prefix + string([]byte{b}) + child.prefix
+
+	return child
+}
+
+// visits the keys below n in the range of opts, path is the bytes of the keys above n
+// returns false once the scan is over
+func (t *RadixTree) walk(n *node, path []byte, opts store.ScanOptions, visit func(*leaf) bool) bool {
+	// every key below n starts with path
+	path = append(path, n.prefix...)
+
+	if string(path) < opts.Start && !hasPrefix(opts.Start, path) {
+		// every key below n is before the range
+		return !opts.Reverse
+	}
+
+	if opts.End != "" && string(path) >= opts.End {
+		// every key below n is after the range
+		return opts.Reverse
+	}
+
+	if !opts.Reverse && n.leaf != nil && !t.visitLeaf(n.leaf, opts, visit) {
+		return false
+	}
+
+	more := n.each(opts.Reverse, func(b byte, child *node) bool {
+		return t.walk(child, append(path, b), opts, visit)
+	})
+
+	if !more {
+		return false
+	}
+
+	if opts.Reverse && n.leaf != nil {
+		return t.visitLeaf(n.leaf, opts, visit)
+	}
+
+	return true
+}
+
+// visits l if it is in the range of opts, returns false once the scan is over
+func (t *RadixTree) visitLeaf(l *leaf, opts store.ScanOptions, visit func(*leaf) bool) bool {
+	if !opts.InRange(l.key) {
+		// the scan goes on if l is before the range in the order of the scan, it is over if l is past it
+		if opts.Reverse {
+			return l.key >= opts.Start
+		}
+
+		return l.key < opts.Start
+	}
+
+	return visit(l)
+}
+
+// utility function that wraps fn to stop after opts.Limit keys and copy every value
+func limit(opts store.ScanOptions, fn store.ScanFunc) func(*leaf) bool {
+	count := 0
+	return func(l *leaf) bool {
+		if opts.Limit > 0 && count >= opts.Limit {
+			return false
+		}
+
+		count++
+		return fn(l.key, store.CopyValue(l.value))
+	}
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
+
+func hasPrefix(s string, prefix []byte) bool {
+	return len(s) >= len(prefix) && s[:len(prefix)] == string(prefix)
+}
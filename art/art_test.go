@@ -0,0 +1,148 @@
+package art
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/store/storetest"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// smallest and biggest number of children of every layout, a node shrinks below the size it grew at
+var layoutSizes = map[uint8][2]int{
+	node4:   {0, 4},
+	node16:  {shrink16 + 1, 16},
+	node48:  {shrink48 + 1, 48},
+	node256: {shrink256 + 1, 256},
+}
+
+// checks the layout of every node, that leaves hold the key of their path
+// and that no node is left empty or with a single child and no key
+func checkTree(t *testing.T, tree *RadixTree) {
+	var walk func(n *node, path string)
+	walk = func(n *node, path string) {
+		path += n.prefix
+
+		sizes := layoutSizes[n.kind]
+		if n.num < sizes[0] || n.num > sizes[1] {
+			t.Fatalf("node of kind [%v] has [%v] children", n.kind, n.num)
+		}
+
+		if n.leaf == nil && n.num <= 1 {
+			t.Fatalf("node [%v] should have been compacted", path)
+		}
+
+		if n.leaf != nil && n.leaf.key != path {
+			t.Fatalf("leaf [%v] is at [%v]", n.leaf.key, path)
+		}
+
+		count, last := 0, -1
+		n.each(false, func(b byte, child *node) bool {
+			if int(b) <= last {
+				t.Fatalf("children of [%v] out of order", path)
+			}
+
+			count, last = count+1, int(b)
+			walk(child, path+string([]byte{b}))
+			return true
+		})
+
+		if count != n.num {
+			t.Fatalf("node [%v] has [%v] children, expected [%v]", path, count, n.num)
+		}
+	}
+
+	if tree.root != nil {
+		walk(tree.root, "")
+	}
+}
+
+// keys share long prefixes and some keys are prefixes of others, the last part may hold bytes that are not ASCII
+func randomKey(r *rand.Rand) string {
+	last := string([]byte{"a\x7f\x80\xd2\xff"[r.Intn(5)]})
+	parts := []string{"tenant" + fmt.Sprint(r.Intn(3)), "region" + fmt.Sprint(r.Intn(3)), fmt.Sprint(r.Intn(60)), last}
+	return strings.Join(parts[:1+r.Intn(len(parts))], "/")
+}
+
+func TestRadixTree_Random(t *testing.T) {
+	tree := NewRadixTree()
+	storetest.Random(t, tree, randomKey, func() { checkTree(t, tree) })
+
+	if tree.root != nil {
+		t.Fatalf("expected an empty tree")
+	}
+}
+
+func TestRadixTree_Scan(t *testing.T) {
+	storetest.Scan(t, NewRadixTree())
+}
+
+func TestRadixTree_CopiesValues(t *testing.T) {
+	storetest.CopiesValues(t, NewRadixTree())
+}
+
+func TestRadixTree_ApplyBatch(t *testing.T) {
+	storetest.ApplyBatch(t, NewRadixTree())
+}
+
+func TestRadixTree_ScanPrefix(t *testing.T) {
+	tree := NewRadixTree()
+	for _, key := range []string{"a", "ab", "abc", "abd", "abdx", "ac", "b", "ba"} {
+		tree.Insert(key, store.Value{"key": key})
+	}
+
+	tests := []struct {
+		prefix   string
+		opts     store.ScanOptions
+		expected []string
+	}{
+		{"", store.ScanOptions{}, []string{"a", "ab", "abc", "abd", "abdx", "ac", "b", "ba"}},
+		{"ab", store.ScanOptions{}, []string{"ab", "abc", "abd", "abdx"}},
+		{"abd", store.ScanOptions{}, []string{"abd", "abdx"}},
+		{"ab", store.ScanOptions{Reverse: true, Limit: 3}, []string{"abdx", "abd", "abc"}},
+		{"a", store.ScanOptions{Start: "abd", End: "ac"}, []string{"abd", "abdx"}},
+		{"abe", store.ScanOptions{}, nil},
+		{"c", store.ScanOptions{}, nil},
+		{"abdxy", store.ScanOptions{}, nil},
+	}
+
+	for _, test := range tests {
+		var keys []string
+		tree.ScanPrefix(test.prefix, test.opts, func(key string, value store.Value) bool {
+			keys = append(keys, key)
+			return true
+		})
+
+		if fmt.Sprint(keys) != fmt.Sprint(test.expected) {
+			t.Fatalf("prefix [%v]: expected %v, got = %v", test.prefix, test.expected, keys)
+		}
+	}
+}
+
+// every layout is reached while children are added, and left again while they are removed
+func TestRadixTree_Layouts(t *testing.T) {
+	tree := NewRadixTree()
+
+	kinds := make(map[uint8]bool)
+	for i := 0; i < 256; i++ {
+		tree.Insert("key"+string([]byte{byte(i)}), store.Value{})
+		kinds[tree.root.kind] = true
+		checkTree(t, tree)
+	}
+
+	if len(kinds) != 4 || tree.root.kind != node256 {
+		t.Fatalf("expected every layout, got = %v", kinds)
+	}
+
+	for i := 0; i < 254; i++ {
+		if err := tree.Remove("key" + string([]byte{byte(i)})); err != nil {
+			t.Fatal(err)
+		}
+		checkTree(t, tree)
+	}
+
+	if tree.root.kind != node4 || tree.root.prefix != "key" {
+		t.Fatalf("expected a node4 with prefix [key], got = kind [%v] prefix [%v]", tree.root.kind, tree.root.prefix)
+	}
+}
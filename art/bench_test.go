@@ -0,0 +1,121 @@
+package art
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"math/rand"
+	"testing"
+)
+
+// every workload runs against both engines on keys sharing long prefixes
+// the btree has the minimum degree the servers use by default
+// go test -bench . ./art
+
+const (
+	benchTenants   = 8
+	benchRegions   = 4
+	benchServices  = 32
+	benchInstances = 100
+)
+
+var engines = []struct {
+	name     string
+	newStore func() store.Store
+}{
+	{"btree", func() store.Store { return btree.NewBtree(3) }},
+	{"art", func() store.Store { return NewRadixTree() }},
+}
+
+// returns the prefix of the keys of one service, with the instance number left to append
+func benchPrefix(i int) string {
+	service := i / benchInstances
+	region := service / benchServices
+	tenant := region / benchRegions
+
+	return fmt.Sprintf("tenant-%03d/region-%02d/service-%03d/", tenant, region%benchRegions, service%benchServices)
+}
+
+func benchKey(i int) string {
+	return fmt.Sprintf("%vinstance-%06d", benchPrefix(i), i%benchInstances)
+}
+
+// returns every key of the benchmark, in random order
+func benchKeys() []string {
+	count := benchTenants * benchRegions * benchServices * benchInstances
+	keys := make([]string, count)
+	for i, n := range rand.New(rand.NewSource(1)).Perm(count) {
+		keys[i] = benchKey(n)
+	}
+
+	return keys
+}
+
+func filledStore(newStore func() store.Store, keys []string) store.Store {
+	s := newStore()
+	for _, key := range keys {
+		s.Insert(key, store.Value{"key": key})
+	}
+
+	return s
+}
+
+func BenchmarkInsert(b *testing.B) {
+	keys := benchKeys()
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			value := store.Value{"val": "value"}
+			s := engine.newStore()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if i%len(keys) == 0 && i > 0 {
+					b.StopTimer()
+					s = engine.newStore()
+					b.StartTimer()
+				}
+
+				s.Insert(keys[i%len(keys)], value)
+			}
+		})
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	keys := benchKeys()
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			s := filledStore(engine.newStore, keys)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Search(keys[i%len(keys)])
+			}
+		})
+	}
+}
+
+// lists every instance of a random service
+func BenchmarkScanPrefix(b *testing.B) {
+	keys := benchKeys()
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			s := filledStore(engine.newStore, keys)
+			r := rand.New(rand.NewSource(1))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				prefix := benchPrefix(r.Intn(len(keys)))
+				count := 0
+				s.Scan(store.ScanOptions{Start: prefix, End: store.PrefixEnd(prefix)}, func(string, store.Value) bool {
+					count++
+					return true
+				})
+
+				if count != benchInstances {
+					b.Fatalf("expected [%v] keys, got = [%v]", benchInstances, count)
+				}
+			}
+		})
+	}
+}
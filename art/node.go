@@ -0,0 +1,235 @@
+package art
+
+import "github.com/tPhume/gokv/store"
+
+// Inner nodes of the adaptive radix tree
+// a node branches on one byte of the key, and grows or shrinks between four layouts as children are added and removed
+// node4 and node16 keep sorted parallel arrays of bytes and children
+// node48 maps every byte to one of 48 child slots, node256 holds a child for every byte
+
+const (
+	node4 uint8 = iota
+	node16
+	node48
+	node256
+)
+
+// number of children at which a node16, node48 or node256 shrinks, below the size it grew at so nodes do not flip back and forth
+const (
+	shrink16  = 3
+	shrink48  = 12
+	shrink256 = 37
+)
+
+type leaf struct {
+	key   string
+	value store.Value
+}
+
+type node struct {
+	kind uint8
+	// compressed path, bytes every key below the node shares after the byte that led to it
+	prefix string
+	// the key that ends at this node, if any
+	leaf *leaf
+	num  int
+	// node4 and node16, sorted
+	keys []byte
+	// node4 and node16: parallel to keys, node48: 48 slots, node256: one per byte
+	children []*node
+	// node48 only, 1 + slot of the child of every byte, 0 if there is none
+	index *[256]uint8
+}
+
+// returns a node holding key without children, depth is the number of bytes of key above it
+func newLeaf(key string, depth int, value store.Value) *node {
+	return &node{prefix: key[depth:], leaf: &leaf{key: key, value: value}}
+}
+
+// returns an empty node of the layout, node48 and node256 have their slots allocated
+func newNode(kind uint8, prefix string, l *leaf) *node {
+	n := &node{kind: kind, prefix: prefix, leaf: l}
+
+	switch kind {
+	case node48:
+		n.children = make([]*node, 48)
+		n.index = new([256]uint8)
+	case node256:
+		n.children = make([]*node, 256)
+	}
+
+	return n
+}
+
+func (n *node) findChild(b byte) *node {
+	switch n.kind {
+	case node4, node16:
+		for i := 0; i < n.num; i++ {
+			if n.keys[i] == b {
+				return n.children[i]
+			}
+		}
+	case node48:
+		if slot := n.index[b]; slot != 0 {
+			return n.children[slot-1]
+		}
+	case node256:
+		return n.children[b]
+	}
+
+	return nil
+}
+
+// replaces the existing child of b
+func (n *node) setChild(b byte, child *node) {
+	switch n.kind {
+	case node4, node16:
+		for i := 0; i < n.num; i++ {
+			if n.keys[i] == b {
+				n.children[i] = child
+				return
+			}
+		}
+	case node48:
+		n.children[n.index[b]-1] = child
+	case node256:
+		n.children[b] = child
+	}
+}
+
+// adds a child for b, which must not have one yet, and returns the node to use from now on
+// which is a bigger copy of n if n was full
+func (n *node) addChild(b byte, child *node) *node {
+	switch n.kind {
+	case node4, node16:
+		if (n.kind == node4 && n.num == 4) || n.num == 16 {
+			return n.grow().addChild(b, child)
+		}
+
+		i := 0
+		for i < n.num && n.keys[i] < b {
+			i++
+		}
+
+		n.keys = append(n.keys, 0)
+		copy(n.keys[i+1:], n.keys[i:])
+		n.keys[i] = b
+
+		n.children = append(n.children, nil)
+		copy(n.children[i+1:], n.children[i:])
+		n.children[i] = child
+	case node48:
+		if n.num == 48 {
+			return n.grow().addChild(b, child)
+		}
+
+		slot := 0
+		for n.children[slot] != nil {
+			slot++
+		}
+
+		n.children[slot] = child
+		n.index[b] = uint8(slot + 1)
+	case node256:
+		n.children[b] = child
+	}
+
+	n.num++
+
+	return n
+}
+
+// removes the child of b and returns the node to use from now on, which is a smaller copy of n if it got sparse
+func (n *node) removeChild(b byte) *node {
+	switch n.kind {
+	case node4, node16:
+		for i := 0; i < n.num; i++ {
+			if n.keys[i] == b {
+				n.keys = append(n.keys[:i], n.keys[i+1:]...)
+				n.children = append(n.children[:i], n.children[i+1:]...)
+				break
+			}
+		}
+	case node48:
+		n.children[n.index[b]-1] = nil
+		n.index[b] = 0
+	case node256:
+		n.children[b] = nil
+	}
+
+	n.num--
+
+	if (n.kind == node16 && n.num <= shrink16) || (n.kind == node48 && n.num <= shrink48) || (n.kind == node256 && n.num <= shrink256) {
+		return n.shrink()
+	}
+
+	return n
+}
+
+// returns a copy of n of the next bigger layout
+func (n *node) grow() *node {
+	bigger := newNode(n.kind+1, n.prefix, n.leaf)
+	bigger.num = n.num
+
+	switch n.kind {
+	case node4:
+		bigger.keys = append(make([]byte, 0, 16), n.keys...)
+		bigger.children = append(make([]*node, 0, 16), n.children...)
+	case node16:
+		for i := 0; i < n.num; i++ {
+			bigger.children[i] = n.children[i]
+			bigger.index[n.keys[i]] = uint8(i + 1)
+		}
+	case node48:
+		for b, slot := range n.index {
+			if slot != 0 {
+				bigger.children[b] = n.children[slot-1]
+			}
+		}
+	}
+
+	return bigger
+}
+
+// returns a copy of n of the next smaller layout
+func (n *node) shrink() *node {
+	smaller := newNode(n.kind-1, n.prefix, n.leaf)
+
+	n.each(false, func(b byte, child *node) bool {
+		smaller.addChild(b, child)
+		return true
+	})
+
+	return smaller
+}
+
+// calls fn for every child in the order of their byte, descending if reverse, until fn returns false
+func (n *node) each(reverse bool, fn func(b byte, child *node) bool) bool {
+	switch n.kind {
+	case node4, node16:
+		for i := 0; i < n.num; i++ {
+			j := i
+			if reverse {
+				j = n.num - 1 - i
+			}
+
+			if !fn(n.keys[j], n.children[j]) {
+				return false
+			}
+		}
+	case node48, node256:
+		for i := 0; i < 256; i++ {
+			b := byte(i)
+			if reverse {
+				b = byte(255 - i)
+			}
+
+			child := n.findChild(b)
+			if child != nil && !fn(b, child) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,377 @@
+package bplustree
+
+import (
+	"github.com/tPhume/gokv/store"
+	"sort"
+)
+
+// Package contains an in memory B+ tree implementation of store.Store
+// every key-value pair lives in a leaf, internal nodes only hold separator keys, so they fan out wider
+// leaves are linked in key order both ways, so a scan finds its first leaf once and then walks the list
+
+var (
+	KeyDoesNotExist = store.KeyDoesNotExist
+)
+
+// a leaf holds keys and their values, an internal node holds len(keys)+1 children
+// where keys[i] is the smallest key of children[i+1]
+type node struct {
+	keys     []string
+	values   []store.Value
+	children []*node
+	// neighbour leaves in key order, nil for internal nodes
+	prev, next *node
+}
+
+func (n *node) leaf() bool {
+	return n.children == nil
+}
+
+// utility function that finds the child of an internal node that may hold key
+func (n *node) childIndex(key string) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return n.keys[i] > key
+	})
+}
+
+// utility function that finds index of key greater than or equal to key in a leaf
+func (n *node) findKey(key string) int {
+	return sort.SearchStrings(n.keys, key)
+}
+
+type BPlusTree struct {
+	root *node
+	// maximum number of children of an internal node, and of keys in a leaf
+	order int
+}
+
+// NewBPlusTree returns an empty tree whose nodes hold up to order children, an order below 3 is raised to 3
+func NewBPlusTree(order int) *BPlusTree {
+	if order < 3 {
+		order = 3
+	}
+
+	return &BPlusTree{root: &node{}, order: order}
+}
+
+func (t *BPlusTree) maxKeys(n *node) int {
+	if n.leaf() {
+		return t.order
+	}
+
+	return t.order - 1
+}
+
+func (t *BPlusTree) minKeys(n *node) int {
+	return t.maxKeys(n) / 2
+}
+
+// Insert replaces the value if the key exists
+func (t *BPlusTree) Insert(key string, value store.Value) error {
+	separator, right := t.insert(t.root, key, store.CopyValue(value))
+	if right != nil {
+		t.root = &node{keys: []string{separator}, children: []*node{t.root, right}}
+	}
+
+	return nil
+}
+
+func (t *BPlusTree) Update(key string, value store.Value) error {
+	leaf := t.findLeaf(key)
+	pos := leaf.findKey(key)
+	if pos == len(leaf.keys) || leaf.keys[pos] != key {
+		return KeyDoesNotExist
+	}
+
+	leaf.values[pos] = store.CopyValue(value)
+
+	return nil
+}
+
+func (t *BPlusTree) Search(key string) store.Value {
+	leaf := t.findLeaf(key)
+	pos := leaf.findKey(key)
+	if pos == len(leaf.keys) || leaf.keys[pos] != key {
+		return nil
+	}
+
+	return store.CopyValue(leaf.values[pos])
+}
+
+func (t *BPlusTree) Remove(key string) error {
+	if !t.remove(t.root, key) {
+		return KeyDoesNotExist
+	}
+
+	if !t.root.leaf() && len(t.root.keys) == 0 {
+		t.root = t.root.children[0]
+	}
+
+	return nil
+}
+
+// Scan finds the first leaf of the range once, then follows the links between leaves
+func (t *BPlusTree) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	count := 0
+	visit := func(key string, value store.Value) bool {
+		if opts.Limit > 0 && count >= opts.Limit {
+			return false
+		}
+
+		count++
+		return fn(key, store.CopyValue(value))
+	}
+
+	if opts.Reverse {
+		t.reverseScan(opts, visit)
+	} else {
+		t.scan(opts, visit)
+	}
+
+	return nil
+}
+
+func (t *BPlusTree) scan(opts store.ScanOptions, fn store.ScanFunc) {
+	leaf := t.findLeaf(opts.Start)
+	pos := leaf.findKey(opts.Start)
+
+	for ; leaf != nil; leaf, pos = leaf.next, 0 {
+		for ; pos < len(leaf.keys); pos++ {
+			if opts.End != "" && leaf.keys[pos] >= opts.End {
+				return
+			}
+
+			if !fn(leaf.keys[pos], leaf.values[pos]) {
+				return
+			}
+		}
+	}
+}
+
+func (t *BPlusTree) reverseScan(opts store.ScanOptions, fn store.ScanFunc) {
+	var leaf *node
+	var pos int
+
+	if opts.End == "" {
+		leaf = t.root
+		for !leaf.leaf() {
+			leaf = leaf.children[len(leaf.children)-1]
+		}
+		pos = len(leaf.keys) - 1
+	} else {
+		// the last key before End is in the leaf of End or at the end of the leaf before it
+		leaf = t.findLeaf(opts.End)
+		pos = leaf.findKey(opts.End) - 1
+	}
+
+	for leaf != nil {
+		for ; pos >= 0; pos-- {
+			if leaf.keys[pos] < opts.Start {
+				return
+			}
+
+			if !fn(leaf.keys[pos], leaf.values[pos]) {
+				return
+			}
+		}
+
+		if leaf = leaf.prev; leaf != nil {
+			pos = len(leaf.keys) - 1
+		}
+	}
+}
+
+// returns the leaf that holds key if it exists
+func (t *BPlusTree) findLeaf(key string) *node {
+	n := t.root
+	for !n.leaf() {
+		n = n.children[n.childIndex(key)]
+	}
+
+	return n
+}
+
+// inserts into the subtree of n, and returns the separator and the new right node if n was split
+func (t *BPlusTree) insert(n *node, key string, value store.Value) (string, *node) {
+	if n.leaf() {
+		pos := n.findKey(key)
+		if pos < len(n.keys) && n.keys[pos] == key {
+			n.values[pos] = value
+			return "", nil
+		}
+
+		n.keys = append(n.keys, "")
+		copy(n.keys[pos+1:], n.keys[pos:])
+		n.keys[pos] = key
+
+		n.values = append(n.values, nil)
+		copy(n.values[pos+1:], n.values[pos:])
+		n.values[pos] = value
+	} else {
+		i := n.childIndex(key)
+		separator, right := t.insert(n.children[i], key, value)
+		if right == nil {
+			return "", nil
+		}
+
+		n.keys = append(n.keys, "")
+		copy(n.keys[i+1:], n.keys[i:])
+		n.keys[i] = separator
+
+		n.children = append(n.children, nil)
+		copy(n.children[i+2:], n.children[i+1:])
+		n.children[i+1] = right
+	}
+
+	if len(n.keys) <= t.maxKeys(n) {
+		return "", nil
+	}
+
+	return t.split(n)
+}
+
+// splits n in two halves, and returns the separator and the right half
+func (t *BPlusTree) split(n *node) (string, *node) {
+	mid := len(n.keys) / 2
+
+	if n.leaf() {
+		right := &node{
+			keys:   append([]string(nil), n.keys[mid:]...),
+			values: append([]store.Value(nil), n.values[mid:]...),
+			prev:   n,
+			next:   n.next,
+		}
+
+		if n.next != nil {
+			n.next.prev = right
+		}
+		n.next = right
+
+		n.keys = n.keys[:mid:mid]
+		n.values = n.values[:mid:mid]
+
+		return right.keys[0], right
+	}
+
+	// the middle key moves up, it is not kept in either half
+	separator := n.keys[mid]
+	right := &node{
+		keys:     append([]string(nil), n.keys[mid+1:]...),
+		children: append([]*node(nil), n.children[mid+1:]...),
+	}
+
+	n.keys = n.keys[:mid:mid]
+	n.children = n.children[: mid+1 : mid+1]
+
+	return separator, right
+}
+
+// removes key from the subtree of n, rebalancing the child it was removed from, false if it was missing
+func (t *BPlusTree) remove(n *node, key string) bool {
+	if n.leaf() {
+		pos := n.findKey(key)
+		if pos == len(n.keys) || n.keys[pos] != key {
+			return false
+		}
+
+		n.keys = append(n.keys[:pos], n.keys[pos+1:]...)
+		n.values = append(n.values[:pos], n.values[pos+1:]...)
+
+		return true
+	}
+
+	i := n.childIndex(key)
+	child := n.children[i]
+	if !t.remove(child, key) {
+		return false
+	}
+
+	if len(child.keys) < t.minKeys(child) {
+		t.rebalance(n, i)
+	}
+
+	return true
+}
+
+// refills the child at index i of n by borrowing from a sibling, or merges it with one
+func (t *BPlusTree) rebalance(n *node, i int) {
+	child := n.children[i]
+
+	if i > 0 && len(n.children[i-1].keys) > t.minKeys(child) {
+		t.borrowLeft(n, i)
+		return
+	}
+
+	if i < len(n.children)-1 && len(n.children[i+1].keys) > t.minKeys(child) {
+		t.borrowRight(n, i)
+		return
+	}
+
+	if i > 0 {
+		t.merge(n, i-1)
+	} else {
+		t.merge(n, i)
+	}
+}
+
+// moves the last key of the left sibling of the child at index i into it
+func (t *BPlusTree) borrowLeft(n *node, i int) {
+	child, left := n.children[i], n.children[i-1]
+	last := len(left.keys) - 1
+
+	if child.leaf() {
+		child.keys = append([]string{left.keys[last]}, child.keys...)
+		child.values = append([]store.Value{left.values[last]}, child.values...)
+		left.keys, left.values = left.keys[:last], left.values[:last]
+		n.keys[i-1] = child.keys[0]
+
+		return
+	}
+
+	// the separator comes down and the last key of left goes up
+	child.keys = append([]string{n.keys[i-1]}, child.keys...)
+	child.children = append([]*node{left.children[last+1]}, child.children...)
+	n.keys[i-1] = left.keys[last]
+	left.keys, left.children = left.keys[:last], left.children[:last+1]
+}
+
+// moves the first key of the right sibling of the child at index i into it
+func (t *BPlusTree) borrowRight(n *node, i int) {
+	child, right := n.children[i], n.children[i+1]
+
+	if child.leaf() {
+		child.keys = append(child.keys, right.keys[0])
+		child.values = append(child.values, right.values[0])
+		right.keys, right.values = right.keys[1:], right.values[1:]
+		n.keys[i] = right.keys[0]
+
+		return
+	}
+
+	// the separator comes down and the first key of right goes up
+	child.keys = append(child.keys, n.keys[i])
+	child.children = append(child.children, right.children[0])
+	n.keys[i] = right.keys[0]
+	right.keys, right.children = right.keys[1:], right.children[1:]
+}
+
+// merges the child at index i+1 of n into the child at index i
+func (t *BPlusTree) merge(n *node, i int) {
+	left, right := n.children[i], n.children[i+1]
+
+	if left.leaf() {
+		left.keys = append(left.keys, right.keys...)
+		left.values = append(left.values, right.values...)
+
+		left.next = right.next
+		if right.next != nil {
+			right.next.prev = left
+		}
+	} else {
+		left.keys = append(append(left.keys, n.keys[i]), right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+
+	n.keys = append(n.keys[:i], n.keys[i+1:]...)
+	n.children = append(n.children[:i+1], n.children[i+2:]...)
+}
@@ -0,0 +1,98 @@
+package bplustree
+
+import (
+	"github.com/tPhume/gokv/store/storetest"
+	"testing"
+)
+
+// checks key counts and ordering of every node, that every leaf is at the same depth
+// and that the leaf list holds every key in order in both directions
+func checkTree(t *testing.T, tree *BPlusTree) {
+	var leaves []*node
+	var walk func(n *node, low, high string, root bool) int
+	walk = func(n *node, low, high string, root bool) int {
+		if len(n.keys) > tree.maxKeys(n) || (!root && len(n.keys) < tree.minKeys(n)) {
+			t.Fatalf("node has [%v] keys", len(n.keys))
+		}
+
+		for i, key := range n.keys {
+			if (i > 0 && n.keys[i-1] >= key) || (low != "" && key < low) || (high != "" && key >= high) {
+				t.Fatalf("keys out of order = [%v]", key)
+			}
+		}
+
+		if n.leaf() {
+			if len(n.values) != len(n.keys) {
+				t.Fatalf("leaf has [%v] keys and [%v] values", len(n.keys), len(n.values))
+			}
+
+			leaves = append(leaves, n)
+			return 0
+		}
+
+		if len(n.children) != len(n.keys)+1 {
+			t.Fatalf("node has [%v] keys and [%v] children", len(n.keys), len(n.children))
+		}
+
+		depth := -1
+		for i, child := range n.children {
+			childLow, childHigh := low, high
+			if i > 0 {
+				childLow = n.keys[i-1]
+			}
+
+			if i < len(n.keys) {
+				childHigh = n.keys[i]
+			}
+
+			d := walk(child, childLow, childHigh, false)
+			if depth != -1 && d != depth {
+				t.Fatalf("leaves at different depths")
+			}
+			depth = d
+		}
+
+		return depth + 1
+	}
+
+	walk(tree.root, "", "", true)
+
+	for i, leaf := range leaves {
+		var prev, next *node
+		if i > 0 {
+			prev = leaves[i-1]
+		}
+
+		if i < len(leaves)-1 {
+			next = leaves[i+1]
+		}
+
+		if leaf.prev != prev || leaf.next != next {
+			t.Fatalf("leaf [%v] is not linked to its neighbours", i)
+		}
+	}
+}
+
+func TestBPlusTree_Random(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 32} {
+		tree := NewBPlusTree(order)
+		storetest.Random(t, tree, nil, func() { checkTree(t, tree) })
+
+		// removing everything collapsed the tree back to an empty leaf
+		if !tree.root.leaf() || len(tree.root.keys) != 0 {
+			t.Fatalf("order %v: expected an empty root leaf, got = %v", order, tree.root.keys)
+		}
+	}
+}
+
+func TestBPlusTree_Scan(t *testing.T) {
+	storetest.Scan(t, NewBPlusTree(4))
+}
+
+func TestBPlusTree_CopiesValues(t *testing.T) {
+	storetest.CopiesValues(t, NewBPlusTree(3))
+}
+
+func TestBPlusTree_ApplyBatch(t *testing.T) {
+	storetest.ApplyBatch(t, NewBPlusTree(3))
+}
@@ -1,20 +1,24 @@
 package btree
 
 import (
-	"errors"
 	"github.com/tPhume/gokv/store"
+	"time"
 )
 
 // Package contains in memory implementation of btree
 
 var (
-	KeyDoesNotExist = errors.New("key does not exist")
+	KeyDoesNotExist = store.KeyDoesNotExist
 )
 
 // holds the key and value pair
 type item struct {
 	key   string
 	value store.Value
+	// unix nano time the item expires at, 0 never expires
+	expires int64
+	// value of Btree.version when the item was written
+	version uint64
 }
 
 func (i *item) getKey() string {
@@ -25,6 +29,20 @@ func (i *item) getValue() store.Value {
 	return i.value
 }
 
+func (i *item) expired(now int64) bool {
+	return i.expires != 0 && i.expires <= now
+}
+
+// utility function that returns a copy of the item as a store.Entry
+func (i *item) entry() store.Entry {
+	e := store.Entry{Key: i.key, Value: store.CopyValue(i.value), Version: i.version}
+	if i.expires != 0 {
+		e.Expires = time.Unix(0, i.expires)
+	}
+
+	return e
+}
+
 // node holds an slice of items and slice of children nodes
 type node struct {
 	items     []*item
@@ -50,24 +68,18 @@ func (n *node) insert(it *item) error {
 	key := it.getKey()
 
 	if n.leaf {
-		// if node is leaf, just insert
-		for i := index; i >= 0; i-- {
-			index = i
-			if n.items[i].getKey() > key {
-				n.items[i+1] = n.items[i]
-			} else {
-				break
-			}
+		// if node is leaf, shift bigger items and insert
+		for index >= 0 && n.items[index].getKey() > key {
+			n.items[index+1] = n.items[index]
+			index--
 		}
 
 		n.items[index+1] = copyItem(it)
 		n.currKey = n.currKey + 1
 	} else {
-		for i := index; i >= 0; i-- {
-			index = i
-			if n.items[i].getKey() < key {
-				break
-			}
+		// find child which is going to have the new item
+		for index >= 0 && n.items[index].getKey() > key {
+			index--
 		}
 
 		if n.node[index+1].currKey == 2*n.minDegree-1 {
@@ -79,11 +91,11 @@ func (n *node) insert(it *item) error {
 			if key > n.items[index+1].getKey() {
 				index++
 			}
+		}
 
-			err = n.node[index+1].insert(it)
-			if err != nil {
-				return err
-			}
+		err := n.node[index+1].insert(it)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -104,8 +116,8 @@ func (n *node) splitChild(index int, child *node) error {
 		child.items[i+minDegree] = nil
 	}
 
-	// copy children as well, if this node is root
-	if child.leaf {
+	// copy children as well, if child is not a leaf
+	if !child.leaf {
 		for i := 0; i < minDegree; i++ {
 			biggerNode.node[i] = child.node[i+minDegree]
 			child.node[i+minDegree] = nil
@@ -134,7 +146,8 @@ func (n *node) splitChild(index int, child *node) error {
 	return nil
 }
 
-func (n *node) update(key string, value store.Value) error {
+func (n *node) update(it *item) error {
+	key := it.getKey()
 	pos := n.findKey(key)
 	if pos == -1 {
 		return KeyDoesNotExist
@@ -145,14 +158,11 @@ func (n *node) update(key string, value store.Value) error {
 			return KeyDoesNotExist
 		}
 
-		return n.node[pos].update(key, value)
+		return n.node[pos].update(it)
 	}
 
 	if n.items[pos].getKey() == key {
-		n.items[pos] = &item{
-			key:   key,
-			value: copyValue(value),
-		}
+		n.items[pos] = copyItem(it)
 
 		return nil
 	}
@@ -161,10 +171,10 @@ func (n *node) update(key string, value store.Value) error {
 		return KeyDoesNotExist
 	}
 
-	return n.node[pos].update(key, value)
+	return n.node[pos].update(it)
 }
 
-func (n *node) search(key string) store.Value {
+func (n *node) search(key string) *item {
 	pos := n.findKey(key)
 	if pos == -1 {
 		return nil
@@ -179,7 +189,7 @@ func (n *node) search(key string) store.Value {
 	}
 
 	if n.items[pos].getKey() == key {
-		return copyValue(n.items[pos].getValue())
+		return n.items[pos]
 	}
 
 	if n.leaf {
@@ -189,6 +199,73 @@ func (n *node) search(key string) store.Value {
 	return n.node[pos].search(key)
 }
 
+// in-order traversal of the items between opts.Start and opts.End
+// returns false once fn asked to stop or the end of the range was reached
+func (n *node) scan(opts store.ScanOptions, fn func(*item) bool) bool {
+	if n.isEmpty() {
+		return true
+	}
+
+	// children before the first item bigger or equal to Start only hold smaller keys
+	start := 0
+	if opts.Start != "" {
+		start = n.findKey(opts.Start)
+	}
+
+	for i := start; i <= n.currKey; i++ {
+		if !n.leaf && !n.node[i].scan(opts, fn) {
+			return false
+		}
+
+		if i == n.currKey {
+			break
+		}
+
+		if opts.End != "" && n.items[i].getKey() >= opts.End {
+			return false
+		}
+
+		if !fn(n.items[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// same as scan but visits items in descending order
+func (n *node) reverseScan(opts store.ScanOptions, fn func(*item) bool) bool {
+	if n.isEmpty() {
+		return true
+	}
+
+	// children after the first item bigger or equal to End only hold bigger keys
+	end := n.currKey
+	if opts.End != "" {
+		end = n.findKey(opts.End)
+	}
+
+	for i := end; i >= 0; i-- {
+		if !n.leaf && !n.node[i].reverseScan(opts, fn) {
+			return false
+		}
+
+		if i == 0 {
+			break
+		}
+
+		if n.items[i-1].getKey() < opts.Start {
+			return false
+		}
+
+		if !fn(n.items[i-1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (n *node) remove(key string) error {
 	index := n.findKey(key)
 	if index == -1 {
@@ -331,7 +408,7 @@ func (n *node) getSucc(index int) *item {
 
 // utility function to fill up child node if child has less than minDegree - 1 keys
 func (n *node) fill(index int) {
-	if index != 0 && n.node[index-1].currKey > n.minDegree {
+	if index != 0 && n.node[index-1].currKey >= n.minDegree {
 		n.borrowFromPrev(index)
 	} else if index != n.currKey && n.node[index+1].currKey >= n.minDegree {
 		n.borrowFromNext(index)
@@ -403,8 +480,12 @@ func (n *node) borrowFromNext(index int) {
 		for i := 1; i < sibling.currKey+1; i++ {
 			sibling.node[i-1] = sibling.node[i]
 		}
+
+		sibling.node[sibling.currKey] = nil
 	}
 
+	sibling.items[sibling.currKey-1] = nil
+
 	// updating count of the node
 	child.currKey++
 	sibling.currKey--
@@ -421,14 +502,14 @@ func (n *node) merge(index int) {
 	child.items[minDegree-1] = n.items[index]
 
 	// copy items from sibling to child
-	for i := 0; i < n.currKey; i++ {
-		child.items[child.currKey+i] = sibling.items[i]
+	for i := 0; i < sibling.currKey; i++ {
+		child.items[i+minDegree] = sibling.items[i]
 	}
 
 	// copy child nodes from sibling to child
 	if !child.leaf {
-		for i := 0; i <= n.currKey; i++ {
-			child.node[child.currKey+i] = sibling.node[i]
+		for i := 0; i <= sibling.currKey; i++ {
+			child.node[i+minDegree] = sibling.node[i]
 		}
 	}
 
@@ -444,6 +525,8 @@ func (n *node) merge(index int) {
 		n.node[i-1] = n.node[i]
 	}
 
+	n.node[n.currKey] = nil
+
 	child.currKey = child.currKey + sibling.currKey + 1
 	n.currKey--
 }
@@ -464,16 +547,45 @@ func (n *node) isFull() bool {
 type Btree struct {
 	root      *node
 	minDegree int
+	// last version given to an item, every write takes the next one
+	version uint64
+	// keys that expire, by the time they expire at
+	expiries *expiries
 }
 
 func NewBtree(minDegree int) *Btree {
 	return &Btree{
 		root:      newNode(minDegree, true),
 		minDegree: minDegree,
+		expiries:  newExpiries(),
 	}
 }
 
+// inserting an existing key replaces its value
 func (b *Btree) Insert(key string, value store.Value) error {
+	return b.insert(&item{key: key, value: value})
+}
+
+// InsertExpire inserts key so it is treated as missing from at onwards
+func (b *Btree) InsertExpire(key string, value store.Value, at time.Time) error {
+	return b.insert(&item{key: key, value: value, expires: at.UnixNano()})
+}
+
+func (b *Btree) insert(it *item) error {
+	b.version++
+	it.version = b.version
+
+	return b.put(it)
+}
+
+// inserts or replaces it without giving it a version
+func (b *Btree) put(it *item) error {
+	b.expiries.set(it.getKey(), it.expires)
+
+	if b.root.update(it) == nil {
+		return nil
+	}
+
 	if b.root.isFull() {
 		newRoot := newNode(b.minDegree, false)
 		newRoot.node[0] = b.root
@@ -483,21 +595,13 @@ func (b *Btree) Insert(key string, value store.Value) error {
 			return err
 		}
 
-		if key < newRoot.items[0].getKey() {
-			err := newRoot.node[0].insert(&item{
-				key:   key,
-				value: value,
-			})
-
+		if it.getKey() < newRoot.items[0].getKey() {
+			err := newRoot.node[0].insert(it)
 			if err != nil {
 				return err
 			}
 		} else {
-			err := newRoot.node[1].insert(&item{
-				key:   key,
-				value: value,
-			})
-
+			err := newRoot.node[1].insert(it)
 			if err != nil {
 				return err
 			}
@@ -505,11 +609,7 @@ func (b *Btree) Insert(key string, value store.Value) error {
 
 		b.root = newRoot
 	} else {
-		err := b.root.insert(&item{
-			key:   key,
-			value: value,
-		})
-
+		err := b.root.insert(it)
 		if err != nil {
 			return err
 		}
@@ -519,41 +619,198 @@ func (b *Btree) Insert(key string, value store.Value) error {
 }
 
 func (b *Btree) Update(key string, value store.Value) error {
-	return b.root.update(key, value)
+	return b.update(&item{key: key, value: value})
+}
+
+// UpdateExpire updates key so it is treated as missing from at onwards
+func (b *Btree) UpdateExpire(key string, value store.Value, at time.Time) error {
+	return b.update(&item{key: key, value: value, expires: at.UnixNano()})
+}
+
+func (b *Btree) update(it *item) error {
+	if b.get(it.getKey()) == nil {
+		return KeyDoesNotExist
+	}
+
+	b.version++
+	it.version = b.version
+	b.expiries.set(it.getKey(), it.expires)
+
+	return b.root.update(it)
 }
 
 func (b *Btree) Search(key string) store.Value {
-	return b.root.search(key)
+	it := b.get(key)
+	if it == nil {
+		return nil
+	}
+
+	return store.CopyValue(it.getValue())
+}
+
+// SearchVersion returns the value of key with the version it was written at
+func (b *Btree) SearchVersion(key string) (store.Value, uint64) {
+	it := b.get(key)
+	if it == nil {
+		return nil, 0
+	}
+
+	return store.CopyValue(it.getValue()), it.version
+}
+
+// UpdateIf updates key only if it was last written at version, the key keeps its expiry
+func (b *Btree) UpdateIf(key string, value store.Value, version uint64) error {
+	it := b.get(key)
+	if it == nil {
+		return KeyDoesNotExist
+	}
+
+	if it.version != version {
+		return store.ErrVersionMismatch
+	}
+
+	return b.update(&item{key: key, value: value, expires: it.expires})
+}
+
+// RemoveIf removes key only if it was last written at version
+func (b *Btree) RemoveIf(key string, version uint64) error {
+	it := b.get(key)
+	if it == nil {
+		return KeyDoesNotExist
+	}
+
+	if it.version != version {
+		return store.ErrVersionMismatch
+	}
+
+	return b.Remove(key)
+}
+
+// SearchEntry returns key with the time it expires at and the version it was written at
+func (b *Btree) SearchEntry(key string) (store.Entry, bool) {
+	it := b.get(key)
+	if it == nil {
+		return store.Entry{}, false
+	}
+
+	return it.entry(), true
 }
 
+// ScanEntries is Scan with the expiry and version of every key
+func (b *Btree) ScanEntries(opts store.ScanOptions, fn func(store.Entry) bool) error {
+	return b.scan(opts, func(it *item) bool {
+		return fn(it.entry())
+	})
+}
+
+// Restore writes the entry back with its expiry and version, an entry that expired since is written but stays missing
+func (b *Btree) Restore(e store.Entry) error {
+	it := &item{key: e.Key, value: store.CopyValue(e.Value), version: e.Version}
+	if !e.Expires.IsZero() {
+		it.expires = e.Expires.UnixNano()
+	}
+
+	if b.version < e.Version {
+		b.version = e.Version
+	}
+
+	return b.put(it)
+}
+
+// expired items are left in place, reads only skip them so they can be shared by many readers
+// the sweeper or the next write of the key removes them
+func (b *Btree) get(key string) *item {
+	it := b.root.search(key)
+	if it == nil || it.expired(time.Now().UnixNano()) {
+		return nil
+	}
+
+	return it
+}
+
+// removing an expired key removes it but still reports it as missing
 func (b *Btree) Remove(key string) error {
+	it := b.root.search(key)
 	err := b.root.remove(key)
-	if err != nil {
-		return err
-	}
 
+	// root can lose its last item to a merge even if the key was not found
 	if b.root.currKey == 0 {
 		if !b.root.leaf {
 			b.root = b.root.node[0]
 		}
 	}
 
-	return nil
+	if err == nil {
+		b.expiries.remove(key)
+	}
+
+	if err == nil && it.expired(time.Now().UnixNano()) {
+		return KeyDoesNotExist
+	}
+
+	return err
 }
 
-// utility functions
-func copyValue(v store.Value) store.Value {
-	newMap := make(map[string]string)
-	for key, value := range v {
-		newMap[key] = value
+// RemoveExpired removes up to limit expired keys, every one of them if limit is 0
+// they are taken from the expiry index in the order they expired, so keys that are not due are never visited
+// it is meant to be called periodically by store.StartSweeper
+func (b *Btree) RemoveExpired(limit int) []store.Entry {
+	now := time.Now().UnixNano()
+
+	var removed []store.Entry
+	for limit <= 0 || len(removed) < limit {
+		ex, ok := b.expiries.first()
+		if !ok || ex.at > now {
+			break
+		}
+
+		removed = append(removed, b.root.search(ex.key).entry())
+		b.Remove(ex.key)
 	}
 
-	return newMap
+	return removed
+}
+
+// Scan visits the keys in the range of opts with an in-order traversal of the tree
+func (b *Btree) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	return b.scan(opts, func(it *item) bool {
+		return fn(it.getKey(), store.CopyValue(it.getValue()))
+	})
+}
+
+// visits the items in the range of opts that have not expired, up to opts.Limit
+func (b *Btree) scan(opts store.ScanOptions, fn func(*item) bool) error {
+	now := time.Now().UnixNano()
+
+	count := 0
+	visit := func(it *item) bool {
+		if it.expired(now) {
+			return true
+		}
+
+		if opts.Limit > 0 && count >= opts.Limit {
+			return false
+		}
+
+		count++
+		return fn(it)
+	}
+
+	if opts.Reverse {
+		b.root.reverseScan(opts, visit)
+	} else {
+		b.root.scan(opts, visit)
+	}
+
+	return nil
 }
 
+// utility function that copies the item and its value
 func copyItem(it *item) *item {
 	return &item{
-		key:   it.getKey(),
-		value: copyValue(it.getValue()),
+		key:     it.getKey(),
+		value:   store.CopyValue(it.getValue()),
+		expires: it.expires,
+		version: it.version,
 	}
 }
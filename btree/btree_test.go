@@ -1,7 +1,12 @@
 package btree
 
 import (
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/store/storetest"
 	"log"
+	"math/rand"
+	"sort"
 	"testing"
 )
 
@@ -30,6 +35,11 @@ func TestBtree_Simple(t *testing.T) {
 	}
 }
 
+func TestBtree_CopiesValues(t *testing.T) {
+	storetest.CopiesValues(t, NewBtree(3))
+	storetest.CopiesValues(t, NewCowBtree(3))
+}
+
 func TestBtree_Update(t *testing.T) {
 	tree := NewBtree(3)
 
@@ -144,6 +154,140 @@ func TestBtree_Remove2(t *testing.T) {
 	}
 }
 
+// compares the tree with a map after random inserts and removes
+func TestBtree_Random(t *testing.T) {
+	for _, minDegree := range []int{2, 3, 5} {
+		r := rand.New(rand.NewSource(int64(minDegree)))
+		tree := NewBtree(minDegree)
+		expected := make(map[string]string)
+
+		for i := 0; i < 2000; i++ {
+			key := fmt.Sprint(r.Intn(300))
+
+			if r.Intn(3) == 0 {
+				err := tree.Remove(key)
+				if _, ok := expected[key]; ok != (err == nil) {
+					t.Fatalf("degree [%v], remove [%v], got error = [%v]", minDegree, key, err)
+				}
+
+				delete(expected, key)
+				continue
+			}
+
+			if err := tree.Insert(key, map[string]string{"val": fmt.Sprint(i)}); err != nil {
+				t.Fatal(err)
+			}
+			expected[key] = fmt.Sprint(i)
+		}
+
+		for key, value := range expected {
+			if v := tree.Search(key); v["val"] != value {
+				t.Fatalf("degree [%v], key [%v], expected [%v], got = [%v]", minDegree, key, value, v)
+			}
+		}
+
+		count := 0
+		err := tree.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+			count++
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != len(expected) {
+			t.Fatalf("degree [%v], expected [%v] keys, got = [%v]", minDegree, len(expected), count)
+		}
+	}
+}
+
+// inserting an existing key replaces its value instead of adding a second item
+func TestBtree_InsertReplaces(t *testing.T) {
+	tree := NewBtree(2)
+	for i := 0; i < 10; i++ {
+		if err := tree.Insert("A", map[string]string{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v := tree.Search("A"); v["val"] != "9" {
+		t.Fatalf("expected [9], got = [%v]", v["val"])
+	}
+
+	if err := tree.Remove("A"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := tree.Search("A"); v != nil {
+		t.Fatalf("expected the key to be gone, got = [%v]", v)
+	}
+}
+
+func TestBtree_Scan(t *testing.T) {
+	tree := NewBtree(2)
+
+	var keys []string
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		keys = append(keys, key)
+
+		if err := tree.Insert(key, map[string]string{"val": key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		opts     store.ScanOptions
+		expected []string
+	}{
+		{"all", store.ScanOptions{}, keys},
+		{"range", store.ScanOptions{Start: "key010", End: "key020"}, keys[10:20]},
+		{"start between keys", store.ScanOptions{Start: "key0105", End: "key013"}, keys[11:13]},
+		{"limit", store.ScanOptions{Start: "key050", Limit: 5}, keys[50:55]},
+		{"reverse", store.ScanOptions{Start: "key010", End: "key020", Reverse: true}, reversed(keys[10:20])},
+		{"reverse limit", store.ScanOptions{Reverse: true, Limit: 3}, reversed(keys[97:])},
+		{"empty range", store.ScanOptions{Start: "key200"}, nil},
+	}
+
+	for _, test := range tests {
+		var got []string
+		err := tree.Scan(test.opts, func(key string, value store.Value) bool {
+			if value["val"] != key {
+				t.Fatalf("%v, key [%v] has value = [%v]", test.name, key, value)
+			}
+
+			got = append(got, key)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(test.expected) {
+			t.Fatalf("%v, expected [%v], got = [%v]", test.name, test.expected, got)
+		}
+	}
+
+	// stop early
+	count := 0
+	tree.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		count++
+		return count < 10
+	})
+
+	if count != 10 {
+		t.Fatalf("expected scan to stop after [10] keys, got = [%v]", count)
+	}
+}
+
+func reversed(keys []string) []string {
+	r := append([]string(nil), keys...)
+	sort.Sort(sort.Reverse(sort.StringSlice(r)))
+
+	return r
+}
+
 func createTestTree(t *testing.T, tree *Btree) {
 	err := tree.Insert("A", map[string]string{"val": "A"})
 	if err != nil {
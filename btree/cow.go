@@ -0,0 +1,545 @@
+package btree
+
+import (
+	"github.com/tPhume/gokv/store"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Copy-on-write variant of the btree
+// nodes are never modified once they are reachable from a published root
+// a mutation copies the nodes on the path from the root to the changed node and publishes a new root
+// so readers take a snapshot by loading the root atomically and never wait for writers
+// versions that are no longer referenced by any snapshot are reclaimed by the garbage collector
+
+// cowNode is immutable once published, items and node are sized to the number of items
+type cowNode struct {
+	items []*item
+	node  []*cowNode
+}
+
+func (n *cowNode) leaf() bool {
+	return len(n.node) == 0
+}
+
+// utility function to copy a node before changing it
+func (n *cowNode) clone() *cowNode {
+	c := &cowNode{items: make([]*item, len(n.items))}
+	copy(c.items, n.items)
+
+	if !n.leaf() {
+		c.node = make([]*cowNode, len(n.node))
+		copy(c.node, n.node)
+	}
+
+	return c
+}
+
+// utility function that finds index of item greater than or equal to the key
+func (n *cowNode) findKey(key string) int {
+	return sort.Search(len(n.items), func(i int) bool {
+		return n.items[i].getKey() >= key
+	})
+}
+
+func (n *cowNode) search(key string) *item {
+	for {
+		pos := n.findKey(key)
+		if pos < len(n.items) && n.items[pos].getKey() == key {
+			return n.items[pos]
+		}
+
+		if n.leaf() {
+			return nil
+		}
+
+		n = n.node[pos]
+	}
+}
+
+// returns the left and right halves of a full node, the node itself is left untouched
+func (n *cowNode) split(minDegree int) (*cowNode, *item, *cowNode) {
+	left := &cowNode{items: append([]*item(nil), n.items[:minDegree-1]...)}
+	right := &cowNode{items: append([]*item(nil), n.items[minDegree:]...)}
+
+	if !n.leaf() {
+		left.node = append([]*cowNode(nil), n.node[:minDegree]...)
+		right.node = append([]*cowNode(nil), n.node[minDegree:]...)
+	}
+
+	return left, n.items[minDegree-1], right
+}
+
+// returns a copy of a non full node with it inserted, or replaced if the key exists
+func (n *cowNode) insert(it *item, minDegree int) *cowNode {
+	c := n.clone()
+	pos := c.findKey(it.getKey())
+
+	if pos < len(c.items) && c.items[pos].getKey() == it.getKey() {
+		c.items[pos] = it
+		return c
+	}
+
+	if c.leaf() {
+		c.items = insertItem(c.items, pos, it)
+		return c
+	}
+
+	// split a full child before going down
+	if len(c.node[pos].items) == 2*minDegree-1 {
+		left, middle, right := c.node[pos].split(minDegree)
+		c.items = insertItem(c.items, pos, middle)
+		c.node[pos] = left
+		c.node = insertNode(c.node, pos+1, right)
+
+		if it.getKey() == middle.getKey() {
+			c.items[pos] = it
+			return c
+		}
+
+		if it.getKey() > middle.getKey() {
+			pos++
+		}
+	}
+
+	c.node[pos] = c.node[pos].insert(it, minDegree)
+
+	return c
+}
+
+// returns a copy of the node with the item of key replaced, nil if the key does not exist
+func (n *cowNode) replace(it *item) *cowNode {
+	pos := n.findKey(it.getKey())
+	if pos < len(n.items) && n.items[pos].getKey() == it.getKey() {
+		c := n.clone()
+		c.items[pos] = it
+		return c
+	}
+
+	if n.leaf() {
+		return nil
+	}
+
+	child := n.node[pos].replace(it)
+	if child == nil {
+		return nil
+	}
+
+	c := n.clone()
+	c.node[pos] = child
+
+	return c
+}
+
+// removes key from c, which must be a copy owned by the current mutation
+// every child that is changed is copied first, returns false if the key was not found
+func (c *cowNode) remove(key string, minDegree int) bool {
+	pos := c.findKey(key)
+
+	// key to delete is in current node
+	if pos < len(c.items) && c.items[pos].getKey() == key {
+		if c.leaf() {
+			c.items = removeItem(c.items, pos)
+			return true
+		}
+
+		if len(c.node[pos].items) >= minDegree {
+			// replace with predecessor and delete it from the left child
+			pred := c.node[pos].max()
+			c.node[pos] = c.node[pos].clone()
+			c.node[pos].remove(pred.getKey(), minDegree)
+			c.items[pos] = pred
+		} else if len(c.node[pos+1].items) >= minDegree {
+			// replace with successor and delete it from the right child
+			succ := c.node[pos+1].min()
+			c.node[pos+1] = c.node[pos+1].clone()
+			c.node[pos+1].remove(succ.getKey(), minDegree)
+			c.items[pos] = succ
+		} else {
+			// both children have minDegree - 1 items, merge them around the key
+			c.merge(pos)
+			c.node[pos].remove(key, minDegree)
+		}
+
+		return true
+	}
+
+	if c.leaf() {
+		return false
+	}
+
+	// make sure the child has at least minDegree items before going down
+	if len(c.node[pos].items) < minDegree {
+		pos = c.fill(pos, minDegree)
+	}
+
+	c.node[pos] = c.node[pos].clone()
+
+	return c.node[pos].remove(key, minDegree)
+}
+
+// utility function to fill up child at index, returns the index of the child that now covers its keys
+func (c *cowNode) fill(index int, minDegree int) int {
+	if index != 0 && len(c.node[index-1].items) >= minDegree {
+		// borrow from previous sibling
+		child, sibling := c.node[index].clone(), c.node[index-1].clone()
+		last := len(sibling.items) - 1
+
+		child.items = insertItem(child.items, 0, c.items[index-1])
+		c.items[index-1] = sibling.items[last]
+		sibling.items = sibling.items[:last]
+
+		if !child.leaf() {
+			child.node = insertNode(child.node, 0, sibling.node[last+1])
+			sibling.node = sibling.node[:last+1]
+		}
+
+		c.node[index-1], c.node[index] = sibling, child
+
+		return index
+	}
+
+	if index != len(c.items) && len(c.node[index+1].items) >= minDegree {
+		// borrow from next sibling
+		child, sibling := c.node[index].clone(), c.node[index+1].clone()
+
+		child.items = append(child.items, c.items[index])
+		c.items[index] = sibling.items[0]
+		sibling.items = sibling.items[1:]
+
+		if !child.leaf() {
+			child.node = append(child.node, sibling.node[0])
+			sibling.node = sibling.node[1:]
+		}
+
+		c.node[index], c.node[index+1] = child, sibling
+
+		return index
+	}
+
+	if index != len(c.items) {
+		c.merge(index)
+		return index
+	}
+
+	c.merge(index - 1)
+
+	return index - 1
+}
+
+// merge child at index, item at index and child at index+1 into a new node
+func (c *cowNode) merge(index int) {
+	child, sibling := c.node[index], c.node[index+1]
+
+	merged := &cowNode{items: make([]*item, 0, len(child.items)+len(sibling.items)+1)}
+	merged.items = append(merged.items, child.items...)
+	merged.items = append(merged.items, c.items[index])
+	merged.items = append(merged.items, sibling.items...)
+
+	if !child.leaf() {
+		merged.node = make([]*cowNode, 0, len(child.node)+len(sibling.node))
+		merged.node = append(merged.node, child.node...)
+		merged.node = append(merged.node, sibling.node...)
+	}
+
+	c.items = removeItem(c.items, index)
+	c.node = removeNode(c.node, index+1)
+	c.node[index] = merged
+}
+
+func (n *cowNode) min() *item {
+	for !n.leaf() {
+		n = n.node[0]
+	}
+
+	return n.items[0]
+}
+
+func (n *cowNode) max() *item {
+	for !n.leaf() {
+		n = n.node[len(n.node)-1]
+	}
+
+	return n.items[len(n.items)-1]
+}
+
+// in-order traversal of the items between opts.Start and opts.End
+// returns false once fn asked to stop or the end of the range was reached
+func (n *cowNode) scan(opts store.ScanOptions, fn func(*item) bool) bool {
+	for i := n.findKey(opts.Start); i <= len(n.items); i++ {
+		if !n.leaf() && !n.node[i].scan(opts, fn) {
+			return false
+		}
+
+		if i == len(n.items) {
+			break
+		}
+
+		if opts.End != "" && n.items[i].getKey() >= opts.End {
+			return false
+		}
+
+		if !fn(n.items[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// same as scan but visits items in descending order
+func (n *cowNode) reverseScan(opts store.ScanOptions, fn func(*item) bool) bool {
+	end := len(n.items)
+	if opts.End != "" {
+		end = n.findKey(opts.End)
+	}
+
+	for i := end; i >= 0; i-- {
+		if !n.leaf() && !n.node[i].reverseScan(opts, fn) {
+			return false
+		}
+
+		if i == 0 {
+			break
+		}
+
+		if n.items[i-1].getKey() < opts.Start {
+			return false
+		}
+
+		if !fn(n.items[i-1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CowBtree is a copy-on-write btree that implements the store interface
+// it is safe for concurrent use, writers are serialized and readers never block
+type CowBtree struct {
+	mu        sync.Mutex
+	root      atomic.Value
+	minDegree int
+}
+
+func NewCowBtree(minDegree int) *CowBtree {
+	t := &CowBtree{minDegree: minDegree}
+	t.root.Store(&cowNode{})
+
+	return t
+}
+
+// Concurrent marks the tree as safe for concurrent use, see store.Concurrent
+func (t *CowBtree) Concurrent() {}
+
+// inserting an existing key replaces its value
+func (t *CowBtree) Insert(key string, value store.Value) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.root.Store(t.insert(t.load(), key, value))
+
+	return nil
+}
+
+func (t *CowBtree) Update(key string, value store.Value) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	root := t.update(t.load(), key, value)
+	if root == nil {
+		return KeyDoesNotExist
+	}
+
+	t.root.Store(root)
+
+	return nil
+}
+
+func (t *CowBtree) Search(key string) store.Value {
+	return t.Snapshot().Search(key)
+}
+
+func (t *CowBtree) Remove(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	root := t.remove(t.load(), key)
+	if root == nil {
+		return KeyDoesNotExist
+	}
+
+	t.root.Store(root)
+
+	return nil
+}
+
+// ApplyBatch applies the operations to private copies and publishes a single new root
+// so readers see either none or all of the batch
+func (t *CowBtree) ApplyBatch(b *store.Batch) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	root := t.load()
+	for i, op := range b.Operations() {
+		var next *cowNode
+
+		switch op.Type {
+		case store.OpInsert:
+			// a CowBtree has no expiries
+			if !op.Expires.IsZero() {
+				return &store.BatchError{Index: i, Err: store.ErrTTLNotSupported}
+			}
+
+			next = t.insert(root, op.Key, op.Value)
+		case store.OpUpdate:
+			next = t.update(root, op.Key, op.Value)
+		case store.OpRemove:
+			next = t.remove(root, op.Key)
+		case store.OpCheck:
+			// a CowBtree has no versions, so no version check holds
+			if op.Version != 0 {
+				return &store.BatchError{Index: i, Err: store.ErrCheckFailed}
+			}
+
+			var current store.Value
+			if it := root.search(op.Key); it != nil {
+				current = it.getValue()
+			}
+
+			if !store.EqualValues(current, op.Value) {
+				return &store.BatchError{Index: i, Err: store.ErrCheckFailed}
+			}
+
+			continue
+		default:
+			return &store.BatchError{Index: i, Err: store.ErrUnknownOperation}
+		}
+
+		if next == nil {
+			return &store.BatchError{Index: i, Err: KeyDoesNotExist}
+		}
+
+		root = next
+	}
+
+	t.root.Store(root)
+
+	return nil
+}
+
+// returns the root of a new version with key inserted
+func (t *CowBtree) insert(root *cowNode, key string, value store.Value) *cowNode {
+	if len(root.items) == 2*t.minDegree-1 {
+		left, middle, right := root.split(t.minDegree)
+		root = &cowNode{items: []*item{middle}, node: []*cowNode{left, right}}
+	}
+
+	return root.insert(&item{key: key, value: store.CopyValue(value)}, t.minDegree)
+}
+
+// returns the root of a new version with the value of key replaced, nil if the key does not exist
+func (t *CowBtree) update(root *cowNode, key string, value store.Value) *cowNode {
+	return root.replace(&item{key: key, value: store.CopyValue(value)})
+}
+
+// returns the root of a new version without key, nil if the key does not exist
+func (t *CowBtree) remove(root *cowNode, key string) *cowNode {
+	root = root.clone()
+	if !root.remove(key, t.minDegree) {
+		return nil
+	}
+
+	if len(root.items) == 0 && !root.leaf() {
+		root = root.node[0]
+	}
+
+	return root
+}
+
+// Scan visits a consistent snapshot of the range, writes made during the scan are not visible
+func (t *CowBtree) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	return t.Snapshot().Scan(opts, fn)
+}
+
+// ScanConsistent is Scan, every scan of a CowBtree is consistent
+func (t *CowBtree) ScanConsistent(opts store.ScanOptions, fn store.ScanFunc) error {
+	return t.Scan(opts, fn)
+}
+
+// Snapshot returns an immutable point-in-time view of the tree
+func (t *CowBtree) Snapshot() *Snapshot {
+	return &Snapshot{root: t.load()}
+}
+
+func (t *CowBtree) load() *cowNode {
+	return t.root.Load().(*cowNode)
+}
+
+// Snapshot is a read only view of a CowBtree at the time it was taken
+// it stays valid, and unchanged, no matter how the tree is modified afterwards
+type Snapshot struct {
+	root *cowNode
+}
+
+func (s *Snapshot) Search(key string) store.Value {
+	it := s.root.search(key)
+	if it == nil {
+		return nil
+	}
+
+	return store.CopyValue(it.getValue())
+}
+
+func (s *Snapshot) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	count := 0
+	visit := func(it *item) bool {
+		if opts.Limit > 0 && count >= opts.Limit {
+			return false
+		}
+
+		count++
+		return fn(it.getKey(), store.CopyValue(it.getValue()))
+	}
+
+	if opts.Reverse {
+		s.root.reverseScan(opts, visit)
+	} else {
+		s.root.scan(opts, visit)
+	}
+
+	return nil
+}
+
+// utility functions for slices of immutable nodes
+func insertItem(items []*item, index int, it *item) []*item {
+	items = append(items, nil)
+	copy(items[index+1:], items[index:])
+	items[index] = it
+
+	return items
+}
+
+func removeItem(items []*item, index int) []*item {
+	result := make([]*item, 0, len(items)-1)
+	result = append(result, items[:index]...)
+
+	return append(result, items[index+1:]...)
+}
+
+func insertNode(nodes []*cowNode, index int, n *cowNode) []*cowNode {
+	nodes = append(nodes, nil)
+	copy(nodes[index+1:], nodes[index:])
+	nodes[index] = n
+
+	return nodes
+}
+
+func removeNode(nodes []*cowNode, index int) []*cowNode {
+	result := make([]*cowNode, 0, len(nodes)-1)
+	result = append(result, nodes[:index]...)
+
+	return append(result, nodes[index+1:]...)
+}
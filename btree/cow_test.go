@@ -0,0 +1,204 @@
+package btree
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// checks that every node but the root holds between minDegree-1 and 2*minDegree-1 sorted items
+// and that every leaf is at the same depth, returns the depth
+func checkCowNode(t *testing.T, n *cowNode, minDegree int, root bool, low, high string) int {
+	if !root && (len(n.items) < minDegree-1 || len(n.items) > 2*minDegree-1) {
+		t.Fatalf("node has [%v] items", len(n.items))
+	}
+
+	for i, it := range n.items {
+		if (i > 0 && n.items[i-1].getKey() >= it.getKey()) || (low != "" && it.getKey() <= low) || (high != "" && it.getKey() >= high) {
+			t.Fatalf("items out of order = [%v]", it.getKey())
+		}
+	}
+
+	if n.leaf() {
+		return 0
+	}
+
+	if len(n.node) != len(n.items)+1 {
+		t.Fatalf("node has [%v] items and [%v] children", len(n.items), len(n.node))
+	}
+
+	depth := -1
+	for i, child := range n.node {
+		childLow, childHigh := low, high
+		if i > 0 {
+			childLow = n.items[i-1].getKey()
+		}
+
+		if i < len(n.items) {
+			childHigh = n.items[i].getKey()
+		}
+
+		d := checkCowNode(t, child, minDegree, false, childLow, childHigh)
+		if depth != -1 && d != depth {
+			t.Fatalf("leaves at different depths")
+		}
+		depth = d
+	}
+
+	return depth + 1
+}
+
+func TestCowBtree_Random(t *testing.T) {
+	for _, minDegree := range []int{2, 3, 5} {
+		r := rand.New(rand.NewSource(int64(minDegree)))
+		tree := NewCowBtree(minDegree)
+		expected := make(map[string]string)
+
+		for i := 0; i < 3000; i++ {
+			key := fmt.Sprint(r.Intn(300))
+
+			switch r.Intn(4) {
+			case 0:
+				err := tree.Remove(key)
+				if _, ok := expected[key]; ok != (err == nil) {
+					t.Fatalf("degree [%v], remove [%v], got error = [%v]", minDegree, key, err)
+				}
+
+				delete(expected, key)
+			case 1:
+				err := tree.Update(key, store.Value{"val": fmt.Sprint(i)})
+				if _, ok := expected[key]; ok != (err == nil) {
+					t.Fatalf("degree [%v], update [%v], got error = [%v]", minDegree, key, err)
+				}
+
+				if err == nil {
+					expected[key] = fmt.Sprint(i)
+				}
+			default:
+				if err := tree.Insert(key, store.Value{"val": fmt.Sprint(i)}); err != nil {
+					t.Fatal(err)
+				}
+				expected[key] = fmt.Sprint(i)
+			}
+
+			checkCowNode(t, tree.load(), minDegree, true, "", "")
+		}
+
+		for key, value := range expected {
+			if v := tree.Search(key); v["val"] != value {
+				t.Fatalf("degree [%v], key [%v], expected [%v], got = [%v]", minDegree, key, value, v)
+			}
+		}
+
+		count := 0
+		tree.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+			count++
+			return true
+		})
+
+		if count != len(expected) {
+			t.Fatalf("degree [%v], expected [%v] keys, got = [%v]", minDegree, len(expected), count)
+		}
+	}
+}
+
+func TestCowBtree_Snapshot(t *testing.T) {
+	tree := NewCowBtree(2)
+	for i := 0; i < 100; i++ {
+		if err := tree.Insert(fmt.Sprintf("key%03d", i), store.Value{"val": "old"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot := tree.Snapshot()
+
+	for i := 0; i < 100; i += 2 {
+		if err := tree.Remove(fmt.Sprintf("key%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < 100; i += 2 {
+		if err := tree.Update(fmt.Sprintf("key%03d", i), store.Value{"val": "new"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tree.Insert("key100", store.Value{"val": "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the snapshot still sees the tree as it was
+	count := 0
+	snapshot.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		if value["val"] != "old" {
+			t.Fatalf("key [%v], expected [old], got = [%v]", key, value)
+		}
+
+		count++
+		return true
+	})
+
+	if count != 100 {
+		t.Fatalf("expected [100] keys in snapshot, got = [%v]", count)
+	}
+
+	if v := snapshot.Search("key100"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	if v := tree.Search("key001"); v["val"] != "new" {
+		t.Fatalf("expected [new], got = [%v]", v)
+	}
+}
+
+// run with -race
+func TestCowBtree_Concurrent(t *testing.T) {
+	tree := NewCowBtree(3)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("key%03d", i%100)
+				if i%3 == 2 {
+					tree.Remove(key)
+				} else {
+					tree.Insert(key, store.Value{"writer": fmt.Sprint(w)})
+				}
+			}
+		}(w)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				snapshot := tree.Snapshot()
+
+				// a snapshot is stable, two scans of it see the same keys
+				var first, second []string
+				snapshot.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+					first = append(first, key)
+					return true
+				})
+				snapshot.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+					second = append(second, key)
+					return true
+				})
+
+				if fmt.Sprint(first) != fmt.Sprint(second) {
+					t.Errorf("snapshot changed between scans")
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,904 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/tPhume/gokv/store"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// Disk-backed variant of the btree
+// nodes live in fixed-size pages of a single data file and are loaded through a buffer pool (see pool.go)
+// so the tree can hold more than fits in memory, only the pages in the pool are kept in memory
+// nodes are split by size rather than by item count, a node is split on the way down before it could overflow its page
+// nodes are not merged on remove, a subtree left without any item is freed and its pages reused
+// pages changed since the last Sync are journaled (see journal.go), a crash rolls the file back to the last Sync
+// page 0 of the file is the header
+// | magic "GOKVBTRE" (8) | format version (1) | page size (4) | root page (4) | page count (4) | first free page (4) | crc32 (4) |
+
+var (
+	ErrClosed        = errors.New("btree: closed")
+	ErrCorruptedPage = errors.New("btree: corrupted page")
+	ErrKeyTooLarge   = errors.New("btree: key does not fit in a page")
+	ErrNodeTooLarge  = errors.New("btree: node does not fit in its page")
+)
+
+const (
+	diskMagic   = "GOKVBTRE"
+	diskVersion = 1
+	headerSize  = 29
+
+	minPageSize = 512
+	maxPageSize = 1 << 16
+	minCache    = 8
+
+	// number of key-value pairs read under the lock at a time by Scan
+	diskScanChunk = 128
+)
+
+type DiskOptions struct {
+	// size of a page in bytes, between 512 and 65536, only used when the file is created
+	PageSize int
+	// number of pages kept in the buffer pool
+	CacheSize int
+}
+
+func DefaultDiskOptions() DiskOptions {
+	return DiskOptions{PageSize: 4096, CacheSize: 1024}
+}
+
+// DiskBtree is safe for concurrent use, Scan reads a chunk of pairs at a time under the lock and calls fn without it
+// changed pages reach the file when they are evicted from the buffer pool, and on Sync and Close
+// after a crash the tree is opened as it was at the last Sync or Close, wrap it with the wal to keep later writes
+// values are copies, once the I/O of a page failed the tree should be closed and opened again
+type DiskBtree struct {
+	mu   sync.Mutex
+	file *os.File
+	pool *bufferPool
+	root uint32
+	// items bigger than this keep their value in overflow pages
+	maxItem int
+	maxKey  int
+	closed  bool
+}
+
+// OpenDiskBtree opens the tree in the file at path, creating an empty one if the file is empty or missing
+// the journal is kept next to it at path + "-journal", and rolled back first if a crash left it behind
+func OpenDiskBtree(path string, opts DiskOptions) (*DiskBtree, error) {
+	if opts.PageSize == 0 {
+		opts.PageSize = DefaultDiskOptions().PageSize
+	}
+
+	if opts.PageSize < minPageSize || opts.PageSize > maxPageSize {
+		return nil, errors.New("btree: page size must be between 512 and 65536")
+	}
+
+	if opts.CacheSize < minCache {
+		opts.CacheSize = minCache
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	journalPath := path + "-journal"
+	if err := rollback(journalPath, file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	var t *DiskBtree
+	if info.Size() == 0 {
+		t, err = createDiskBtree(file, journalPath, opts)
+	} else {
+		t, err = loadDiskBtree(file, journalPath, opts)
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Concurrent marks the tree as safe for concurrent use, see store.Concurrent
+func (t *DiskBtree) Concurrent() {}
+
+// pages is the page count of the file, the pages the journal may have to save
+func newDiskBtree(file *os.File, journalPath string, pageSize int, pages uint32, cacheSize int) *DiskBtree {
+	maxItem := (pageSize - nodeHeaderSize) / 4
+
+	return &DiskBtree{
+		file:    file,
+		pool:    newBufferPool(file, newJournal(journalPath, pageSize, pages), cacheSize),
+		maxItem: maxItem,
+		// leaves room for the overflow reference and the length of the key
+		maxKey: maxItem - 16,
+	}
+}
+
+func createDiskBtree(file *os.File, journalPath string, opts DiskOptions) (*DiskBtree, error) {
+	t := newDiskBtree(file, journalPath, opts.PageSize, 0, opts.CacheSize)
+
+	// header and an empty root leaf
+	t.pool.pages = 2
+	t.root = 1
+	if err := t.pool.write(&diskNode{id: t.root, leaf: true}); err != nil {
+		return nil, err
+	}
+
+	if err := t.sync(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func loadDiskBtree(file *os.File, journalPath string, opts DiskOptions) (*DiskBtree, error) {
+	header := make([]byte, headerSize)
+	if _, err := file.ReadAt(header, 0); err == io.EOF {
+		return nil, ErrCorruptedPage
+	} else if err != nil {
+		return nil, err
+	}
+
+	if string(header[:len(diskMagic)]) != diskMagic || header[8] != diskVersion ||
+		binary.LittleEndian.Uint32(header[25:]) != crc32.ChecksumIEEE(header[:25]) {
+		return nil, ErrCorruptedPage
+	}
+
+	pageSize := int(binary.LittleEndian.Uint32(header[9:]))
+	if pageSize < minPageSize || pageSize > maxPageSize {
+		return nil, ErrCorruptedPage
+	}
+
+	pages := binary.LittleEndian.Uint32(header[17:])
+	t := newDiskBtree(file, journalPath, pageSize, pages, opts.CacheSize)
+	t.root = binary.LittleEndian.Uint32(header[13:])
+	t.pool.pages = pages
+	t.pool.free = binary.LittleEndian.Uint32(header[21:])
+
+	if t.root == 0 || t.root >= t.pool.pages {
+		return nil, ErrCorruptedPage
+	}
+
+	return t, nil
+}
+
+func (t *DiskBtree) Insert(key string, value store.Value) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	return t.insert(key, value)
+}
+
+func (t *DiskBtree) Update(key string, value store.Value) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	it, err := t.search(key)
+	if err != nil {
+		return err
+	}
+
+	if it == nil {
+		return KeyDoesNotExist
+	}
+
+	return t.insert(key, value)
+}
+
+// Search returns nil if the key is missing, or if its pages could not be read
+func (t *DiskBtree) Search(key string) store.Value {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+
+	it, err := t.search(key)
+	if err != nil || it == nil {
+		return nil
+	}
+
+	value, err := t.value(*it)
+	if err != nil {
+		return nil
+	}
+
+	return value
+}
+
+func (t *DiskBtree) Remove(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	n, err := t.pool.node(t.root)
+	if err != nil {
+		return err
+	}
+
+	// nodes from the root down to n, and the child followed in each of them
+	var path []*diskNode
+	var followed []int
+	for {
+		pos := n.findKey(key)
+		if pos < len(n.items) && n.items[pos].key == key {
+			if err := t.removeAt(n, pos); err != nil {
+				return err
+			}
+
+			if err := t.splitOverflow(append(path, n), followed); err != nil {
+				return err
+			}
+
+			return t.collapseRoot()
+		}
+
+		if n.leaf {
+			return KeyDoesNotExist
+		}
+
+		path, followed = append(path, n), append(followed, pos)
+		if n, err = t.pool.node(n.children[pos]); err != nil {
+			return err
+		}
+	}
+}
+
+// Scan reads the range a chunk at a time, fn is called without the lock so it may call back into the tree
+// writes that happen between two chunks are visible to the rest of the scan
+func (t *DiskBtree) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	count := 0
+
+	for {
+		chunk := opts
+		chunk.Limit = diskScanChunk
+		if opts.Limit > 0 && opts.Limit-count < chunk.Limit {
+			chunk.Limit = opts.Limit - count
+		}
+
+		keys, values, err := t.scanChunk(chunk)
+		if err != nil {
+			return err
+		}
+
+		for i := range keys {
+			if !fn(keys[i], values[i]) {
+				return nil
+			}
+		}
+
+		count += len(keys)
+		if len(keys) < chunk.Limit || (opts.Limit > 0 && count >= opts.Limit) {
+			return nil
+		}
+
+		// continue after the last key read
+		last := keys[len(keys)-1]
+		if opts.Reverse {
+			if last == "" {
+				return nil
+			}
+
+			opts.End = last
+		} else {
+			opts.Start = last + "\x00"
+		}
+	}
+}
+
+// utility function that copies the pairs of the range, up to the limit of opts, under the lock
+func (t *DiskBtree) scanChunk(opts store.ScanOptions) ([]string, []store.Value, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, nil, ErrClosed
+	}
+
+	var keys []string
+	var values []store.Value
+	visit := func(it diskItem) (bool, error) {
+		if len(keys) >= opts.Limit {
+			return false, nil
+		}
+
+		value, err := t.value(it)
+		if err != nil {
+			return false, err
+		}
+
+		keys = append(keys, it.key)
+		values = append(values, value)
+		return true, nil
+	}
+
+	var err error
+	if opts.Reverse {
+		_, err = t.reverseScan(t.root, opts, visit)
+	} else {
+		_, err = t.scan(t.root, opts, visit)
+	}
+
+	return keys, values, err
+}
+
+// Sync writes every changed page and the header to the file and forces them to stable storage
+func (t *DiskBtree) Sync() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	return t.sync()
+}
+
+func (t *DiskBtree) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+
+	// a journal left behind by a failed sync is rolled back on the next open
+	err := t.sync()
+	if closeErr := t.pool.journal.close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := t.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	t.closed = true
+
+	return err
+}
+
+// writes the header last then removes the journal, the file is consistent again
+func (t *DiskBtree) sync() error {
+	if err := t.pool.flush(); err != nil {
+		return err
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, diskMagic)
+	header[8] = diskVersion
+	binary.LittleEndian.PutUint32(header[9:], uint32(t.pool.pageSize))
+	binary.LittleEndian.PutUint32(header[13:], t.root)
+	binary.LittleEndian.PutUint32(header[17:], t.pool.pages)
+	binary.LittleEndian.PutUint32(header[21:], t.pool.free)
+	binary.LittleEndian.PutUint32(header[25:], crc32.ChecksumIEEE(header[:25]))
+
+	if err := t.pool.journal.save(t.file, 0); err != nil {
+		return err
+	}
+
+	if err := t.pool.journal.sync(); err != nil {
+		return err
+	}
+
+	if _, err := t.file.WriteAt(header, 0); err != nil {
+		return err
+	}
+
+	if err := t.file.Sync(); err != nil {
+		return err
+	}
+
+	return t.pool.journal.checkpoint(t.pool.pages)
+}
+
+// returns the item of key, nil if it is missing
+func (t *DiskBtree) search(key string) (*diskItem, error) {
+	n, err := t.pool.node(t.root)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		pos := n.findKey(key)
+		if pos < len(n.items) && n.items[pos].key == key {
+			return &n.items[pos], nil
+		}
+
+		if n.leaf {
+			return nil, nil
+		}
+
+		if n, err = t.pool.node(n.children[pos]); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// inserts or replaces key, splitting every full node on the way down
+func (t *DiskBtree) insert(key string, value store.Value) error {
+	if len(key) > t.maxKey {
+		return ErrKeyTooLarge
+	}
+
+	it, err := t.newItem(key, value)
+	if err != nil {
+		return err
+	}
+
+	n, err := t.pool.node(t.root)
+	if err != nil {
+		return err
+	}
+
+	if t.full(n) {
+		id, err := t.pool.allocate()
+		if err != nil {
+			return err
+		}
+
+		root := &diskNode{id: id, children: []uint32{n.id}}
+		if err := t.splitChild(root, 0, n); err != nil {
+			return err
+		}
+
+		t.root = id
+		n = root
+	}
+
+	for {
+		pos := n.findKey(key)
+		if pos < len(n.items) && n.items[pos].key == key {
+			old := n.items[pos]
+			n.items[pos] = it
+			if err := t.pool.write(n); err != nil {
+				return err
+			}
+
+			return t.freeOverflow(old)
+		}
+
+		if n.leaf {
+			n.items = append(n.items, diskItem{})
+			copy(n.items[pos+1:], n.items[pos:])
+			n.items[pos] = it
+
+			return t.pool.write(n)
+		}
+
+		child, err := t.pool.node(n.children[pos])
+		if err != nil {
+			return err
+		}
+
+		if t.full(child) {
+			// the middle item of child moved up to pos, look at n again
+			if err := t.splitChild(n, pos, child); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		n = child
+	}
+}
+
+// a full node might not have room for one more item and child
+func (t *DiskBtree) full(n *diskNode) bool {
+	return n.size()+t.maxItem+childSize > t.pool.pageSize
+}
+
+// splits the full child at index i of parent around its middle in bytes
+// parent must not be full, unless the caller splits it next (see splitOverflow)
+func (t *DiskBtree) splitChild(parent *diskNode, i int, child *diskNode) error {
+	total := 0
+	for _, it := range child.items {
+		total += it.size()
+	}
+
+	m, acc := 0, 0
+	for m < len(child.items)-2 {
+		acc += child.items[m].size()
+		if 2*acc >= total {
+			break
+		}
+		m++
+	}
+
+	if m == 0 {
+		m = 1
+	}
+
+	id, err := t.pool.allocate()
+	if err != nil {
+		return err
+	}
+
+	right := &diskNode{id: id, leaf: child.leaf, items: append([]diskItem(nil), child.items[m+1:]...)}
+	if !child.leaf {
+		right.children = append([]uint32(nil), child.children[m+1:]...)
+		child.children = append([]uint32(nil), child.children[:m+1]...)
+	}
+
+	median := child.items[m]
+	child.items = append([]diskItem(nil), child.items[:m]...)
+
+	parent.items = append(parent.items, diskItem{})
+	copy(parent.items[i+1:], parent.items[i:])
+	parent.items[i] = median
+
+	parent.children = append(parent.children, 0)
+	copy(parent.children[i+2:], parent.children[i+1:])
+	parent.children[i+1] = right.id
+
+	for _, n := range []*diskNode{child, right, parent} {
+		if err := t.pool.write(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splits the last node of path if it no longer fits in its page, then its parent if the median made it overflow
+// and so on up to the root, path starts at the root and followed[i] is the index of path[i+1] in path[i]
+// a node only grows past its page when removeAt replaced one of its items by a bigger predecessor or successor
+func (t *DiskBtree) splitOverflow(path []*diskNode, followed []int) error {
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+		if n.size() <= t.pool.pageSize {
+			return nil
+		}
+
+		if i > 0 {
+			if err := t.splitChild(path[i-1], followed[i-1], n); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		id, err := t.pool.allocate()
+		if err != nil {
+			return err
+		}
+
+		root := &diskNode{id: id, children: []uint32{n.id}}
+		if err := t.splitChild(root, 0, n); err != nil {
+			return err
+		}
+
+		t.root = id
+	}
+
+	return nil
+}
+
+// removes the item at pos of n, an item of an internal node is replaced by its predecessor or successor
+// which may be bigger, so n may not fit in its page afterwards, see splitOverflow
+func (t *DiskBtree) removeAt(n *diskNode, pos int) error {
+	old := n.items[pos]
+
+	if n.leaf {
+		n.items = append(n.items[:pos], n.items[pos+1:]...)
+	} else if it, ok, err := t.popMax(n.children[pos]); err != nil {
+		return err
+	} else if ok {
+		n.items[pos] = it
+	} else if it, ok, err := t.popMin(n.children[pos+1]); err != nil {
+		return err
+	} else if ok {
+		n.items[pos] = it
+	} else {
+		// both subtrees around the item are empty, drop one of them with it
+		if err := t.freeSubtree(n.children[pos]); err != nil {
+			return err
+		}
+
+		n.items = append(n.items[:pos], n.items[pos+1:]...)
+		n.children = append(n.children[:pos], n.children[pos+1:]...)
+	}
+
+	if err := t.pool.write(n); err != nil {
+		return err
+	}
+
+	return t.freeOverflow(old)
+}
+
+// removes and returns the biggest item of the subtree, false if it has none
+func (t *DiskBtree) popMax(id uint32) (diskItem, bool, error) {
+	n, err := t.pool.node(id)
+	if err != nil {
+		return diskItem{}, false, err
+	}
+
+	if !n.leaf {
+		if it, ok, err := t.popMax(n.children[len(n.children)-1]); err != nil || ok {
+			return it, ok, err
+		}
+	}
+
+	if len(n.items) == 0 {
+		return diskItem{}, false, nil
+	}
+
+	last := len(n.items) - 1
+	it := n.items[last]
+	n.items = n.items[:last]
+
+	// the subtree after the item is empty
+	if !n.leaf {
+		if err := t.freeSubtree(n.children[last+1]); err != nil {
+			return diskItem{}, false, err
+		}
+
+		n.children = n.children[:last+1]
+	}
+
+	return it, true, t.pool.write(n)
+}
+
+// removes and returns the smallest item of the subtree, false if it has none
+func (t *DiskBtree) popMin(id uint32) (diskItem, bool, error) {
+	n, err := t.pool.node(id)
+	if err != nil {
+		return diskItem{}, false, err
+	}
+
+	if !n.leaf {
+		if it, ok, err := t.popMin(n.children[0]); err != nil || ok {
+			return it, ok, err
+		}
+	}
+
+	if len(n.items) == 0 {
+		return diskItem{}, false, nil
+	}
+
+	it := n.items[0]
+	n.items = append([]diskItem(nil), n.items[1:]...)
+
+	// the subtree before the item is empty
+	if !n.leaf {
+		if err := t.freeSubtree(n.children[0]); err != nil {
+			return diskItem{}, false, err
+		}
+
+		n.children = append([]uint32(nil), n.children[1:]...)
+	}
+
+	return it, true, t.pool.write(n)
+}
+
+// replaces a root without items by its only child
+func (t *DiskBtree) collapseRoot() error {
+	for {
+		root, err := t.pool.node(t.root)
+		if err != nil {
+			return err
+		}
+
+		if root.leaf || len(root.items) != 0 {
+			return nil
+		}
+
+		t.root = root.children[0]
+		if err := t.pool.release(root.id); err != nil {
+			return err
+		}
+	}
+}
+
+// puts every page of the subtree on the free list
+func (t *DiskBtree) freeSubtree(id uint32) error {
+	n, err := t.pool.node(id)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range n.children {
+		if err := t.freeSubtree(child); err != nil {
+			return err
+		}
+	}
+
+	for _, it := range n.items {
+		if err := t.freeOverflow(it); err != nil {
+			return err
+		}
+	}
+
+	return t.pool.release(id)
+}
+
+// returns the item of key, with its value in overflow pages if it does not fit in a node
+func (t *DiskBtree) newItem(key string, value store.Value) (diskItem, error) {
+	it := diskItem{key: key, value: encodeValue(value)}
+	if it.size() <= t.maxItem {
+		return it, nil
+	}
+
+	it.length = uint32(len(it.value))
+	data := it.value
+	it.value = nil
+
+	// written back to front so each page knows the next one
+	room := t.pool.pageSize - overflowHeaderSize
+	next := uint32(0)
+	for end := len(data); end > 0; end -= room {
+		start := end - room
+		if start < 0 {
+			start = 0
+		}
+
+		id, err := t.pool.allocate()
+		if err != nil {
+			return diskItem{}, err
+		}
+
+		page := make([]byte, t.pool.pageSize)
+		page[0] = pageOverflow
+		binary.LittleEndian.PutUint32(page[1:], next)
+		binary.LittleEndian.PutUint16(page[5:], uint16(end-start))
+		copy(page[overflowHeaderSize:], data[start:end])
+
+		if err := t.pool.writePage(id, page); err != nil {
+			return diskItem{}, err
+		}
+
+		next = id
+	}
+
+	it.overflow = next
+
+	return it, nil
+}
+
+// returns the decoded value of the item, reading its overflow pages if it has any
+func (t *DiskBtree) value(it diskItem) (store.Value, error) {
+	if it.overflow == 0 {
+		return decodeValue(it.value)
+	}
+
+	data := make([]byte, 0, it.length)
+	for id := it.overflow; id != 0; {
+		f, err := t.pool.get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		length := int(binary.LittleEndian.Uint16(f.page[5:]))
+		if f.page[0] != pageOverflow || overflowHeaderSize+length > len(f.page) {
+			return nil, ErrCorruptedPage
+		}
+
+		data = append(data, f.page[overflowHeaderSize:overflowHeaderSize+length]...)
+		id = binary.LittleEndian.Uint32(f.page[1:])
+	}
+
+	if uint32(len(data)) != it.length {
+		return nil, ErrCorruptedPage
+	}
+
+	return decodeValue(data)
+}
+
+func (t *DiskBtree) freeOverflow(it diskItem) error {
+	for id := it.overflow; id != 0; {
+		f, err := t.pool.get(id)
+		if err != nil {
+			return err
+		}
+
+		if f.page[0] != pageOverflow {
+			return ErrCorruptedPage
+		}
+
+		next := binary.LittleEndian.Uint32(f.page[1:])
+		if err := t.pool.release(id); err != nil {
+			return err
+		}
+
+		id = next
+	}
+
+	return nil
+}
+
+func (t *DiskBtree) scan(id uint32, opts store.ScanOptions, fn func(diskItem) (bool, error)) (bool, error) {
+	n, err := t.pool.node(id)
+	if err != nil {
+		return false, err
+	}
+
+	// children before the first item bigger or equal to Start only hold smaller keys
+	start := 0
+	if opts.Start != "" {
+		start = n.findKey(opts.Start)
+	}
+
+	for i := start; i <= len(n.items); i++ {
+		if !n.leaf {
+			if ok, err := t.scan(n.children[i], opts, fn); !ok || err != nil {
+				return false, err
+			}
+		}
+
+		if i == len(n.items) {
+			break
+		}
+
+		if opts.End != "" && n.items[i].key >= opts.End {
+			return false, nil
+		}
+
+		if ok, err := fn(n.items[i]); !ok || err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// same as scan but visits items in descending order
+func (t *DiskBtree) reverseScan(id uint32, opts store.ScanOptions, fn func(diskItem) (bool, error)) (bool, error) {
+	n, err := t.pool.node(id)
+	if err != nil {
+		return false, err
+	}
+
+	// children after the first item bigger or equal to End only hold bigger keys
+	end := len(n.items)
+	if opts.End != "" {
+		end = n.findKey(opts.End)
+	}
+
+	for i := end; i >= 0; i-- {
+		if !n.leaf {
+			if ok, err := t.reverseScan(n.children[i], opts, fn); !ok || err != nil {
+				return false, err
+			}
+		}
+
+		if i == 0 {
+			break
+		}
+
+		if n.items[i-1].key < opts.Start {
+			return false, nil
+		}
+
+		if ok, err := fn(n.items[i-1]); !ok || err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,396 @@
+package btree
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func tempDiskPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "btree")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "gokv.db"), func() { os.RemoveAll(dir) }
+}
+
+// checks that every node fits in its page and holds sorted items, and that every leaf is at the same depth
+func checkDiskNode(t *testing.T, tree *DiskBtree, id uint32, low, high string) int {
+	n, err := tree.pool.node(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n.size() > tree.pool.pageSize {
+		t.Fatalf("node of [%v] bytes does not fit in a page", n.size())
+	}
+
+	for i, it := range n.items {
+		if (i > 0 && n.items[i-1].key >= it.key) || (low != "" && it.key <= low) || (high != "" && it.key >= high) {
+			t.Fatalf("items out of order = [%v]", it.key)
+		}
+	}
+
+	if n.leaf {
+		return 0
+	}
+
+	if len(n.children) != len(n.items)+1 {
+		t.Fatalf("node has [%v] items and [%v] children", len(n.items), len(n.children))
+	}
+
+	depth := -1
+	for i, child := range n.children {
+		childLow, childHigh := low, high
+		if i > 0 {
+			childLow = n.items[i-1].key
+		}
+
+		if i < len(n.items) {
+			childHigh = n.items[i].key
+		}
+
+		d := checkDiskNode(t, tree, child, childLow, childHigh)
+		if depth != -1 && d != depth {
+			t.Fatalf("leaves at different depths")
+		}
+		depth = d
+	}
+
+	return depth + 1
+}
+
+func TestDiskBtree_Random(t *testing.T) {
+	path, cleanup := tempDiskPath(t)
+	defer cleanup()
+
+	// small pages and a small pool, so nodes split often and pages are evicted all the time
+	opts := DiskOptions{PageSize: 512, CacheSize: 8}
+	tree, err := OpenDiskBtree(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	expected := make(map[string]string)
+
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("key%04d", r.Intn(500))
+
+		// some values need overflow pages
+		val := fmt.Sprint(i)
+		if r.Intn(10) == 0 {
+			val = strings.Repeat(val, 1+r.Intn(400))
+		}
+
+		switch r.Intn(4) {
+		case 0:
+			err := tree.Remove(key)
+			if _, ok := expected[key]; ok != (err == nil) {
+				t.Fatalf("remove [%v], got error = [%v]", key, err)
+			}
+
+			delete(expected, key)
+		case 1:
+			err := tree.Update(key, store.Value{"val": val})
+			if _, ok := expected[key]; ok != (err == nil) {
+				t.Fatalf("update [%v], got error = [%v]", key, err)
+			}
+
+			if err == nil {
+				expected[key] = val
+			}
+		default:
+			if err := tree.Insert(key, store.Value{"val": val}); err != nil {
+				t.Fatal(err)
+			}
+			expected[key] = val
+		}
+
+		if i%100 == 0 {
+			checkDiskNode(t, tree, tree.root, "", "")
+		}
+	}
+
+	check := func(tree *DiskBtree) {
+		for key, value := range expected {
+			if v := tree.Search(key); v["val"] != value {
+				t.Fatalf("key [%v], expected [%v], got = [%v]", key, value, v)
+			}
+		}
+
+		count, last := 0, ""
+		err := tree.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+			if key <= last {
+				t.Fatalf("keys out of order [%v] after [%v]", key, last)
+			}
+
+			count++
+			last = key
+			return true
+		})
+
+		if err != nil || count != len(expected) {
+			t.Fatalf("expected [%v] keys, got = [%v], %v", len(expected), count, err)
+		}
+	}
+
+	check(tree)
+	if err := tree.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// everything is read back from the file
+	tree, err = OpenDiskBtree(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	check(tree)
+	checkDiskNode(t, tree, tree.root, "", "")
+}
+
+// keys of very different sizes, so the predecessor or successor replacing a removed key is often much bigger
+func TestDiskBtree_RandomRemove(t *testing.T) {
+	path, cleanup := tempDiskPath(t)
+	defer cleanup()
+
+	tree, err := OpenDiskBtree(path, DiskOptions{PageSize: 512, CacheSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	r := rand.New(rand.NewSource(1))
+	expected := make(map[string]bool)
+
+	for i := 0; i < 20000; i++ {
+		if r.Intn(3) == 0 && len(expected) > 0 {
+			for key := range expected {
+				if err := tree.Remove(key); err != nil {
+					t.Fatalf("remove [%v], got error = [%v]", key, err)
+				}
+
+				delete(expected, key)
+				break
+			}
+		} else {
+			key := fmt.Sprintf("%04d", r.Intn(2000)) + strings.Repeat("k", r.Intn(tree.maxKey-4))
+			if err := tree.Insert(key, store.Value{}); err != nil {
+				t.Fatal(err)
+			}
+
+			expected[key] = true
+		}
+
+		if i%200 == 0 {
+			checkDiskNode(t, tree, tree.root, "", "")
+			if err := tree.Sync(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	checkDiskNode(t, tree, tree.root, "", "")
+	for key := range expected {
+		if tree.Search(key) == nil {
+			t.Fatalf("key [%v] is missing", key)
+		}
+	}
+}
+
+// pages written back after the last Sync are rolled back when the tree is opened again
+func TestDiskBtree_Crash(t *testing.T) {
+	path, cleanup := tempDiskPath(t)
+	defer cleanup()
+
+	tree, err := OpenDiskBtree(path, DiskOptions{PageSize: 512, CacheSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 500; i++ {
+		if err := tree.Insert(fmt.Sprintf("key%04d", i), store.Value{"val": strings.Repeat("v", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tree.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// enough writes for changed pages to be evicted to the file
+	for i := 0; i < 500; i += 2 {
+		if err := tree.Remove(fmt.Sprintf("key%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 500; i < 1000; i++ {
+		if err := tree.Insert(fmt.Sprintf("key%04d", i), store.Value{"val": "new"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(path + "-journal"); err != nil {
+		t.Fatalf("expected a journal, got error = [%v]", err)
+	}
+
+	// crash, nothing else reaches the file
+	tree.pool.journal.close()
+	tree.file.Close()
+
+	tree, err = OpenDiskBtree(path, DiskOptions{PageSize: 512, CacheSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	if _, err := os.Stat(path + "-journal"); !os.IsNotExist(err) {
+		t.Fatalf("expected the journal to be removed, got error = [%v]", err)
+	}
+
+	checkDiskNode(t, tree, tree.root, "", "")
+
+	count := 0
+	if err := tree.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		if expected := fmt.Sprintf("key%04d", count); key != expected || value["val"] != strings.Repeat("v", count) {
+			t.Fatalf("expected [%v], got = [%v] %v", expected, key, value)
+		}
+
+		count++
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 500 {
+		t.Fatalf("expected [500] keys, got = [%v]", count)
+	}
+}
+
+func TestDiskBtree_Scan(t *testing.T) {
+	path, cleanup := tempDiskPath(t)
+	defer cleanup()
+
+	tree, err := OpenDiskBtree(path, DiskOptions{PageSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 1000; i++ {
+		tree.Insert(fmt.Sprintf("key%04d", i), store.Value{"val": fmt.Sprint(i)})
+	}
+
+	tests := []struct {
+		name        string
+		opts        store.ScanOptions
+		count       int
+		first, last string
+	}{
+		{"all", store.ScanOptions{}, 1000, "key0000", "key0999"},
+		{"range", store.ScanOptions{Start: "key0100", End: "key0200"}, 100, "key0100", "key0199"},
+		{"limit", store.ScanOptions{Start: "key0500", Limit: 10}, 10, "key0500", "key0509"},
+		{"reverse", store.ScanOptions{End: "key0500", Reverse: true}, 500, "key0499", "key0000"},
+		{"reverse range limit", store.ScanOptions{Start: "key0100", End: "key0200", Limit: 5, Reverse: true}, 5, "key0199", "key0195"},
+	}
+
+	for _, test := range tests {
+		var keys []string
+		if err := tree.Scan(test.opts, func(key string, value store.Value) bool {
+			keys = append(keys, key)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(keys) != test.count || keys[0] != test.first || keys[len(keys)-1] != test.last {
+			t.Fatalf("%v: expected [%v] keys from [%v] to [%v], got = [%v] keys %v", test.name, test.count, test.first, test.last, len(keys), keys)
+		}
+	}
+
+	// fn is called without the lock, so it can write to the tree
+	count := 0
+	if err := tree.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		count++
+		return tree.Update(key, store.Value{"val": "scanned"}) == nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := tree.Search("key0999"); count != 1000 || v["val"] != "scanned" {
+		t.Fatalf("expected [1000] keys updated, got = [%v] keys, last = %v", count, v)
+	}
+}
+
+func TestDiskBtree_FreePages(t *testing.T) {
+	path, cleanup := tempDiskPath(t)
+	defer cleanup()
+
+	tree, err := OpenDiskBtree(path, DiskOptions{PageSize: 512, CacheSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	fill := func() {
+		for i := 0; i < 500; i++ {
+			if err := tree.Insert(fmt.Sprintf("key%04d", i), store.Value{"val": strings.Repeat("v", i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	fill()
+	pages := tree.pool.pages
+
+	for i := 0; i < 500; i++ {
+		if err := tree.Remove(fmt.Sprintf("key%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the root collapsed back to a leaf
+	if root, _ := tree.pool.node(tree.root); !root.leaf || len(root.items) != 0 {
+		t.Fatalf("expected an empty root leaf, got = %v", root)
+	}
+
+	// pages of removed keys are reused, the file does not grow
+	fill()
+	if tree.pool.pages > pages {
+		t.Fatalf("expected at most [%v] pages, got = [%v]", pages, tree.pool.pages)
+	}
+}
+
+func TestDiskBtree_Errors(t *testing.T) {
+	path, cleanup := tempDiskPath(t)
+	defer cleanup()
+
+	tree, err := OpenDiskBtree(path, DiskOptions{PageSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tree.Insert(strings.Repeat("k", 512), store.Value{}); err != ErrKeyTooLarge {
+		t.Fatalf("expected %v, got = %v", ErrKeyTooLarge, err)
+	}
+
+	tree.Close()
+	if err := tree.Insert("A", store.Value{}); err != ErrClosed {
+		t.Fatalf("expected %v, got = %v", ErrClosed, err)
+	}
+
+	// not a tree file
+	ioutil.WriteFile(path, []byte("not a btree"), 0644)
+	if _, err := OpenDiskBtree(path, DefaultDiskOptions()); err != ErrCorruptedPage {
+		t.Fatalf("expected %v, got = %v", ErrCorruptedPage, err)
+	}
+}
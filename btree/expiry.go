@@ -0,0 +1,88 @@
+package btree
+
+import "container/heap"
+
+// expiries index the keys of a Btree that have an expiry by the time they expire at
+// so RemoveExpired finds the keys that are due without visiting the others
+type expiries struct {
+	heap expiryHeap
+	keys map[string]*expiry
+}
+
+type expiry struct {
+	key string
+	// unix nano time the key expires at
+	at int64
+	// position of the expiry in the heap
+	index int
+}
+
+func newExpiries() *expiries {
+	return &expiries{keys: make(map[string]*expiry)}
+}
+
+// set records the time key expires at, 0 means it never expires
+func (e *expiries) set(key string, at int64) {
+	if at == 0 {
+		e.remove(key)
+		return
+	}
+
+	if ex, ok := e.keys[key]; ok {
+		ex.at = at
+		heap.Fix(&e.heap, ex.index)
+		return
+	}
+
+	ex := &expiry{key: key, at: at}
+	e.keys[key] = ex
+	heap.Push(&e.heap, ex)
+}
+
+func (e *expiries) remove(key string) {
+	if ex, ok := e.keys[key]; ok {
+		heap.Remove(&e.heap, ex.index)
+		delete(e.keys, key)
+	}
+}
+
+// returns the key that expires first, false if no key has an expiry
+func (e *expiries) first() (*expiry, bool) {
+	if len(e.heap) == 0 {
+		return nil, false
+	}
+
+	return e.heap[0], true
+}
+
+// expiryHeap implements heap.Interface, the key that expires first is at the top
+type expiryHeap []*expiry
+
+func (h expiryHeap) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].at < h[j].at
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	ex := x.(*expiry)
+	ex.index = len(*h)
+	*h = append(*h, ex)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	ex := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+
+	return ex
+}
@@ -0,0 +1,221 @@
+package btree
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Rollback journal of the disk btree
+// before a page of the data file is overwritten for the first time since the last checkpoint (Sync or Close)
+// its previous bytes are appended to the journal, which reaches the disk before the page is overwritten
+// a checkpoint removes the journal once every page and the header are on disk
+// so after a crash the journal holds the checkpointed bytes of every page changed since, and opening the tree
+// copies them back: the tree is as it was at the last checkpoint, never half written
+// | magic "GOKVJRNL" (8) | page size (4) | page count (4) | crc32 (4) |   then for every page
+// | page id (4) | crc32 of the id and the page (4) | page |
+// a record cut short or failing its checksum ends the journal, its page was not overwritten yet
+
+const (
+	journalMagic      = "GOKVJRNL"
+	journalHeaderSize = 20
+)
+
+type journal struct {
+	path     string
+	pageSize int
+	// number of pages at the last checkpoint, pages past it hold nothing to roll back to
+	pages uint32
+	// nil until a page is saved after a checkpoint
+	file  *os.File
+	saved map[uint32]bool
+	// whether records were appended since the journal was last synced
+	unsynced bool
+}
+
+func newJournal(path string, pageSize int, pages uint32) *journal {
+	return &journal{path: path, pageSize: pageSize, pages: pages, saved: make(map[uint32]bool)}
+}
+
+// save appends the current bytes of the page from data, unless they were saved already since the checkpoint
+func (j *journal) save(data *os.File, id uint32) error {
+	if id >= j.pages || j.saved[id] {
+		return nil
+	}
+
+	if j.file == nil {
+		if err := j.create(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, 8+j.pageSize)
+	binary.LittleEndian.PutUint32(record, id)
+	if _, err := data.ReadAt(record[8:], int64(id)*int64(j.pageSize)); err != nil && err != io.EOF {
+		return err
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(record[:4])
+	crc.Write(record[8:])
+	binary.LittleEndian.PutUint32(record[4:], crc.Sum32())
+
+	if _, err := j.file.Write(record); err != nil {
+		return err
+	}
+
+	j.saved[id] = true
+	j.unsynced = true
+
+	return nil
+}
+
+// sync forces the saved pages to disk, it must return before any of them is overwritten
+func (j *journal) sync() error {
+	if !j.unsynced {
+		return nil
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return err
+	}
+
+	j.unsynced = false
+
+	return nil
+}
+
+// checkpoint removes the journal, the data file must have been synced with pages pages
+func (j *journal) checkpoint(pages uint32) error {
+	j.pages = pages
+	j.saved = make(map[uint32]bool)
+	j.unsynced = false
+
+	if j.file == nil {
+		return nil
+	}
+
+	j.file.Close()
+	j.file = nil
+
+	if err := os.Remove(j.path); err != nil {
+		return err
+	}
+
+	return syncDir(j.path)
+}
+
+// close closes the journal file, leaving it behind if pages were saved since the checkpoint
+func (j *journal) close() error {
+	if j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	j.file = nil
+
+	return err
+}
+
+// utility function that starts the journal with its header, the directory is synced so the journal is found after a crash
+func (j *journal) create() error {
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, journalHeaderSize)
+	copy(header, journalMagic)
+	binary.LittleEndian.PutUint32(header[8:], uint32(j.pageSize))
+	binary.LittleEndian.PutUint32(header[12:], j.pages)
+	binary.LittleEndian.PutUint32(header[16:], crc32.ChecksumIEEE(header[:16]))
+
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := syncDir(j.path); err != nil {
+		file.Close()
+		return err
+	}
+
+	j.file = file
+
+	return nil
+}
+
+// rollback copies the pages saved in the journal at path back into data and truncates data to the page count
+// of the checkpoint, then removes the journal, it does nothing if there is no journal
+func rollback(path string, data *os.File) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := make([]byte, journalHeaderSize)
+	_, err = io.ReadFull(file, header)
+	valid := err == nil && string(header[:len(journalMagic)]) == journalMagic &&
+		binary.LittleEndian.Uint32(header[16:]) == crc32.ChecksumIEEE(header[:16])
+
+	// a journal without a complete header never got a record to disk, so no page was overwritten
+	if valid {
+		pageSize := int(binary.LittleEndian.Uint32(header[8:]))
+		pages := binary.LittleEndian.Uint32(header[12:])
+		if pageSize < minPageSize || pageSize > maxPageSize {
+			return ErrCorruptedPage
+		}
+
+		record := make([]byte, 8+pageSize)
+		for {
+			if _, err := io.ReadFull(file, record); err != nil {
+				break
+			}
+
+			crc := crc32.NewIEEE()
+			crc.Write(record[:4])
+			crc.Write(record[8:])
+			if binary.LittleEndian.Uint32(record[4:]) != crc.Sum32() {
+				break
+			}
+
+			id := binary.LittleEndian.Uint32(record)
+			if _, err := data.WriteAt(record[8:], int64(id)*int64(pageSize)); err != nil {
+				return err
+			}
+		}
+
+		if err := data.Truncate(int64(pages) * int64(pageSize)); err != nil {
+			return err
+		}
+
+		if err := data.Sync(); err != nil {
+			return err
+		}
+	}
+
+	file.Close()
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	return syncDir(path)
+}
+
+// makes the creation, rename or removal of the file at path durable
+func syncDir(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,461 @@
+package btree
+
+import (
+	"container/list"
+	"encoding/binary"
+	"github.com/tPhume/gokv/store"
+	"math"
+	"os"
+	"sort"
+)
+
+// Buffer pool and page encoding of the disk btree
+// pages of the data file are loaded into a fixed number of frames, when a page that is not loaded is needed
+// the least recently used frame is evicted, and written back first if it was changed
+// a page is saved to the journal before it is written back (see journal.go)
+// | kind (1) | item count (2) | items | children (4 each, internal nodes only) |
+// an item is | key length (uvarint) | key | 0 (1) | value length (uvarint) | value |
+// or, for a value too large to fit in the node, | key length (uvarint) | key | 1 (1) | first page (4) | value length (4) |
+// the value is then split across a chain of overflow pages | kind (1) | next page (4) | length (2) | data |
+// a free page is | kind (1) | next free page (4) |
+// a value is its field count (uvarint) followed by every field and its value, as length (uvarint) and bytes
+
+const (
+	pageLeaf byte = iota + 1
+	pageInternal
+	pageOverflow
+	pageFree
+)
+
+const (
+	// kind and item count
+	nodeHeaderSize = 3
+	// kind, next page and length
+	overflowHeaderSize = 7
+	childSize          = 4
+)
+
+// a loaded page, node is its decoded node, encoded back into page when it is written
+type frame struct {
+	id    uint32
+	page  []byte
+	node  *diskNode
+	dirty bool
+	elem  *list.Element
+}
+
+type bufferPool struct {
+	file     *os.File
+	pageSize int
+	capacity int
+	frames   map[uint32]*frame
+	// front is the most recently used frame
+	lru *list.List
+	// number of pages of the file, including pages not written back yet
+	pages uint32
+	// first page of the free list, 0 if it is empty
+	free    uint32
+	journal *journal
+}
+
+func newBufferPool(file *os.File, journal *journal, capacity int) *bufferPool {
+	return &bufferPool{
+		file:     file,
+		pageSize: journal.pageSize,
+		capacity: capacity,
+		journal:  journal,
+		frames:   make(map[uint32]*frame),
+		lru:      list.New(),
+	}
+}
+
+// returns the frame of the page, reading it from the file if it is not loaded
+func (p *bufferPool) get(id uint32) (*frame, error) {
+	if f, ok := p.frames[id]; ok {
+		p.lru.MoveToFront(f.elem)
+		return f, nil
+	}
+
+	if id == 0 || id >= p.pages {
+		return nil, ErrCorruptedPage
+	}
+
+	page := make([]byte, p.pageSize)
+	if _, err := p.file.ReadAt(page, int64(id)*int64(p.pageSize)); err != nil {
+		return nil, err
+	}
+
+	f := &frame{id: id, page: page}
+	if err := p.add(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// returns the node held by the page
+func (p *bufferPool) node(id uint32) (*diskNode, error) {
+	f, err := p.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.node == nil {
+		if f.node, err = decodeNode(id, f.page); err != nil {
+			return nil, err
+		}
+	}
+
+	return f.node, nil
+}
+
+// marks the page of n as changed, loading n back if its frame was evicted meanwhile
+func (p *bufferPool) write(n *diskNode) error {
+	f, ok := p.frames[n.id]
+	if !ok {
+		f = &frame{id: n.id, page: make([]byte, p.pageSize)}
+		if err := p.add(f); err != nil {
+			return err
+		}
+	} else {
+		p.lru.MoveToFront(f.elem)
+	}
+
+	f.node = n
+	f.dirty = true
+
+	return nil
+}
+
+// replaces the bytes of a page that holds no node
+func (p *bufferPool) writePage(id uint32, page []byte) error {
+	f, ok := p.frames[id]
+	if !ok {
+		f = &frame{id: id}
+		if err := p.add(f); err != nil {
+			return err
+		}
+	} else {
+		p.lru.MoveToFront(f.elem)
+	}
+
+	f.page = page
+	f.node = nil
+	f.dirty = true
+
+	return nil
+}
+
+// returns a page for the caller to write, taken from the free list if possible
+func (p *bufferPool) allocate() (uint32, error) {
+	if p.free == 0 {
+		p.pages++
+		return p.pages - 1, nil
+	}
+
+	id := p.free
+	f, err := p.get(id)
+	if err != nil {
+		return 0, err
+	}
+
+	if f.page[0] != pageFree {
+		return 0, ErrCorruptedPage
+	}
+
+	p.free = binary.LittleEndian.Uint32(f.page[1:])
+
+	return id, nil
+}
+
+// puts the page on the free list
+func (p *bufferPool) release(id uint32) error {
+	page := make([]byte, p.pageSize)
+	page[0] = pageFree
+	binary.LittleEndian.PutUint32(page[1:], p.free)
+
+	if err := p.writePage(id, page); err != nil {
+		return err
+	}
+
+	p.free = id
+
+	return nil
+}
+
+// writes every changed page back to the file
+func (p *bufferPool) flush() error {
+	ids := make([]uint32, 0, len(p.frames))
+	for id, f := range p.frames {
+		if f.dirty {
+			ids = append(ids, id)
+		}
+	}
+
+	// in file order
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	// journaled together so the journal is synced once
+	for _, id := range ids {
+		if err := p.journal.save(p.file, id); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range ids {
+		if err := p.writeBack(p.frames[id]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// utility function that loads f, evicting least recently used frames to make room
+func (p *bufferPool) add(f *frame) error {
+	for len(p.frames) >= p.capacity {
+		victim := p.lru.Back().Value.(*frame)
+		if victim.dirty {
+			if err := p.writeBack(victim); err != nil {
+				return err
+			}
+		}
+
+		p.lru.Remove(victim.elem)
+		delete(p.frames, victim.id)
+	}
+
+	f.elem = p.lru.PushFront(f)
+	p.frames[f.id] = f
+
+	return nil
+}
+
+// the page that is overwritten reaches the journal first
+func (p *bufferPool) writeBack(f *frame) error {
+	if f.node != nil {
+		page, err := encodeNode(f.node, p.pageSize)
+		if err != nil {
+			return err
+		}
+
+		f.page = page
+	}
+
+	if err := p.journal.save(p.file, f.id); err != nil {
+		return err
+	}
+
+	if err := p.journal.sync(); err != nil {
+		return err
+	}
+
+	if _, err := p.file.WriteAt(f.page, int64(f.id)*int64(p.pageSize)); err != nil {
+		return err
+	}
+
+	f.dirty = false
+
+	return nil
+}
+
+// a node of the disk btree as it is held in a frame
+type diskNode struct {
+	id       uint32
+	leaf     bool
+	items    []diskItem
+	children []uint32
+}
+
+// key and encoded value, or the overflow pages holding the value
+type diskItem struct {
+	key   string
+	value []byte
+	// first overflow page, 0 if the value is inline
+	overflow uint32
+	length   uint32
+}
+
+// utility function that finds index of item greater than or equal to the key
+func (n *diskNode) findKey(key string) int {
+	return sort.Search(len(n.items), func(i int) bool {
+		return n.items[i].key >= key
+	})
+}
+
+// encoded size of the node
+func (n *diskNode) size() int {
+	size := nodeHeaderSize + childSize*len(n.children)
+	for _, it := range n.items {
+		size += it.size()
+	}
+
+	return size
+}
+
+// encoded size of the item
+func (it diskItem) size() int {
+	size := uvarintSize(uint64(len(it.key))) + len(it.key) + 1
+	if it.overflow != 0 {
+		return size + 8
+	}
+
+	return size + uvarintSize(uint64(len(it.value))) + len(it.value)
+}
+
+// returns ErrNodeTooLarge rather than a page cut short if n does not fit
+func encodeNode(n *diskNode, pageSize int) ([]byte, error) {
+	if n.size() > pageSize || len(n.items) > math.MaxUint16 {
+		return nil, ErrNodeTooLarge
+	}
+
+	page := make([]byte, nodeHeaderSize, pageSize)
+	page[0] = pageInternal
+	if n.leaf {
+		page[0] = pageLeaf
+	}
+	binary.LittleEndian.PutUint16(page[1:], uint16(len(n.items)))
+
+	for _, it := range n.items {
+		page = appendBytes(page, []byte(it.key))
+		if it.overflow != 0 {
+			page = append(page, 1)
+			page = appendUint32(page, it.overflow)
+			page = appendUint32(page, it.length)
+		} else {
+			page = append(page, 0)
+			page = appendBytes(page, it.value)
+		}
+	}
+
+	for _, child := range n.children {
+		page = appendUint32(page, child)
+	}
+
+	return page[:pageSize], nil
+}
+
+func decodeNode(id uint32, page []byte) (*diskNode, error) {
+	if page[0] != pageLeaf && page[0] != pageInternal {
+		return nil, ErrCorruptedPage
+	}
+
+	n := &diskNode{id: id, leaf: page[0] == pageLeaf}
+	count := int(binary.LittleEndian.Uint16(page[1:]))
+	buf := page[nodeHeaderSize:]
+
+	n.items = make([]diskItem, count)
+	for i := range n.items {
+		key, rest, ok := readBytes(buf)
+		if !ok || len(rest) == 0 {
+			return nil, ErrCorruptedPage
+		}
+
+		it := diskItem{key: string(key)}
+		if rest[0] == 1 {
+			if len(rest) < 9 {
+				return nil, ErrCorruptedPage
+			}
+
+			it.overflow = binary.LittleEndian.Uint32(rest[1:])
+			it.length = binary.LittleEndian.Uint32(rest[5:])
+			buf = rest[9:]
+		} else {
+			value, rest, ok := readBytes(rest[1:])
+			if !ok {
+				return nil, ErrCorruptedPage
+			}
+
+			it.value = append([]byte(nil), value...)
+			buf = rest
+		}
+
+		n.items[i] = it
+	}
+
+	if !n.leaf {
+		if len(buf) < childSize*(count+1) {
+			return nil, ErrCorruptedPage
+		}
+
+		n.children = make([]uint32, count+1)
+		for i := range n.children {
+			n.children[i] = binary.LittleEndian.Uint32(buf[childSize*i:])
+		}
+	}
+
+	return n, nil
+}
+
+func encodeValue(value store.Value) []byte {
+	fields := make([]string, 0, len(value))
+	for field := range value {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	buf := appendUvarint(nil, uint64(len(fields)))
+	for _, field := range fields {
+		buf = appendBytes(buf, []byte(field))
+		buf = appendBytes(buf, []byte(value[field]))
+	}
+
+	return buf
+}
+
+func decodeValue(buf []byte) (store.Value, error) {
+	count, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, ErrCorruptedPage
+	}
+	buf = buf[n:]
+
+	value := make(store.Value)
+	for i := uint64(0); i < count; i++ {
+		field, rest, ok := readBytes(buf)
+		if !ok {
+			return nil, ErrCorruptedPage
+		}
+
+		v, rest, ok := readBytes(rest)
+		if !ok {
+			return nil, ErrCorruptedPage
+		}
+
+		value[string(field)] = string(v)
+		buf = rest
+	}
+
+	return value, nil
+}
+
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = appendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func readBytes(buf []byte) ([]byte, []byte, bool) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < length {
+		return nil, nil, false
+	}
+
+	return buf[n : n+int(length)], buf[n+int(length):], true
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+func appendUint32(buf []byte, x uint32) []byte {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], x)
+	return append(buf, tmp[:]...)
+}
+
+func uvarintSize(x uint64) int {
+	var tmp [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(tmp[:], x)
+}
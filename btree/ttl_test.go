@@ -0,0 +1,132 @@
+package btree
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"testing"
+	"time"
+)
+
+func TestBtree_Expire(t *testing.T) {
+	tree := NewBtree(3)
+	past := time.Now().Add(-time.Second)
+	future := time.Now().Add(time.Hour)
+
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		at := future
+		if i%3 == 0 {
+			at = past
+		}
+
+		if err := tree.InsertExpire(key, store.Value{"val": key}, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// expired keys are missing to every read and write
+	if v := tree.Search("key00"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	if err := tree.Update("key03", store.Value{"val": "new"}); err != KeyDoesNotExist {
+		t.Fatalf("expected error = [KeyDoesNotExist], got = [%v]", err)
+	}
+
+	if err := tree.Remove("key06"); err != KeyDoesNotExist {
+		t.Fatalf("expected error = [KeyDoesNotExist], got = [%v]", err)
+	}
+
+	if v := tree.Search("key01"); v["val"] != "key01" {
+		t.Fatalf("expected [key01], got = [%v]", v)
+	}
+
+	count := 0
+	tree.Scan(store.ScanOptions{Limit: 5}, func(key string, value store.Value) bool {
+		if key == "key00" || key == "key03" {
+			t.Fatalf("expected expired key [%v] to be skipped", key)
+		}
+
+		count++
+		return true
+	})
+
+	if count != 5 {
+		t.Fatalf("expected [5] keys, got = [%v]", count)
+	}
+
+	// inserting without an expiry clears it
+	if err := tree.Insert("key09", store.Value{"val": "back"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := tree.Search("key09"); v["val"] != "back" {
+		t.Fatalf("expected [back], got = [%v]", v)
+	}
+
+	// key06 was already removed
+	if removed := len(tree.RemoveExpired(0)); removed != 8 {
+		t.Fatalf("expected [8] removed keys, got = [%v]", removed)
+	}
+
+	if removed := len(tree.RemoveExpired(0)); removed != 0 {
+		t.Fatalf("expected [0] removed keys, got = [%v]", removed)
+	}
+
+	count = 0
+	tree.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		count++
+		return true
+	})
+
+	if count != 21 {
+		t.Fatalf("expected [21] keys, got = [%v]", count)
+	}
+}
+
+func TestBtree_RemoveExpiredLimit(t *testing.T) {
+	tree := NewBtree(3)
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		if err := tree.InsertExpire(key, store.Value{"val": key}, now.Add(-time.Duration(10-i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 10; i < 20; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		if err := tree.InsertExpire(key, store.Value{"val": key}, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// writes without an expiry leave the index, removed keys too
+	tree.Insert("key10", store.Value{})
+	tree.Remove("key11")
+
+	if len(tree.expiries.heap) != 18 {
+		t.Fatalf("expected [18] keys in the expiry index, got = [%v]", len(tree.expiries.heap))
+	}
+
+	// keys come out in the order they expired
+	removed := tree.RemoveExpired(3)
+	if len(removed) != 3 {
+		t.Fatalf("expected [3] removed keys, got = [%v]", len(removed))
+	}
+
+	for i, e := range removed {
+		if key := fmt.Sprintf("key%02d", i); e.Key != key || e.Value["val"] != key {
+			t.Fatalf("expected [%v], got = [%+v]", key, e)
+		}
+	}
+
+	if removed := tree.RemoveExpired(0); len(removed) != 7 {
+		t.Fatalf("expected [7] removed keys, got = [%v]", len(removed))
+	}
+
+	if len(tree.expiries.heap) != 8 {
+		t.Fatalf("expected [8] keys in the expiry index, got = [%v]", len(tree.expiries.heap))
+	}
+}
@@ -0,0 +1,116 @@
+package btree
+
+import (
+	"github.com/tPhume/gokv/store"
+	"testing"
+	"time"
+)
+
+func TestBtree_Version(t *testing.T) {
+	tree := NewBtree(3)
+
+	tree.Insert("A", store.Value{"val": "A"})
+	tree.Insert("B", store.Value{"val": "B"})
+
+	_, first := tree.SearchVersion("A")
+	if first == 0 {
+		t.Fatal("expected a version")
+	}
+
+	if err := tree.Update("A", store.Value{"val": "new A"}); err != nil {
+		t.Fatal(err)
+	}
+
+	value, second := tree.SearchVersion("A")
+	if second <= first || value["val"] != "new A" {
+		t.Fatalf("expected [new A] after version [%v], got = [%v] at [%v]", first, value, second)
+	}
+
+	// a stale version does not apply
+	if err := tree.UpdateIf("A", store.Value{"val": "stale"}, first); err != store.ErrVersionMismatch {
+		t.Fatalf("expected error = [ErrVersionMismatch], got = [%v]", err)
+	}
+
+	if err := tree.RemoveIf("A", first); err != store.ErrVersionMismatch {
+		t.Fatalf("expected error = [ErrVersionMismatch], got = [%v]", err)
+	}
+
+	if err := tree.UpdateIf("A", store.Value{"val": "newer A"}, second); err != nil {
+		t.Fatal(err)
+	}
+
+	_, third := tree.SearchVersion("A")
+	if err := tree.RemoveIf("A", third); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tree.RemoveIf("A", third); err != KeyDoesNotExist {
+		t.Fatalf("expected error = [KeyDoesNotExist], got = [%v]", err)
+	}
+
+	// a key inserted again never gets an old version back
+	tree.Insert("A", store.Value{"val": "A"})
+	if _, fourth := tree.SearchVersion("A"); fourth <= third {
+		t.Fatalf("expected a version bigger than [%v], got = [%v]", third, fourth)
+	}
+
+	if value, version := tree.SearchVersion("C"); value != nil || version != 0 {
+		t.Fatalf("expected nil at [0], got = [%v] at [%v]", value, version)
+	}
+}
+
+func TestBtree_UpdateIfKeepsExpiry(t *testing.T) {
+	tree := NewBtree(3)
+	at := time.Now().Add(time.Hour)
+
+	tree.InsertExpire("A", store.Value{"val": "A"}, at)
+	_, version := tree.SearchVersion("A")
+
+	if err := tree.UpdateIf("A", store.Value{"val": "new A"}, version); err != nil {
+		t.Fatal(err)
+	}
+
+	if e, _ := tree.SearchEntry("A"); e.Value["val"] != "new A" || !e.Expires.Equal(at) {
+		t.Fatalf("expected [new A] expiring at [%v], got = [%+v]", at, e)
+	}
+}
+
+func TestBtree_Restore(t *testing.T) {
+	tree := NewBtree(3)
+	at := time.Now().Add(time.Hour)
+
+	tree.InsertExpire("A", store.Value{"val": "A"}, at)
+	tree.Insert("B", store.Value{"val": "B"})
+
+	entry, ok := tree.SearchEntry("A")
+	if !ok || !entry.Expires.Equal(at) || entry.Version == 0 {
+		t.Fatalf("expected [A] expiring at [%v], got = [%+v]", at, entry)
+	}
+
+	var entries []store.Entry
+	tree.ScanEntries(store.ScanOptions{}, func(e store.Entry) bool {
+		entries = append(entries, e)
+		return true
+	})
+
+	// a new tree holds the same keys with the same expiry and version
+	restored := NewBtree(3)
+	for _, e := range entries {
+		if err := restored.Restore(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, e := range entries {
+		got, ok := restored.SearchEntry(e.Key)
+		if !ok || !got.Expires.Equal(e.Expires) || got.Version != e.Version || got.Value["val"] != e.Value["val"] {
+			t.Fatalf("expected [%+v], got = [%+v]", e, got)
+		}
+	}
+
+	// versions handed out afterwards are bigger than every restored one
+	restored.Insert("C", store.Value{})
+	if _, version := restored.SearchVersion("C"); version <= entries[1].Version {
+		t.Fatalf("expected a version above [%v], got = [%v]", entries[1].Version, version)
+	}
+}
@@ -0,0 +1,499 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/wal"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Package contains change data capture, every key changed through a Store is appended to a Log as an Event
+// events are numbered in the order they happened and kept in a bounded in memory ring, and optionally on disk
+// so consumers can read them from the last sequence number they saw
+// on disk each event is a wal.Record whose key is the namespace and the key separated by a zero byte
+// in a sequence of files, the oldest of which are deleted to bound the space the events take
+
+var ErrCompacted = errors.New("cdc: changes after the requested sequence are no longer retained")
+
+// DefaultCapacity is the number of events kept in memory when none is given
+const DefaultCapacity = 4096
+
+// Op is the kind of change an event records
+type Op byte
+
+const (
+	OpInsert Op = iota + 1
+	OpUpdate
+	OpRemove
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpUpdate:
+		return "update"
+	case OpRemove:
+		return "remove"
+	default:
+		return "unknown"
+	}
+}
+
+// events are encoded in json with the op as its name
+func (op Op) MarshalText() ([]byte, error) {
+	return []byte(op.String()), nil
+}
+
+func (op *Op) UnmarshalText(text []byte) error {
+	for _, o := range []Op{OpInsert, OpUpdate, OpRemove} {
+		if string(text) == o.String() {
+			*op = o
+			return nil
+		}
+	}
+
+	return errors.New("cdc: unknown op " + string(text))
+}
+
+// Event is a single change, Value is the new value of the key and nil for OpRemove
+// Namespace is empty for the default namespace
+type Event struct {
+	Seq       uint64      `json:"seq"`
+	Namespace string      `json:"namespace,omitempty"`
+	Op        Op          `json:"op"`
+	Key       string      `json:"key"`
+	Value     store.Value `json:"value,omitempty"`
+}
+
+// Options configure the files of a Log
+type Options struct {
+	// how the files are synced
+	Log wal.Options
+	// bytes a file grows to before the next one is started
+	SegmentSize int64
+	// number of files kept, the oldest is deleted with its events once there are more, 0 keeps every file
+	Segments int
+}
+
+// DefaultOptions start a new file every 16MB and keep the last 8
+func DefaultOptions() Options {
+	return Options{Log: wal.DefaultOptions(), SegmentSize: 16 << 20, Segments: 8}
+}
+
+// Log is safe for concurrent use
+type Log struct {
+	mu sync.Mutex
+	// the last events appended, ring[start] is the oldest
+	ring  []Event
+	start int
+	count int
+	// sequence number of the last event, 0 if there is none
+	seq uint64
+	// closed and replaced on every append, so waiters wake up
+	appended chan struct{}
+	// directory of the files, empty if events are kept in memory only
+	dir  string
+	opts Options
+	// sequence number of the first event of every file in order, the last one is wal
+	segments []uint64
+	wal      *wal.Log
+	// first error writing to disk, nothing is written after it
+	err error
+	// held by the writes of the stores of every namespace, see Store
+	writes map[string]*sync.Mutex
+}
+
+// NewLog keeps the last capacity events in memory only, DefaultCapacity if capacity is not positive
+func NewLog(capacity int) *Log {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+
+	return &Log{
+		ring:     make([]Event, capacity),
+		appended: make(chan struct{}),
+	}
+}
+
+// OpenLog keeps events in files in the directory dir as well, the last capacity of them also in memory
+// each file is named after the sequence number of its first event, so a read only replays the files it needs
+// events already in the files are read back so sequence numbers carry on where they stopped
+func OpenLog(dir string, capacity int, opts Options) (*Log, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := NewLog(capacity)
+	l.dir, l.opts = dir, opts
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if filepath.Ext(name) != ".cdc" {
+			continue
+		}
+
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, ".cdc"), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		l.segments = append(l.segments, first)
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+
+	if len(l.segments) == 0 {
+		l.segments = []uint64{1}
+	}
+
+	// the last file is appended to, and its events fill the ring
+	first := l.segments[len(l.segments)-1]
+	w, err := wal.Open(segmentName(dir, first), opts.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	l.seq = first - 1
+	err = w.Replay(func(r wal.Record) error {
+		l.push(recordEvent(l.seq+1, r))
+		return nil
+	})
+
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	l.wal = w
+
+	return l, nil
+}
+
+// Append records a change and returns its event
+// if the log has files and writing to them fails the event is still kept in memory
+// and the error is returned by Err, by Close and by reads of events no longer in memory
+func (l *Log) Append(namespace string, op Op, key string, value store.Value) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := Event{Seq: l.seq + 1, Namespace: namespace, Op: op, Key: key, Value: value}
+	if l.wal != nil && l.err == nil {
+		l.err = l.wal.Append(eventRecord(e))
+		if l.err == nil && l.opts.SegmentSize > 0 && l.wal.Size() >= l.opts.SegmentSize {
+			l.err = l.rotate(e.Seq + 1)
+		}
+	}
+
+	l.push(e)
+
+	close(l.appended)
+	l.appended = make(chan struct{})
+
+	return e
+}
+
+// Last returns the sequence number of the last event, 0 if there is none
+func (l *Log) Last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.seq
+}
+
+// Err returns the error that stopped events from being written to disk, if any
+func (l *Log) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// Read returns up to max events, every one if max is not positive, following the event numbered after
+// ErrCompacted is returned if some of those events are no longer kept, start again from Last
+func (l *Log) Read(after uint64, max int) ([]Event, error) {
+	l.mu.Lock()
+	if after >= l.seq {
+		l.mu.Unlock()
+		return nil, nil
+	}
+
+	oldest := l.seq - uint64(l.count) + 1
+	if after+1 >= oldest {
+		events := l.readRing(after, max)
+		l.mu.Unlock()
+		return events, nil
+	}
+
+	if l.wal == nil || after+1 < l.segments[0] {
+		l.mu.Unlock()
+		return nil, ErrCompacted
+	}
+
+	if l.err != nil {
+		err := l.err
+		l.mu.Unlock()
+		return nil, err
+	}
+
+	segments := append([]uint64(nil), l.segments...)
+	l.mu.Unlock()
+
+	events, err := l.readFiles(segments, after, oldest, max)
+	if err != nil {
+		return nil, err
+	}
+
+	if max > 0 && len(events) >= max {
+		return events, nil
+	}
+
+	if max > 0 {
+		max -= len(events)
+	}
+
+	// the rest are in memory, or on disk again if the ring moved on meanwhile
+	more, err := l.Read(oldest-1, max)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(events, more...), nil
+}
+
+// Wait blocks until an event follows the event numbered after, or until ctx is done
+func (l *Log) Wait(ctx context.Context, after uint64) error {
+	for {
+		l.mu.Lock()
+		seq, appended := l.seq, l.appended
+		l.mu.Unlock()
+
+		if seq > after {
+			return nil
+		}
+
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close closes the file of the log, if any
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.wal == nil {
+		return nil
+	}
+
+	err := l.wal.Close()
+	if l.err != nil {
+		return l.err
+	}
+
+	return err
+}
+
+func (l *Log) push(e Event) {
+	end := (l.start + l.count) % len(l.ring)
+	l.ring[end] = e
+
+	if l.count < len(l.ring) {
+		l.count++
+	} else {
+		l.start = (l.start + 1) % len(l.ring)
+	}
+
+	l.seq = e.Seq
+}
+
+// the event numbered after+1 must be in the ring
+func (l *Log) readRing(after uint64, max int) []Event {
+	n := int(l.seq - after)
+	if max > 0 && n > max {
+		n = max
+	}
+
+	skip := l.count - int(l.seq-after)
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = l.ring[(l.start+skip+i)%len(l.ring)]
+	}
+
+	return events
+}
+
+// rotate closes the current file and starts the next one at first, then deletes the oldest files beyond opts.Segments
+// the caller holds the lock
+func (l *Log) rotate(first uint64) error {
+	if err := l.wal.Close(); err != nil {
+		return err
+	}
+
+	w, err := wal.Open(segmentName(l.dir, first), l.opts.Log)
+	if err != nil {
+		return err
+	}
+
+	l.wal = w
+	l.segments = append(l.segments, first)
+
+	for l.opts.Segments > 0 && len(l.segments) > l.opts.Segments {
+		if err := os.Remove(segmentName(l.dir, l.segments[0])); err != nil {
+			return err
+		}
+
+		l.segments = l.segments[1:]
+	}
+
+	return nil
+}
+
+// stops replaying a file early
+var errStop = errors.New("stop")
+
+// reads the events numbered after+1 up to before oldest from the files, starting with the one holding after+1
+// events before oldest were written to the files completely, so appends going on meanwhile do not matter
+func (l *Log) readFiles(segments []uint64, after uint64, oldest uint64, max int) ([]Event, error) {
+	i := sort.Search(len(segments), func(i int) bool { return segments[i] > after+1 }) - 1
+
+	var events []Event
+	for ; i < len(segments) && segments[i] < oldest; i++ {
+		seq := segments[i] - 1
+		err := wal.ReplayFile(segmentName(l.dir, segments[i]), func(r wal.Record) error {
+			seq++
+			if seq <= after {
+				return nil
+			}
+
+			if seq >= oldest || (max > 0 && len(events) >= max) {
+				return errStop
+			}
+
+			events = append(events, recordEvent(seq, r))
+			return nil
+		})
+
+		if err == errStop {
+			break
+		}
+
+		// deleted by a rotation since the read started
+		if os.IsNotExist(err) {
+			return nil, ErrCompacted
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+func segmentName(dir string, first uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d.cdc", first))
+}
+
+func eventRecord(e Event) wal.Record {
+	r := wal.Record{Key: e.Namespace + "\x00" + e.Key, Value: e.Value}
+	switch e.Op {
+	case OpInsert:
+		r.Op = wal.OpInsert
+	case OpUpdate:
+		r.Op = wal.OpUpdate
+	case OpRemove:
+		r.Op = wal.OpRemove
+	}
+
+	return r
+}
+
+func recordEvent(seq uint64, r wal.Record) Event {
+	e := Event{Seq: seq, Key: r.Key, Value: r.Value}
+
+	// namespaces cannot contain a zero byte, so the first one separates it from the key
+	if i := strings.IndexByte(r.Key, 0); i >= 0 {
+		e.Namespace, e.Key = r.Key[:i], r.Key[i+1:]
+	}
+
+	switch r.Op {
+	case wal.OpInsert:
+		e.Op = OpInsert
+	case wal.OpUpdate:
+		e.Op = OpUpdate
+	case wal.OpRemove:
+		e.Op = OpRemove
+	}
+
+	return e
+}
+
+// Store wraps a store.Store and appends an event to a Log for every key changed through it
+// keys removed once they expired are reported as removed
+// writes hold a lock the log keeps for the namespace, so events are in the order of the writes
+// even for several Stores of one namespace, a Store is safe for concurrent use if the store it wraps is
+type Store struct {
+	// reports the keys changed by every write
+	*store.WatchStore
+	log       *Log
+	namespace string
+}
+
+// NewStore appends the changes to s to log, under namespace, empty for the default namespace
+// several stores may share one log
+func NewStore(s store.Store, log *Log, namespace string) *Store {
+	c := &Store{log: log, namespace: namespace}
+	c.WatchStore = store.NewLockedWatchStore(s, c.change, log.writeLock(namespace))
+
+	return c
+}
+
+// Changes returns the log the changes are appended to
+func (c *Store) Changes() *Log {
+	return c.log
+}
+
+// utility function that returns the lock held by the writes of the stores of namespace
+func (l *Log) writeLock(namespace string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.writes == nil {
+		l.writes = make(map[string]*sync.Mutex)
+	}
+
+	mu, ok := l.writes[namespace]
+	if !ok {
+		mu = &sync.Mutex{}
+		l.writes[namespace] = mu
+	}
+
+	return mu
+}
+
+func (c *Store) change(key string, before store.Value, after store.Value) {
+	switch {
+	case before == nil:
+		c.log.Append(c.namespace, OpInsert, key, after)
+	case after == nil:
+		c.log.Append(c.namespace, OpRemove, key, nil)
+	default:
+		c.log.Append(c.namespace, OpUpdate, key, after)
+	}
+}
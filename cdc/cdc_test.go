@@ -0,0 +1,266 @@
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/wal"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// returns the events as "seq op namespace/key" strings
+func describe(events []Event) []string {
+	s := make([]string, len(events))
+	for i, e := range events {
+		s[i] = fmt.Sprintf("%d %v %v/%v", e.Seq, e.Op, e.Namespace, e.Key)
+	}
+
+	return s
+}
+
+func TestStore_Changes(t *testing.T) {
+	log := NewLog(16)
+	s := NewStore(btree.NewBtree(3), log, "")
+
+	s.Insert("A", store.Value{"n": "1"})
+	s.Update("A", store.Value{"n": "2"})
+	s.Remove("A")
+
+	// failed writes are not reported
+	s.Remove("A")
+	s.Update("B", store.Value{"n": "1"})
+
+	b := store.NewBatch()
+	b.Insert("B", store.Value{"n": "1"})
+	b.Insert("C", store.Value{"n": "1"})
+	b.Update("B", store.Value{"n": "2"})
+	s.ApplyBatch(b)
+
+	store.Increment(s, "C", "n", 1)
+	store.Patch(s, "C", store.Value{"m": "1"}, nil)
+
+	// another namespace shares the log
+	NewStore(btree.NewBtree(3), log, "other").Insert("A", store.Value{"n": "1"})
+
+	events, err := log.Read(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[1 insert /A 2 update /A 3 remove /A 4 insert /B 5 insert /C 6 update /C 7 update /C 8 insert other/A]"
+	if got := fmt.Sprint(describe(events)); got != expected {
+		t.Fatalf("expected %v, got = %v", expected, got)
+	}
+
+	if events[5].Value["n"] != "2" || events[6].Value["m"] != "1" || events[2].Value != nil {
+		t.Fatalf("unexpected values %v", events)
+	}
+
+	if log.Last() != 8 {
+		t.Fatalf("expected last 8, got = %v", log.Last())
+	}
+}
+
+func TestStore_Expired(t *testing.T) {
+	log := NewLog(16)
+	s := NewStore(btree.NewBtree(3), log, "")
+
+	s.InsertExpire("A", store.Value{"n": "1"}, time.Now().Add(10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	s.RemoveExpired(0)
+
+	events, err := log.Read(0, 0)
+	if err != nil || fmt.Sprint(describe(events)) != "[1 insert /A 2 remove /A]" {
+		t.Fatalf("expected the expired key removed, got = %v, %v", describe(events), err)
+	}
+}
+
+// stores of one namespace sharing a log report every write, in the order of the writes
+func TestStore_Concurrent(t *testing.T) {
+	log := NewLog(1000)
+	shared := store.NewSyncStore(btree.NewBtree(3))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := NewStore(shared, log, "")
+			for i := 0; i < 100; i++ {
+				store.Increment(s, "A", "n", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	events, err := log.Read(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, e := range events {
+		if e.Value["n"] != fmt.Sprint(i+1) {
+			t.Fatalf("event [%v], expected [%v], got = %v", e.Seq, i+1, e.Value)
+		}
+	}
+
+	if len(events) != 400 {
+		t.Fatalf("expected [400] events, got = [%v]", len(events))
+	}
+}
+
+func TestLog_Read(t *testing.T) {
+	log := NewLog(4)
+	for i := 0; i < 10; i++ {
+		log.Append("", OpInsert, fmt.Sprint(i), store.Value{})
+	}
+
+	events, err := log.Read(7, 0)
+	if err != nil || fmt.Sprint(describe(events)) != "[8 insert /7 9 insert /8 10 insert /9]" {
+		t.Fatalf("expected events 8 to 10, got = %v, %v", describe(events), err)
+	}
+
+	events, err = log.Read(6, 2)
+	if err != nil || len(events) != 2 || events[0].Seq != 7 {
+		t.Fatalf("expected events 7 and 8, got = %v, %v", describe(events), err)
+	}
+
+	if events, err := log.Read(10, 0); err != nil || len(events) != 0 {
+		t.Fatalf("expected no events, got = %v, %v", describe(events), err)
+	}
+
+	// events 1 to 6 left the ring
+	if _, err := log.Read(5, 0); err != ErrCompacted {
+		t.Fatalf("expected %v, got = %v", ErrCompacted, err)
+	}
+}
+
+func TestLog_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "gokv.cdc")
+	log, err := OpenLog(path, 4, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		log.Append("ns", OpUpdate, fmt.Sprint(i), store.Value{"i": fmt.Sprint(i)})
+	}
+
+	// events that left the ring are read from the file, the rest from memory
+	events, err := log.Read(2, 5)
+	if err != nil || fmt.Sprint(describe(events)) != "[3 update ns/2 4 update ns/3 5 update ns/4 6 update ns/5 7 update ns/6]" {
+		t.Fatalf("expected events 3 to 7, got = %v, %v", describe(events), err)
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// sequence numbers carry on after reopening
+	log, err = OpenLog(path, 4, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if log.Last() != 10 {
+		t.Fatalf("expected last 10, got = %v", log.Last())
+	}
+
+	if e := log.Append("", OpRemove, "0", nil); e.Seq != 11 {
+		t.Fatalf("expected seq 11, got = %v", e.Seq)
+	}
+
+	events, err = log.Read(0, 0)
+	if err != nil || len(events) != 11 || events[0].Value["i"] != "0" || events[10].Op != OpRemove {
+		t.Fatalf("expected every event, got = %v, %v", describe(events), err)
+	}
+}
+
+func TestLog_Segments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// every event gets its own file, and the files of events 8 to 10 and the empty next one are kept
+	opts := Options{Log: wal.Options{Sync: wal.SyncNever}, SegmentSize: 1, Segments: 4}
+	log, err := OpenLog(dir, 1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		log.Append("", OpInsert, fmt.Sprint(i), store.Value{})
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.cdc")); len(files) != 4 {
+		t.Fatalf("expected 4 files, got = %v", files)
+	}
+
+	if _, err := log.Read(6, 0); err != ErrCompacted {
+		t.Fatalf("expected %v, got = %v", ErrCompacted, err)
+	}
+
+	events, err := log.Read(7, 0)
+	if err != nil || fmt.Sprint(describe(events)) != "[8 insert /7 9 insert /8 10 insert /9]" {
+		t.Fatalf("expected events 8 to 10, got = %v, %v", describe(events), err)
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err = OpenLog(dir, 1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if e := log.Append("", OpRemove, "0", nil); e.Seq != 11 {
+		t.Fatalf("expected seq 11, got = %v", e.Seq)
+	}
+
+	events, err = log.Read(8, 0)
+	if err != nil || fmt.Sprint(describe(events)) != "[9 insert /8 10 insert /9 11 remove /0]" {
+		t.Fatalf("expected events 9 to 11, got = %v, %v", describe(events), err)
+	}
+}
+
+func TestLog_Wait(t *testing.T) {
+	log := NewLog(4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := log.Wait(ctx, 0); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got = %v", context.DeadlineExceeded, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		log.Append("", OpInsert, "A", store.Value{})
+	}()
+
+	if err := log.Wait(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// returns at once if the event is already there
+	if err := log.Wait(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+}
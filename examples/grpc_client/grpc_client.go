@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/tPhume/gokv/kv"
 	"google.golang.org/grpc"
+	"io"
 	"log"
 )
 
@@ -41,4 +42,23 @@ func main() {
 	} else {
 		log.Println(response)
 	}
+
+	// scan every key starting with "Te"
+	stream, err := client.Scan(context.Background(), &kv.ScanRequest{Prefix: "Te"})
+	if err != nil {
+		log.Fatalf("scan failed, %s", err)
+	}
+
+	for {
+		pair, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			log.Fatalf("scan failed, %s", err)
+		}
+
+		log.Println(pair)
+	}
 }
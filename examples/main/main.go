@@ -1,29 +1,247 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/cdc"
+	"github.com/tPhume/gokv/index"
 	"github.com/tPhume/gokv/kv"
+	"github.com/tPhume/gokv/namespace"
+	"github.com/tPhume/gokv/snapshot"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/wal"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// share wraps s, the stack of stores built over base, so both servers can use it from many goroutines
+// the stack applies and numbers writes one at a time, but reads of a base safe for concurrent use need no lock
+func share(s store.Store, base store.Store) store.Store {
+	if _, ok := base.(store.Concurrent); ok {
+		return store.NewWriteSyncStore(s)
+	}
+
+	return store.NewSyncStore(s)
+}
+
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run returns on an interrupt or once a server stops, after its deferred calls closed
+// the write-ahead log and data files, which log.Fatal would skip
+func run() error {
 	restAddr := "0.0.0.0:8888"
 	grpcAddr := "0.0.0.0:9999"
 
-	store := btree.NewBtree(3)
+	walPath := flag.String("wal", "gokv.wal", "path of the write-ahead log, empty keeps data in memory only")
+	fsync := flag.String("fsync", "always", "when the write-ahead log is synced to disk: always, interval or never")
+	fsyncInterval := flag.Duration("fsync-interval", time.Second, "sync interval used with -fsync=interval")
+	walCompact := flag.Int64("wal-compact-size", wal.DefaultOptions().CompactSize, "bytes the write-ahead log grows to before it is compacted, 0 never compacts it")
+	sweepInterval := flag.Duration("sweep-interval", time.Second, "how often expired keys are removed")
+	indexFields := flag.String("index", "", "comma separated value fields to keep secondary indexes on")
+	changesPath := flag.String("changes", "", "directory of the files changes are also kept in, empty keeps them in memory only")
+	changesCapacity := flag.Int("changes-capacity", cdc.DefaultCapacity, "number of recent changes kept in memory")
+	changesSegmentSize := flag.Int64("changes-segment-size", cdc.DefaultOptions().SegmentSize, "bytes a file of -changes grows to before the next one is started")
+	changesSegments := flag.Int("changes-segments", cdc.DefaultOptions().Segments, "number of files of -changes kept, 0 keeps every change")
+	diskPath := flag.String("disk", "", "path of a data file keeping the btree on disk, empty keeps it in memory")
+	diskCache := flag.Int("disk-cache", btree.DefaultDiskOptions().CacheSize, "number of pages of -disk cached in memory")
+	restorePath := flag.String("restore", "", "path of a snapshot replacing the contents of the store at startup")
+	adminAddr := flag.String("admin", "127.0.0.1:8890", "address of the admin server serving snapshots, empty disables it")
+	engineName := flag.String("engine", "btree", "in memory storage engine of every namespace: "+strings.Join(kv.EngineNames(), ", "))
+	flag.Parse()
+
+	opts := wal.Options{Interval: *fsyncInterval, CompactSize: *walCompact}
+	switch *fsync {
+	case "always":
+		opts.Sync = wal.SyncAlways
+	case "interval":
+		opts.Sync = wal.SyncInterval
+	case "never":
+		opts.Sync = wal.SyncNever
+	default:
+		return fmt.Errorf("unknown fsync policy %s", *fsync)
+	}
 
-	restServer := kv.RestWithStore(store)
-	grpcServer := kv.GrpcWithStore(store)
+	engine, err := kv.LookupEngine(*engineName)
+	if err != nil {
+		return fmt.Errorf("%s %s", err, *engineName)
+	}
 
-	go func() {
-		log.Fatal(restServer.Run(restAddr))
-	}()
+	kvStore := engine()
+
+	if *diskPath != "" {
+		if *engineName != "btree" {
+			return fmt.Errorf("-disk keeps a btree, it cannot be used with engine %s", *engineName)
+		}
+
+		diskOpts := btree.DefaultDiskOptions()
+		diskOpts.CacheSize = *diskCache
+
+		tree, err := btree.OpenDiskBtree(*diskPath, diskOpts)
+		if err != nil {
+			return fmt.Errorf("could not open data file %s", err)
+		}
+		defer tree.Close()
+
+		kvStore = tree
+	}
+
+	// the engine under the wrappers below, which decides what share locks
+	base := kvStore
+
+	if *walPath != "" {
+		walStore, err := wal.OpenStore(*walPath, kvStore, opts)
+		if err != nil {
+			return fmt.Errorf("could not open write-ahead log %s", err)
+		}
+		defer walStore.Close()
+
+		kvStore = walStore
+	}
+
+	if *restorePath != "" {
+		tree, err := snapshot.Load(*restorePath)
+		if err != nil {
+			return fmt.Errorf("could not load snapshot %s", err)
+		}
+
+		// through the write-ahead log or into the data file, so the restored pairs survive a restart
+		// and into the store of the engine unless it is a btree already
+		if *walPath == "" && *diskPath == "" && *engineName == "btree" {
+			kvStore, base = tree, tree
+		} else if err := snapshot.Replace(kvStore, tree); err != nil {
+			return fmt.Errorf("could not restore snapshot %s", err)
+		}
+	}
+
+	if *indexFields != "" {
+		indexed, err := index.NewStore(kvStore, strings.Split(*indexFields, ",")...)
+		if err != nil {
+			return fmt.Errorf("could not build indexes %s", err)
+		}
+
+		kvStore = indexed
+	}
+
+	changes := cdc.NewLog(*changesCapacity)
+	if *changesPath != "" {
+		changesOpts := cdc.Options{Log: opts, SegmentSize: *changesSegmentSize, Segments: *changesSegments}
+		if changes, err = cdc.OpenLog(*changesPath, *changesCapacity, changesOpts); err != nil {
+			return fmt.Errorf("could not open changes %s", err)
+		}
+		defer changes.Close()
+	}
+
+	// both servers share the store from many goroutines, and it appends its changes itself
+	// so the servers do not wrap it again and the keys the sweeper removes are in the changes too
+	kvStore = cdc.NewStore(share(kvStore, base), changes, "")
+
+	stopSweeper := store.StartSweeper(kvStore, *sweepInterval)
+	defer stopSweeper()
+
+	// namespaces get the same stack as the default store, with their logs next to its log
+	// and their names kept there too so they are opened again after a restart
+	nsStores := &namespaceStores{
+		engine:        engine,
+		changes:       changes,
+		opts:          opts,
+		sweepInterval: *sweepInterval,
+		closers:       make(map[string]func() error),
+	}
+	if *indexFields != "" {
+		nsStores.fields = strings.Split(*indexFields, ",")
+	}
+	defer nsStores.Close()
+
+	registryPath := ""
+	if *walPath != "" {
+		nsStores.dir = *walPath + ".ns"
+		if err := os.MkdirAll(nsStores.dir, 0755); err != nil {
+			return fmt.Errorf("could not create namespace directory %s", err)
+		}
+
+		registryPath = filepath.Join(nsStores.dir, "namespaces")
+	}
+
+	namespaces, err := namespace.OpenRegistry(registryPath, nsStores.create, nsStores.drop)
+	if err != nil {
+		return fmt.Errorf("could not open namespaces %s", err)
+	}
+
+	if nsStores.dir != "" {
+		if err := nsStores.removeOrphans(namespaces.List()); err != nil {
+			return fmt.Errorf("could not remove logs of dropped namespaces %s", err)
+		}
+	}
+
+	config := kv.Config{Store: kvStore, Namespaces: namespaces, Changes: changes}
+	restServer := kv.RestWithConfig(config)
+	grpcServer := kv.GrpcWithConfig(config)
 
 	lis, err := net.Listen("tcp", grpcAddr)
 	if err != nil {
-		log.Fatalf("could not listen on port %s", err)
+		return fmt.Errorf("could not listen on port %s", err)
+	}
+
+	httpServer := &http.Server{Addr: restAddr, Handler: restServer}
+	stopped := make(chan error, 3)
+
+	go func() {
+		stopped <- httpServer.ListenAndServe()
+	}()
+
+	// snapshots replace or read out a whole store, so they are kept off the addresses clients reach
+	var adminServer *http.Server
+	if *adminAddr != "" {
+		adminServer = &http.Server{Addr: *adminAddr, Handler: kv.AdminWithConfig(config)}
+		go func() {
+			stopped <- adminServer.ListenAndServe()
+		}()
+	}
+
+	go func() {
+		stopped <- grpcServer.Serve(lis)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-stopped:
+	case sig := <-signals:
+		log.Printf("shutting down on %s", sig)
+	}
+
+	// watch streams never end on their own, so both servers are given a moment then stopped
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if shutdownErr := httpServer.Shutdown(ctx); shutdownErr != nil {
+		httpServer.Close()
+	}
+
+	if adminServer != nil {
+		if shutdownErr := adminServer.Shutdown(ctx); shutdownErr != nil {
+			adminServer.Close()
+		}
+	}
+	grpcServer.Stop()
+
+	if err == http.ErrServerClosed {
+		return nil
 	}
 
-	log.Fatal(grpcServer.Serve(lis))
+	return err
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/tPhume/gokv/cdc"
+	"github.com/tPhume/gokv/index"
+	"github.com/tPhume/gokv/kv"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/wal"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// namespaceStores builds the store of every namespace like the default one: a write-ahead log in dir,
+// the same indexes, changes and sweeper, and closes and deletes them once the namespace is dropped
+type namespaceStores struct {
+	mu      sync.Mutex
+	engine  kv.Engine
+	changes *cdc.Log
+	// empty keeps namespaces in memory only
+	dir           string
+	opts          wal.Options
+	fields        []string
+	sweepInterval time.Duration
+	// stops the sweeper and closes the log of every open namespace
+	closers map[string]func() error
+}
+
+func (n *namespaceStores) logPath(name string) string {
+	return filepath.Join(n.dir, name+".wal")
+}
+
+// create is the namespace.Factory, the log of name is replayed if the namespace existed before a restart
+func (n *namespaceStores) create(name string) (store.Store, error) {
+	base := n.engine()
+	s := base
+	closeLog := func() error { return nil }
+
+	if n.dir != "" {
+		walStore, err := wal.OpenStore(n.logPath(name), s, n.opts)
+		if err != nil {
+			return nil, err
+		}
+
+		s, closeLog = walStore, walStore.Close
+	}
+
+	if len(n.fields) > 0 {
+		indexed, err := index.NewStore(s, n.fields...)
+		if err != nil {
+			closeLog()
+			return nil, err
+		}
+
+		s = indexed
+	}
+
+	s = cdc.NewStore(share(s, base), n.changes, name)
+	stopSweeper := store.StartSweeper(s, n.sweepInterval)
+
+	n.mu.Lock()
+	n.closers[name] = func() error {
+		stopSweeper()
+		return closeLog()
+	}
+	n.mu.Unlock()
+
+	return s, nil
+}
+
+// drop closes the store of a dropped namespace and deletes its log
+func (n *namespaceStores) drop(name string) error {
+	n.mu.Lock()
+	closer := n.closers[name]
+	delete(n.closers, name)
+	n.mu.Unlock()
+
+	if closer != nil {
+		if err := closer(); err != nil {
+			return err
+		}
+	}
+
+	if n.dir == "" {
+		return nil
+	}
+
+	if err := os.Remove(n.logPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// removeOrphans deletes the logs of namespaces that are not in names, left by a crash
+// while a namespace was being dropped, so a namespace created again with that name starts empty
+func (n *namespaceStores) removeOrphans(names []string) error {
+	live := make(map[string]bool, len(names))
+	for _, name := range names {
+		live[n.logPath(name)] = true
+	}
+
+	entries, err := ioutil.ReadDir(n.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(n.dir, entry.Name())
+		if !strings.HasSuffix(path, ".wal") || live[path] {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the store of every namespace still open
+func (n *namespaceStores) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var first error
+	for name, closer := range n.closers {
+		if err := closer(); err != nil && first == nil {
+			first = err
+		}
+		delete(n.closers, name)
+	}
+
+	return first
+}
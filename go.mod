@@ -14,7 +14,7 @@ require (
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/net v0.0.0-20200202094626-16171245cfb2 // indirect
 	golang.org/x/sys v0.0.0-20200202164722-d101bd2416d5 // indirect
-	google.golang.org/genproto v0.0.0-20200203223152-ff9e8190c2f5 // indirect
+	google.golang.org/genproto v0.0.0-20200203223152-ff9e8190c2f5
 	google.golang.org/grpc v1.27.0
 	gopkg.in/go-playground/validator.v9 v9.31.0 // indirect
 	gopkg.in/yaml.v2 v2.2.8 // indirect
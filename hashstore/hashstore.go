@@ -0,0 +1,251 @@
+package hashstore
+
+import (
+	"github.com/tPhume/gokv/store"
+	"sort"
+	"sync"
+)
+
+// Package contains a sharded hash map implementation of store.Store for keys that are only accessed by exact match
+// a key is hashed to one of N shards, each shard is a map with its own lock, so writes to different shards never wait
+// on each other and a lookup costs a hash instead of O(log n) string comparisons
+// scans are supported but slow: every shard is searched for keys in range, then the keys are sorted
+
+const (
+	DefaultShards = 32
+)
+
+var (
+	KeyDoesNotExist = store.KeyDoesNotExist
+)
+
+type shard struct {
+	mu sync.RWMutex
+	// values are never changed once stored, they are copied in and out
+	items map[string]store.Value
+}
+
+// HashStore is safe for concurrent use
+type HashStore struct {
+	shards []*shard
+}
+
+// NewHashStore returns an empty store of the given number of shards, DefaultShards if it is below 1
+func NewHashStore(shards int) *HashStore {
+	if shards < 1 {
+		shards = DefaultShards
+	}
+
+	h := &HashStore{shards: make([]*shard, shards)}
+	for i := range h.shards {
+		h.shards[i] = &shard{items: make(map[string]store.Value)}
+	}
+
+	return h
+}
+
+// Concurrent marks the store as safe for concurrent use, see store.Concurrent
+func (h *HashStore) Concurrent() {}
+
+// utility function that picks the shard of key by its 32 bit FNV-1a hash
+func (h *HashStore) shard(key string) *shard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+
+	return h.shards[hash%uint32(len(h.shards))]
+}
+
+// inserting an existing key replaces its value
+func (h *HashStore) Insert(key string, value store.Value) error {
+	s := h.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[key] = store.CopyValue(value)
+
+	return nil
+}
+
+func (h *HashStore) Update(key string, value store.Value) error {
+	s := h.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; !ok {
+		return KeyDoesNotExist
+	}
+
+	s.items[key] = store.CopyValue(value)
+
+	return nil
+}
+
+func (h *HashStore) Search(key string) store.Value {
+	s := h.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return store.CopyValue(s.items[key])
+}
+
+func (h *HashStore) Remove(key string) error {
+	s := h.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; !ok {
+		return KeyDoesNotExist
+	}
+
+	delete(s.items, key)
+
+	return nil
+}
+
+// Scan locks one shard at a time, so it is not a point-in-time view (see ScanConsistent)
+func (h *HashStore) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	var pairs []pair
+	for _, s := range h.shards {
+		s.mu.RLock()
+		pairs = s.collect(opts, pairs)
+		s.mu.RUnlock()
+	}
+
+	visit(pairs, opts, fn)
+
+	return nil
+}
+
+// ScanConsistent holds the read lock of every shard while the keys in range are collected
+func (h *HashStore) ScanConsistent(opts store.ScanOptions, fn store.ScanFunc) error {
+	h.rlockAll()
+	var pairs []pair
+	for _, s := range h.shards {
+		pairs = s.collect(opts, pairs)
+	}
+	h.runlockAll()
+
+	visit(pairs, opts, fn)
+
+	return nil
+}
+
+// ApplyBatch locks every shard for the whole batch, so no reader sees it half applied
+func (h *HashStore) ApplyBatch(b *store.Batch) error {
+	h.lockAll()
+	defer h.unlockAll()
+
+	return b.Apply(locked{h})
+}
+
+// shards are always locked in the same order, so a batch and a consistent scan cannot deadlock
+func (h *HashStore) lockAll() {
+	for _, s := range h.shards {
+		s.mu.Lock()
+	}
+}
+
+func (h *HashStore) unlockAll() {
+	for _, s := range h.shards {
+		s.mu.Unlock()
+	}
+}
+
+func (h *HashStore) rlockAll() {
+	for _, s := range h.shards {
+		s.mu.RLock()
+	}
+}
+
+func (h *HashStore) runlockAll() {
+	for _, s := range h.shards {
+		s.mu.RUnlock()
+	}
+}
+
+type pair struct {
+	key   string
+	value store.Value
+}
+
+// appends the pairs of the shard in the range of opts, the caller must hold the lock
+func (s *shard) collect(opts store.ScanOptions, pairs []pair) []pair {
+	for key, value := range s.items {
+		if opts.InRange(key) {
+			pairs = append(pairs, pair{key: key, value: value})
+		}
+	}
+
+	return pairs
+}
+
+// utility function that sorts the collected pairs and calls fn for each of them in the order of opts
+func visit(pairs []pair, opts store.ScanOptions, fn store.ScanFunc) {
+	sort.Slice(pairs, func(i, j int) bool {
+		if opts.Reverse {
+			return pairs[i].key > pairs[j].key
+		}
+
+		return pairs[i].key < pairs[j].key
+	})
+
+	if opts.Limit > 0 && len(pairs) > opts.Limit {
+		pairs = pairs[:opts.Limit]
+	}
+
+	for _, p := range pairs {
+		if !fn(p.key, store.CopyValue(p.value)) {
+			return
+		}
+	}
+}
+
+// locked gives batches access to the shards while ApplyBatch holds every lock
+type locked struct {
+	h *HashStore
+}
+
+func (l locked) Insert(key string, value store.Value) error {
+	l.h.shard(key).items[key] = store.CopyValue(value)
+	return nil
+}
+
+func (l locked) Update(key string, value store.Value) error {
+	s := l.h.shard(key)
+	if _, ok := s.items[key]; !ok {
+		return KeyDoesNotExist
+	}
+
+	s.items[key] = store.CopyValue(value)
+
+	return nil
+}
+
+func (l locked) Search(key string) store.Value {
+	return store.CopyValue(l.h.shard(key).items[key])
+}
+
+func (l locked) Remove(key string) error {
+	s := l.h.shard(key)
+	if _, ok := s.items[key]; !ok {
+		return KeyDoesNotExist
+	}
+
+	delete(s.items, key)
+
+	return nil
+}
+
+func (l locked) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	var pairs []pair
+	for _, s := range l.h.shards {
+		pairs = s.collect(opts, pairs)
+	}
+
+	visit(pairs, opts, fn)
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package hashstore
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/store/storetest"
+	"sync"
+	"testing"
+)
+
+func TestHashStore_Random(t *testing.T) {
+	storetest.Random(t, NewHashStore(8), nil, nil)
+}
+
+// keys are spread over every shard
+func TestHashStore_Shards(t *testing.T) {
+	h := NewHashStore(8)
+	for i := 0; i < 500; i++ {
+		h.Insert(fmt.Sprintf("key%04d", i), store.Value{})
+	}
+
+	for i, s := range h.shards {
+		if len(s.items) == 0 {
+			t.Fatalf("shard [%v] is empty", i)
+		}
+	}
+}
+
+func TestHashStore_Scan(t *testing.T) {
+	storetest.Scan(t, NewHashStore(0))
+}
+
+func TestHashStore_CopiesValues(t *testing.T) {
+	storetest.CopiesValues(t, NewHashStore(4))
+}
+
+func TestHashStore_ApplyBatch(t *testing.T) {
+	storetest.ApplyBatch(t, NewHashStore(4))
+}
+
+func TestHashStore_Concurrent(t *testing.T) {
+	storetest.Concurrent(t, NewHashStore(16))
+}
+
+// every batch moves one unit between two keys, a consistent scan always sees 100 units
+// run with -race
+func TestHashStore_ScanConsistent(t *testing.T) {
+	h := NewHashStore(16)
+	h.Insert("a", store.Value{"units": "100"})
+	h.Insert("b", store.Value{"units": "0"})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				h.Insert(fmt.Sprintf("writer%v-%v", w, i%50), store.Value{"i": fmt.Sprint(i)})
+
+				b := store.NewBatch()
+				b.Update("a", store.Value{"units": fmt.Sprint(100 - i%101)})
+				b.Update("b", store.Value{"units": fmt.Sprint(i % 101)})
+				store.ApplyBatch(h, b)
+			}
+		}(w)
+	}
+
+	for i := 0; i < 200; i++ {
+		units := 0
+		h.ScanConsistent(store.ScanOptions{End: "c"}, func(key string, value store.Value) bool {
+			var n int
+			fmt.Sscan(value["units"], &n)
+			units += n
+			return true
+		})
+
+		if units != 100 {
+			t.Fatalf("expected 100 units, got = %v", units)
+		}
+	}
+
+	wg.Wait()
+}
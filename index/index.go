@@ -0,0 +1,139 @@
+package index
+
+import (
+	"github.com/tPhume/gokv/store"
+	"sort"
+)
+
+// Package contains secondary indexes on the fields of store.Value
+// Store wraps any store.Store and keeps, for every declared field, the keys holding each value of that field
+// so store.Query finds keys by field value without scanning the whole store
+
+// Store wraps a store.Store and maintains its secondary indexes on every write
+type Store struct {
+	// reports the keys changed by every write
+	*store.WatchStore
+	store store.Store
+	// field -> field value -> keys
+	indexes map[string]map[string]map[string]struct{}
+	// indexed fields of every key as they were last indexed
+	entries map[string]store.Value
+}
+
+// NewStore indexes fields of every key already in s and returns s wrapped by the indexes
+func NewStore(s store.Store, fields ...string) (*Store, error) {
+	i := &Store{
+		store:   s,
+		indexes: make(map[string]map[string]map[string]struct{}),
+		entries: make(map[string]store.Value),
+	}
+	i.WatchStore = store.NewWatchStore(s, i.reindex)
+
+	for _, field := range fields {
+		i.indexes[field] = make(map[string]map[string]struct{})
+	}
+
+	err := s.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		i.index(key, value)
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// Fields returns the indexed fields in order
+func (i *Store) Fields() []string {
+	fields := make([]string, 0, len(i.indexes))
+	for field := range i.indexes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// Query looks the keys up in the index of field, ErrNotIndexed is returned if there is none
+// keys that expired but were not removed yet are skipped
+func (i *Store) Query(field string, value string, opts store.ScanOptions, fn store.ScanFunc) error {
+	index, ok := i.indexes[field]
+	if !ok {
+		return store.ErrNotIndexed
+	}
+
+	keys := make([]string, 0, len(index[value]))
+	for key := range index[value] {
+		if opts.InRange(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	if opts.Reverse {
+		for l, r := 0, len(keys)-1; l < r; l, r = l+1, r-1 {
+			keys[l], keys[r] = keys[r], keys[l]
+		}
+	}
+
+	count := 0
+	for _, key := range keys {
+		if opts.Limit > 0 && count >= opts.Limit {
+			return nil
+		}
+
+		v := i.store.Search(key)
+		if v == nil {
+			continue
+		}
+
+		count++
+		if !fn(key, v) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// indexes key again from its new value
+func (i *Store) reindex(key string, before store.Value, after store.Value) {
+	i.unindex(key)
+	i.index(key, after)
+}
+
+func (i *Store) index(key string, value store.Value) {
+	entry := make(store.Value)
+	for field, index := range i.indexes {
+		v, ok := value[field]
+		if !ok {
+			continue
+		}
+
+		if index[v] == nil {
+			index[v] = make(map[string]struct{})
+		}
+
+		index[v][key] = struct{}{}
+		entry[field] = v
+	}
+
+	if len(entry) != 0 {
+		i.entries[key] = entry
+	}
+}
+
+func (i *Store) unindex(key string) {
+	for field, v := range i.entries[key] {
+		index := i.indexes[field]
+
+		delete(index[v], key)
+		if len(index[v]) == 0 {
+			delete(index, v)
+		}
+	}
+
+	delete(i.entries, key)
+}
@@ -0,0 +1,102 @@
+package index
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"testing"
+	"time"
+)
+
+// returns the keys of the query in order
+func query(t *testing.T, s store.Store, field, value string, opts store.ScanOptions) []string {
+	var keys []string
+	err := store.Query(s, field, value, opts, func(key string, value store.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func TestStore_Query(t *testing.T) {
+	tree := btree.NewBtree(3)
+	tree.Insert("user:0", store.Value{"email": "a@gokv", "city": "BKK"})
+
+	// keys already in the store are indexed
+	s, err := NewStore(tree, "email", "city")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < 10; i++ {
+		city := "BKK"
+		if i%2 == 0 {
+			city = "CNX"
+		}
+
+		s.Insert(fmt.Sprintf("user:%d", i), store.Value{"email": fmt.Sprintf("%d@gokv", i), "city": city})
+	}
+
+	if keys := query(t, s, "email", "a@gokv", store.ScanOptions{}); fmt.Sprint(keys) != "[user:0]" {
+		t.Fatalf("expected [user:0], got = %v", keys)
+	}
+
+	if keys := query(t, s, "city", "CNX", store.ScanOptions{}); fmt.Sprint(keys) != "[user:2 user:4 user:6 user:8]" {
+		t.Fatalf("expected [user:2 user:4 user:6 user:8], got = %v", keys)
+	}
+
+	if keys := query(t, s, "city", "CNX", store.ScanOptions{Start: "user:3", Limit: 2, Reverse: true}); len(keys) != 2 || keys[0] != "user:8" {
+		t.Fatalf("expected [user:8 user:6], got = %v", keys)
+	}
+
+	// every kind of write keeps the indexes up to date
+	s.Update("user:2", store.Value{"email": "2@gokv", "city": "BKK"})
+	s.Remove("user:4")
+	store.Patch(s, "user:6", nil, []string{"city"})
+
+	b := store.NewBatch()
+	b.Insert("user:10", store.Value{"city": "CNX"})
+	b.Update("user:8", store.Value{"city": "HKT"})
+	store.ApplyBatch(s, b)
+
+	if keys := query(t, s, "city", "CNX", store.ScanOptions{}); fmt.Sprint(keys) != "[user:10]" {
+		t.Fatalf("expected [user:10], got = %v", keys)
+	}
+
+	if keys := query(t, s, "city", "HKT", store.ScanOptions{}); fmt.Sprint(keys) != "[user:8]" {
+		t.Fatalf("expected [user:8], got = %v", keys)
+	}
+
+	if err := store.Query(s, "name", "A", store.ScanOptions{}, nil); err != store.ErrNotIndexed {
+		t.Fatalf("expected error = [ErrNotIndexed], got = [%v]", err)
+	}
+}
+
+func TestStore_Expire(t *testing.T) {
+	s, err := NewStore(btree.NewBtree(3), "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.InsertTTL(s, "session:0", store.Value{"email": "a@gokv"}, 10*time.Millisecond)
+	s.Insert("session:1", store.Value{"email": "a@gokv"})
+
+	time.Sleep(20 * time.Millisecond)
+
+	if keys := query(t, s, "email", "a@gokv", store.ScanOptions{}); fmt.Sprint(keys) != "[session:1]" {
+		t.Fatalf("expected [session:1], got = %v", keys)
+	}
+
+	if removed := len(s.RemoveExpired(0)); removed != 1 {
+		t.Fatalf("expected [1] removed key, got = [%v]", removed)
+	}
+
+	if _, ok := s.entries["session:0"]; ok {
+		t.Fatal("expected the expired key to be dropped from the index")
+	}
+}
@@ -0,0 +1,84 @@
+package kv
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/tPhume/gokv/snapshot"
+	"github.com/tPhume/gokv/store"
+	"net/http"
+)
+
+// AdminWithConfig returns a server for the operations that replace or read out a whole store, to serve on
+// a listener of its own that clients of the store cannot reach, pass it the Config of the REST and gRPC servers
+// * GET /admin/v1/snapshot downloads a snapshot of the default namespace, POST restores one
+// * /admin/v1/ns/:namespace/snapshot does the same for a namespace
+func AdminWithConfig(config Config) *gin.Engine {
+	kvHandlers := &KeyValueHandlers{store: reportChanges(config.Store, config.Changes, ""), namespaces: config.namespaces(), changes: config.Changes}
+	router := gin.Default()
+
+	adminGroupV1 := router.Group("/admin/v1")
+	adminGroupV1.GET("/snapshot", kvHandlers.snapshot)
+	adminGroupV1.POST("/snapshot", kvHandlers.restore)
+	adminGroupV1.GET("/ns/:namespace/snapshot", kvHandlers.inNamespace((*KeyValueHandlers).snapshot))
+	adminGroupV1.POST("/ns/:namespace/snapshot", kvHandlers.inNamespace((*KeyValueHandlers).restore))
+
+	return router
+}
+
+// returns a handler calling handler with the handlers of the namespace of the request, 404 if it does not exist
+func (kv *KeyValueHandlers) inNamespace(handler func(*KeyValueHandlers, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("namespace")
+		s, err := kv.namespaces.Get(name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+
+		handler(&KeyValueHandlers{store: reportChanges(s, kv.changes, name), namespace: name, changes: kv.changes}, c)
+	}
+}
+
+// streams a snapshot of every pair of the store, taken while writes go on
+// an error part way leaves the snapshot truncated, restoring it then fails its checksum
+func (kv *KeyValueHandlers) snapshot(c *gin.Context) {
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", `attachment; filename="gokv.snapshot"`)
+	c.Status(http.StatusOK)
+
+	if _, err := snapshot.Write(c.Writer, kv.store); err != nil {
+		c.Error(err)
+	}
+}
+
+// replaces every pair of the store with the pairs of the snapshot in the body, all at once
+// the whole snapshot is read and checked before the store is changed
+func (kv *KeyValueHandlers) restore(c *gin.Context) {
+	body := c.Request.Body
+	if body == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorValueEmpty})
+		return
+	}
+
+	tree, err := snapshot.Read(body)
+	if err == snapshot.ErrCorrupted || err == snapshot.ErrVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("%v, %v", errorBadSnapshot, err)})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorInternal})
+		return
+	}
+
+	if err := snapshot.Replace(kv.store, tree); err == store.KeyDoesNotExist {
+		// a key was removed while the restore was prepared, nothing was changed
+		c.JSON(http.StatusConflict, gin.H{"message": errorRestoreRace})
+		return
+	} else if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "snapshot restored"})
+}
@@ -0,0 +1,77 @@
+package kv
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/namespace"
+	"github.com/tPhume/gokv/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	config := Config{Store: store.NewSyncStore(btree.NewBtree(3)), Namespaces: namespace.NewRegistry(namespace.DefaultFactory)}
+	rest := RestWithConfig(config)
+	admin := AdminWithConfig(config)
+
+	request := func(router http.Handler, method, path string, body []byte) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	request(rest, "POST", "/store/v1/A", []byte(`{"v": "1"}`))
+	request(rest, "POST", "/store/v1/B", []byte(`{"v": "1"}`))
+	request(rest, "POST", "/store/v1/session?ttl=1h", []byte(`{"v": "1"}`))
+
+	w := request(admin, "GET", "/admin/v1/snapshot", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	backup := w.Body.Bytes()
+
+	request(rest, "PATCH", "/store/v1/A", []byte(`{"v": "2"}`))
+	request(rest, "DELETE", "/store/v1/B", nil)
+	request(rest, "POST", "/store/v1/C", []byte(`{"v": "2"}`))
+	request(rest, "POST", "/store/v1/session", []byte(`{"v": "2"}`))
+
+	w = request(admin, "POST", "/admin/v1/snapshot", backup)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(rest, "GET", "/store/v1?limit=10", nil)
+	assert.JSONEq(t, `{"items":[{"key":"A","value":{"v":"1"}},{"key":"B","value":{"v":"1"}},{"key":"session","value":{"v":"1"}}]}`, w.Body.String())
+
+	// the restored key expires again
+	if e, _ := store.SearchEntry(config.Store, "session"); e.Expires.IsZero() {
+		t.Fatal("expected session to keep its expiry")
+	}
+
+	// a damaged snapshot changes nothing
+	w = request(admin, "POST", "/admin/v1/snapshot", backup[:len(backup)-1])
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(rest, "GET", "/store/v1/A", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// namespaces are backed up on their own
+	request(rest, "PUT", "/store/v1/ns/team-a", nil)
+	w = request(admin, "POST", "/admin/v1/ns/team-a/snapshot", backup)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(rest, "GET", "/store/v1/ns/team-a/B", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(admin, "GET", "/admin/v1/ns/team-b/snapshot", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// snapshots are not served with the keys
+	w = request(rest, "GET", "/store/v1/_snapshot", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
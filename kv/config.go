@@ -0,0 +1,41 @@
+package kv
+
+import (
+	"github.com/tPhume/gokv/cdc"
+	"github.com/tPhume/gokv/namespace"
+	"github.com/tPhume/gokv/store"
+)
+
+// Config holds what the REST and gRPC servers serve, only Store is required
+// pass the same Config to RestWithConfig and GrpcWithConfig so both servers share it
+type Config struct {
+	// default namespace, it must be safe for concurrent use (see store.SyncStore)
+	Store store.Store
+	// the other namespaces, kept in memory if nil
+	Namespaces *namespace.Registry
+	// changes to read, nil disables the changes endpoints
+	// the servers wrap the stores in a cdc.Store appending to it, unless Store already is one
+	// pass such stores to also get the keys removed by a sweeper (see store.StartSweeper)
+	Changes *cdc.Log
+}
+
+// returns s appending its changes to changes under namespace, s itself if changes is nil or s appends to it already
+func reportChanges(s store.Store, changes *cdc.Log, namespace string) store.Store {
+	if changes == nil {
+		return s
+	}
+
+	if c, ok := s.(*cdc.Store); ok && c.Changes() == changes {
+		return s
+	}
+
+	return cdc.NewStore(s, changes, namespace)
+}
+
+func (config Config) namespaces() *namespace.Registry {
+	if config.Namespaces == nil {
+		return namespace.NewRegistry(namespace.DefaultFactory)
+	}
+
+	return config.Namespaces
+}
@@ -0,0 +1,88 @@
+package kv
+
+import (
+	"errors"
+	"github.com/tPhume/gokv/art"
+	"github.com/tPhume/gokv/bplustree"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/hashstore"
+	"github.com/tPhume/gokv/namespace"
+	"github.com/tPhume/gokv/skiplist"
+	"github.com/tPhume/gokv/store"
+	"sort"
+)
+
+var (
+	ErrUnknownEngine = errors.New("unknown storage engine")
+)
+
+// Engine creates an empty in memory store, see store.Share to share it between goroutines
+type Engine func() store.Store
+
+// engines by the name they are selected with
+var engines = map[string]Engine{
+	"btree":     BtreeEngine,
+	"bplustree": BPlusTreeEngine,
+	"skiplist":  SkipListEngine,
+	"hashstore": HashEngine(hashstore.DefaultShards),
+	"art":       RadixTreeEngine,
+}
+
+func BtreeEngine() store.Store {
+	return btree.NewBtree(3)
+}
+
+func BPlusTreeEngine() store.Store {
+	return bplustree.NewBPlusTree(32)
+}
+
+// RadixTreeEngine suits long keys sharing prefixes
+func RadixTreeEngine() store.Store {
+	return art.NewRadixTree()
+}
+
+// SkipListEngine needs no lock around it, readers never wait for writers
+func SkipListEngine() store.Store {
+	return skiplist.NewSkipList()
+}
+
+// HashEngine is the fastest for exact match lookups, its shards are locked independently
+// scans have to sort every key in range, so it suits keys that are rarely listed
+func HashEngine(shards int) Engine {
+	return func() store.Store {
+		return hashstore.NewHashStore(shards)
+	}
+}
+
+// LookupEngine returns the engine of the given name, see EngineNames
+func LookupEngine(name string) (Engine, error) {
+	engine, ok := engines[name]
+	if !ok {
+		return nil, ErrUnknownEngine
+	}
+
+	return engine, nil
+}
+
+// EngineNames returns the names LookupEngine accepts, sorted
+func EngineNames() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// EngineFactory backs every namespace with a store of the engine, its reads locked only if the engine needs it
+func EngineFactory(engine Engine) namespace.Factory {
+	return func(name string) (store.Store, error) {
+		return store.Share(engine()), nil
+	}
+}
+
+// NewConfig returns a Config whose default namespace and other namespaces are all stores of the engine
+func NewConfig(engine Engine) Config {
+	return Config{Store: store.Share(engine()), Namespaces: namespace.NewRegistry(EngineFactory(engine))}
+}
@@ -0,0 +1,94 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/tPhume/gokv/store/storetest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// every engine serves the same requests, and both servers built from one config share its stores
+func TestEngines(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	for _, name := range EngineNames() {
+		engine, err := LookupEngine(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config := NewConfig(engine)
+
+		// writes of every engine are locked so read-modify-writes are not interleaved
+		storetest.ReadModifyWrite(t, config.Store)
+
+		router := RestWithConfig(config)
+		client, tearDown := setUpGrpcWithConfig(t, config)
+
+		request := func(method, path, body string) (int, map[string]interface{}) {
+			req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			resBody := make(map[string]interface{})
+			_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+			return w.Code, resBody
+		}
+
+		for i := 3; i > 0; i-- {
+			code, _ := request("POST", fmt.Sprintf("/store/v1/user:%v", i), fmt.Sprintf(`{"n": "%v"}`, i))
+			assert.Equal(t, http.StatusCreated, code, name)
+		}
+		request("POST", "/store/v1/team:1", `{"n": "1"}`)
+
+		code, resBody := request("GET", "/store/v1?prefix=user:&limit=2", "")
+		assert.Equal(t, http.StatusOK, code, name)
+		assert.Len(t, resBody["items"], 2, name)
+		assert.Equal(t, "user:1", resBody["items"].([]interface{})[0].(map[string]interface{})["key"], name)
+
+		code, _ = request("PUT", "/store/v1/ns/team-a", "")
+		assert.Equal(t, http.StatusCreated, code, name)
+		request("POST", "/store/v1/ns/team-a/config", `{"owner": "a"}`)
+
+		// pairs written through REST are read back through gRPC
+		stream, err := client.Scan(context.Background(), &ScanRequest{Prefix: "user:", Reverse: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var keys []string
+		for {
+			kv, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, kv.GetKey().GetKey())
+		}
+		assert.Equal(t, []string{"user:3", "user:2", "user:1"}, keys, name)
+
+		res, err := client.Search(context.Background(), &Key{Key: "config", Namespace: "team-a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "a", res.GetKv().GetValue().GetValue()["owner"], name)
+
+		tearDown()
+	}
+
+	if _, err := LookupEngine("missing"); err != ErrUnknownEngine {
+		t.Fatalf("expected %v, got = %v", ErrUnknownEngine, err)
+	}
+}
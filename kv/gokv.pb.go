@@ -7,6 +7,7 @@ import (
 	context "context"
 	fmt "fmt"
 	proto "github.com/golang/protobuf/proto"
+	field_mask "google.golang.org/genproto/protobuf/field_mask"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -24,9 +25,103 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type Operation_Type int32
+
+const (
+	Operation_INSERT Operation_Type = 0
+	Operation_UPDATE Operation_Type = 1
+	Operation_REMOVE Operation_Type = 2
+)
+
+var Operation_Type_name = map[int32]string{
+	0: "INSERT",
+	1: "UPDATE",
+	2: "REMOVE",
+}
+
+var Operation_Type_value = map[string]int32{
+	"INSERT": 0,
+	"UPDATE": 1,
+	"REMOVE": 2,
+}
+
+func (x Operation_Type) String() string {
+	return proto.EnumName(Operation_Type_name, int32(x))
+}
+
+func (Operation_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{9, 0}
+}
+
+type TxnRequest_Type int32
+
+const (
+	TxnRequest_GET      TxnRequest_Type = 0
+	TxnRequest_PUT      TxnRequest_Type = 1
+	TxnRequest_DELETE   TxnRequest_Type = 2
+	TxnRequest_COMMIT   TxnRequest_Type = 3
+	TxnRequest_ROLLBACK TxnRequest_Type = 4
+)
+
+var TxnRequest_Type_name = map[int32]string{
+	0: "GET",
+	1: "PUT",
+	2: "DELETE",
+	3: "COMMIT",
+	4: "ROLLBACK",
+}
+
+var TxnRequest_Type_value = map[string]int32{
+	"GET":      0,
+	"PUT":      1,
+	"DELETE":   2,
+	"COMMIT":   3,
+	"ROLLBACK": 4,
+}
+
+func (x TxnRequest_Type) String() string {
+	return proto.EnumName(TxnRequest_Type_name, int32(x))
+}
+
+func (TxnRequest_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{11, 0}
+}
+
+type WatchEvent_Type int32
+
+const (
+	WatchEvent_PUT    WatchEvent_Type = 0
+	WatchEvent_DELETE WatchEvent_Type = 1
+)
+
+var WatchEvent_Type_name = map[int32]string{
+	0: "PUT",
+	1: "DELETE",
+}
+
+var WatchEvent_Type_value = map[string]int32{
+	"PUT":    0,
+	"DELETE": 1,
+}
+
+func (x WatchEvent_Type) String() string {
+	return proto.EnumName(WatchEvent_Type_name, int32(x))
+}
+
+func (WatchEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{17, 0}
+}
+
 // Represent a key
 type Key struct {
-	Key                  string   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// Remove only applies if the key is at this version, 0 removes any version
+	ExpectedVersion uint64 `protobuf:"varint,2,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
+	// Search only returns these fields of the value, fields the value does not have are left out
+	// empty returns every field
+	Fields []string `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty"`
+	// namespace holding the key, empty for the default one
+	Namespace            string   `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -64,6 +159,27 @@ func (m *Key) GetKey() string {
 	return ""
 }
 
+func (m *Key) GetExpectedVersion() uint64 {
+	if m != nil {
+		return m.ExpectedVersion
+	}
+	return 0
+}
+
+func (m *Key) GetFields() []string {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
+func (m *Key) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
 // Represent a value
 type Value struct {
 	Value                map[string]string `protobuf:"bytes,1,rep,name=value,proto3" json:"value,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
@@ -106,8 +222,14 @@ func (m *Value) GetValue() map[string]string {
 
 // Represents key-value pair
 type KeyValue struct {
-	Key                  *Key     `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
-	Value                *Value   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Key   *Key   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value *Value `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// time to live in milliseconds used by Insert and Update, 0 never expires, a negative ttl is INVALID_ARGUMENT
+	Ttl int64 `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// version of the key returned by Search, 0 if the store has no versions
+	Version uint64 `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	// Update only applies if the key is at this version, 0 updates any version
+	ExpectedVersion      uint64   `protobuf:"varint,5,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -152,6 +274,27 @@ func (m *KeyValue) GetValue() *Value {
 	return nil
 }
 
+func (m *KeyValue) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+func (m *KeyValue) GetVersion() uint64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *KeyValue) GetExpectedVersion() uint64 {
+	if m != nil {
+		return m.ExpectedVersion
+	}
+	return 0
+}
+
 // Represent response message with no key-value pair
 type Response struct {
 	Message              string    `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
@@ -200,201 +343,1281 @@ func (m *Response) GetKv() *KeyValue {
 	return nil
 }
 
-func init() {
-	proto.RegisterType((*Key)(nil), "kv.Key")
-	proto.RegisterType((*Value)(nil), "kv.Value")
-	proto.RegisterMapType((map[string]string)(nil), "kv.Value.ValueEntry")
-	proto.RegisterType((*KeyValue)(nil), "kv.KeyValue")
-	proto.RegisterType((*Response)(nil), "kv.Response")
+// Represent a partial update of the fields of a value
+type PatchRequest struct {
+	Key *Key `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// new values of the fields in mask
+	Value *Value `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// fields to change, a field in mask but missing from value is deleted, fields outside mask are kept
+	Mask                 *field_mask.FieldMask `protobuf:"bytes,3,opt,name=mask,proto3" json:"mask,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
 }
 
-func init() { proto.RegisterFile("gokv.proto", fileDescriptor_5ddeeba323e93b9f) }
+func (m *PatchRequest) Reset()         { *m = PatchRequest{} }
+func (m *PatchRequest) String() string { return proto.CompactTextString(m) }
+func (*PatchRequest) ProtoMessage()    {}
+func (*PatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{4}
+}
 
-var fileDescriptor_5ddeeba323e93b9f = []byte{
-	// 280 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x91, 0xc1, 0x4b, 0xc3, 0x30,
-	0x14, 0xc6, 0x4d, 0xe7, 0xba, 0xed, 0xd5, 0x83, 0x84, 0x89, 0x75, 0x08, 0xce, 0x1c, 0x64, 0x78,
-	0xe8, 0xa1, 0x5e, 0x86, 0xc7, 0x82, 0x8a, 0xf4, 0x32, 0x2a, 0x7a, 0xaf, 0xfa, 0xd8, 0x20, 0xb6,
-	0x29, 0x4d, 0x16, 0xc8, 0xff, 0xe2, 0x1f, 0x2b, 0x49, 0x5a, 0xa7, 0xa8, 0x78, 0x09, 0xef, 0xbd,
-	0x7c, 0xf9, 0x7d, 0x5f, 0x78, 0x00, 0x6b, 0xc1, 0x75, 0xd2, 0xb4, 0x42, 0x09, 0x1a, 0x70, 0xcd,
-	0x8e, 0x61, 0x90, 0xa3, 0xa1, 0x87, 0x30, 0xe0, 0x68, 0x62, 0x32, 0x27, 0x8b, 0x49, 0x61, 0x4b,
-	0x56, 0xc1, 0xf0, 0xa9, 0x7c, 0xdb, 0x22, 0xbd, 0x84, 0xa1, 0xb6, 0x45, 0x4c, 0xe6, 0x83, 0x45,
-	0x94, 0x4e, 0x13, 0xae, 0x13, 0x77, 0xe3, 0xcf, 0x9b, 0x5a, 0xb5, 0xa6, 0xf0, 0x92, 0xd9, 0x12,
-	0x60, 0x37, 0xfc, 0x09, 0xa5, 0xd3, 0x9e, 0x15, 0xb8, 0x99, 0x6f, 0xae, 0x83, 0x25, 0x61, 0xb7,
-	0x30, 0xce, 0xd1, 0x78, 0xc7, 0x93, 0xdd, 0xbb, 0x28, 0x1d, 0x59, 0xbf, 0x1c, 0x8d, 0x07, 0x9c,
-	0x7d, 0x05, 0x44, 0xe9, 0xe4, 0x33, 0x4c, 0xc7, 0x62, 0x19, 0x8c, 0x0b, 0x94, 0x8d, 0xa8, 0x25,
-	0xd2, 0x18, 0x46, 0x15, 0x4a, 0x59, 0xae, 0xb1, 0xcb, 0xd0, 0xb7, 0xf4, 0x14, 0x02, 0xae, 0x3b,
-	0xc6, 0x41, 0x67, 0xe0, 0x31, 0x01, 0xd7, 0xe9, 0x3b, 0x81, 0xfd, 0x3b, 0x91, 0x6b, 0x7a, 0x01,
-	0xe1, 0x7d, 0x2d, 0xb1, 0x55, 0xf4, 0x9b, 0x68, 0xe6, 0xba, 0xde, 0x86, 0xed, 0x59, 0xdd, 0x63,
-	0xf3, 0x5a, 0x2a, 0xfc, 0x47, 0x77, 0x0e, 0xe1, 0x03, 0x96, 0xed, 0xcb, 0x86, 0xf6, 0xbf, 0xfa,
-	0x4d, 0x52, 0x60, 0x25, 0x34, 0xfe, 0x29, 0xc9, 0x8e, 0x20, 0x52, 0xab, 0xcd, 0xb6, 0xc2, 0xc4,
-	0xee, 0x32, 0x73, 0x51, 0x57, 0xe4, 0x39, 0x74, 0x4b, 0xbd, 0xfa, 0x08, 0x00, 0x00, 0xff, 0xff,
-	0x2b, 0x12, 0x0a, 0x32, 0xe2, 0x01, 0x00, 0x00,
+func (m *PatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PatchRequest.Unmarshal(m, b)
+}
+func (m *PatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PatchRequest.Marshal(b, m, deterministic)
+}
+func (m *PatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PatchRequest.Merge(m, src)
+}
+func (m *PatchRequest) XXX_Size() int {
+	return xxx_messageInfo_PatchRequest.Size(m)
+}
+func (m *PatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PatchRequest.DiscardUnknown(m)
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConnInterface
+var xxx_messageInfo_PatchRequest proto.InternalMessageInfo
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion6
+func (m *PatchRequest) GetKey() *Key {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
 
-// GoKvClient is the client API for GoKv service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type GoKvClient interface {
-	// Insert key-value pairs
-	Insert(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*Response, error)
-	// Update key-value pairs
-	Update(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*Response, error)
-	// Search for value with key
-	Search(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error)
-	// Remove a key-value pair with a key
-	Remove(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error)
+func (m *PatchRequest) GetValue() *Value {
+	if m != nil {
+		return m.Value
+	}
+	return nil
 }
 
-type goKvClient struct {
-	cc grpc.ClientConnInterface
+func (m *PatchRequest) GetMask() *field_mask.FieldMask {
+	if m != nil {
+		return m.Mask
+	}
+	return nil
 }
 
-func NewGoKvClient(cc grpc.ClientConnInterface) GoKvClient {
-	return &goKvClient{cc}
+// Represent an increment of an integer field of a value
+type IncrementRequest struct {
+	Key   *Key   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Field string `protobuf:"bytes,2,opt,name=field,proto3" json:"field,omitempty"`
+	// added to the field, negative to decrement
+	Delta                int64    `protobuf:"varint,3,opt,name=delta,proto3" json:"delta,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (c *goKvClient) Insert(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*Response, error) {
-	out := new(Response)
-	err := c.cc.Invoke(ctx, "/kv.GoKv/Insert", in, out, opts...)
-	if err != nil {
-		return nil, err
-	}
-	return out, nil
+func (m *IncrementRequest) Reset()         { *m = IncrementRequest{} }
+func (m *IncrementRequest) String() string { return proto.CompactTextString(m) }
+func (*IncrementRequest) ProtoMessage()    {}
+func (*IncrementRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{5}
 }
 
-func (c *goKvClient) Update(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*Response, error) {
-	out := new(Response)
-	err := c.cc.Invoke(ctx, "/kv.GoKv/Update", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *IncrementRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IncrementRequest.Unmarshal(m, b)
+}
+func (m *IncrementRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IncrementRequest.Marshal(b, m, deterministic)
+}
+func (m *IncrementRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IncrementRequest.Merge(m, src)
+}
+func (m *IncrementRequest) XXX_Size() int {
+	return xxx_messageInfo_IncrementRequest.Size(m)
+}
+func (m *IncrementRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_IncrementRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IncrementRequest proto.InternalMessageInfo
+
+func (m *IncrementRequest) GetKey() *Key {
+	if m != nil {
+		return m.Key
 	}
-	return out, nil
+	return nil
 }
 
-func (c *goKvClient) Search(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error) {
-	out := new(Response)
-	err := c.cc.Invoke(ctx, "/kv.GoKv/Search", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *IncrementRequest) GetField() string {
+	if m != nil {
+		return m.Field
 	}
-	return out, nil
+	return ""
 }
 
-func (c *goKvClient) Remove(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error) {
-	out := new(Response)
-	err := c.cc.Invoke(ctx, "/kv.GoKv/Remove", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *IncrementRequest) GetDelta() int64 {
+	if m != nil {
+		return m.Delta
 	}
-	return out, nil
+	return 0
 }
 
-// GoKvServer is the server API for GoKv service.
-type GoKvServer interface {
-	// Insert key-value pairs
-	Insert(context.Context, *KeyValue) (*Response, error)
-	// Update key-value pairs
-	Update(context.Context, *KeyValue) (*Response, error)
-	// Search for value with key
-	Search(context.Context, *Key) (*Response, error)
-	// Remove a key-value pair with a key
-	Remove(context.Context, *Key) (*Response, error)
+// Represent the value of a field after an increment
+type IncrementResponse struct {
+	Value                int64    `protobuf:"varint,1,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-// UnimplementedGoKvServer can be embedded to have forward compatible implementations.
-type UnimplementedGoKvServer struct {
+func (m *IncrementResponse) Reset()         { *m = IncrementResponse{} }
+func (m *IncrementResponse) String() string { return proto.CompactTextString(m) }
+func (*IncrementResponse) ProtoMessage()    {}
+func (*IncrementResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{6}
 }
 
-func (*UnimplementedGoKvServer) Insert(ctx context.Context, req *KeyValue) (*Response, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Insert not implemented")
+func (m *IncrementResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IncrementResponse.Unmarshal(m, b)
 }
-func (*UnimplementedGoKvServer) Update(ctx context.Context, req *KeyValue) (*Response, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+func (m *IncrementResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IncrementResponse.Marshal(b, m, deterministic)
 }
-func (*UnimplementedGoKvServer) Search(ctx context.Context, req *Key) (*Response, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+func (m *IncrementResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IncrementResponse.Merge(m, src)
 }
-func (*UnimplementedGoKvServer) Remove(ctx context.Context, req *Key) (*Response, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+func (m *IncrementResponse) XXX_Size() int {
+	return xxx_messageInfo_IncrementResponse.Size(m)
 }
-
-func RegisterGoKvServer(s *grpc.Server, srv GoKvServer) {
-	s.RegisterService(&_GoKv_serviceDesc, srv)
+func (m *IncrementResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_IncrementResponse.DiscardUnknown(m)
 }
 
-func _GoKv_Insert_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(KeyValue)
-	if err := dec(in); err != nil {
-		return nil, err
-	}
-	if interceptor == nil {
-		return srv.(GoKvServer).Insert(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/kv.GoKv/Insert",
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GoKvServer).Insert(ctx, req.(*KeyValue))
+var xxx_messageInfo_IncrementResponse proto.InternalMessageInfo
+
+func (m *IncrementResponse) GetValue() int64 {
+	if m != nil {
+		return m.Value
 	}
-	return interceptor(ctx, in, info, handler)
+	return 0
 }
 
-func _GoKv_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(KeyValue)
-	if err := dec(in); err != nil {
-		return nil, err
-	}
-	if interceptor == nil {
-		return srv.(GoKvServer).Update(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/kv.GoKv/Update",
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GoKvServer).Update(ctx, req.(*KeyValue))
-	}
-	return interceptor(ctx, in, info, handler)
+// Represent a range of keys to scan
+type ScanRequest struct {
+	// first key of the range, inclusive
+	Start string `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	// last key of the range, exclusive, empty scans to the biggest key
+	End string `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	// only scan keys starting with prefix, replaces start and end when set
+	Prefix string `protobuf:"bytes,3,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// maximum number of key-value pairs, 0 means no limit
+	Limit int32 `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	// stream keys in descending order
+	Reverse bool `protobuf:"varint,5,opt,name=reverse,proto3" json:"reverse,omitempty"`
+	// namespace to scan, empty for the default one
+	Namespace            string   `protobuf:"bytes,6,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func _GoKv_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Key)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *ScanRequest) Reset()         { *m = ScanRequest{} }
+func (m *ScanRequest) String() string { return proto.CompactTextString(m) }
+func (*ScanRequest) ProtoMessage()    {}
+func (*ScanRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{7}
+}
+
+func (m *ScanRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ScanRequest.Unmarshal(m, b)
+}
+func (m *ScanRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ScanRequest.Marshal(b, m, deterministic)
+}
+func (m *ScanRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ScanRequest.Merge(m, src)
+}
+func (m *ScanRequest) XXX_Size() int {
+	return xxx_messageInfo_ScanRequest.Size(m)
+}
+func (m *ScanRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ScanRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ScanRequest proto.InternalMessageInfo
+
+func (m *ScanRequest) GetStart() string {
+	if m != nil {
+		return m.Start
 	}
-	if interceptor == nil {
-		return srv.(GoKvServer).Search(ctx, in)
+	return ""
+}
+
+func (m *ScanRequest) GetEnd() string {
+	if m != nil {
+		return m.End
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/kv.GoKv/Search",
+	return ""
+}
+
+func (m *ScanRequest) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GoKvServer).Search(ctx, req.(*Key))
+	return ""
+}
+
+func (m *ScanRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
 	}
-	return interceptor(ctx, in, info, handler)
+	return 0
 }
 
-func _GoKv_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Key)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *ScanRequest) GetReverse() bool {
+	if m != nil {
+		return m.Reverse
 	}
-	if interceptor == nil {
-		return srv.(GoKvServer).Remove(ctx, in)
+	return false
+}
+
+func (m *ScanRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
+	return ""
+}
+
+// Represent a lookup of the keys whose value has field set to value, using the index of field
+type QueryRequest struct {
+	Field string `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// only return keys starting with prefix
+	Prefix string `protobuf:"bytes,3,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// maximum number of key-value pairs, 0 means no limit
+	Limit int32 `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`
+	// namespace to query, empty for the default one
+	Namespace            string   `protobuf:"bytes,5,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QueryRequest) Reset()         { *m = QueryRequest{} }
+func (m *QueryRequest) String() string { return proto.CompactTextString(m) }
+func (*QueryRequest) ProtoMessage()    {}
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{8}
+}
+
+func (m *QueryRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueryRequest.Unmarshal(m, b)
+}
+func (m *QueryRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueryRequest.Marshal(b, m, deterministic)
+}
+func (m *QueryRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryRequest.Merge(m, src)
+}
+func (m *QueryRequest) XXX_Size() int {
+	return xxx_messageInfo_QueryRequest.Size(m)
+}
+func (m *QueryRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryRequest proto.InternalMessageInfo
+
+func (m *QueryRequest) GetField() string {
+	if m != nil {
+		return m.Field
+	}
+	return ""
+}
+
+func (m *QueryRequest) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *QueryRequest) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *QueryRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *QueryRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+// Represent a single operation of a batch, value is ignored by REMOVE
+type Operation struct {
+	Type                 Operation_Type `protobuf:"varint,1,opt,name=type,proto3,enum=kv.Operation_Type" json:"type,omitempty"`
+	Kv                   *KeyValue      `protobuf:"bytes,2,opt,name=kv,proto3" json:"kv,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *Operation) Reset()         { *m = Operation{} }
+func (m *Operation) String() string { return proto.CompactTextString(m) }
+func (*Operation) ProtoMessage()    {}
+func (*Operation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{9}
+}
+
+func (m *Operation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Operation.Unmarshal(m, b)
+}
+func (m *Operation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Operation.Marshal(b, m, deterministic)
+}
+func (m *Operation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Operation.Merge(m, src)
+}
+func (m *Operation) XXX_Size() int {
+	return xxx_messageInfo_Operation.Size(m)
+}
+func (m *Operation) XXX_DiscardUnknown() {
+	xxx_messageInfo_Operation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Operation proto.InternalMessageInfo
+
+func (m *Operation) GetType() Operation_Type {
+	if m != nil {
+		return m.Type
+	}
+	return Operation_INSERT
+}
+
+func (m *Operation) GetKv() *KeyValue {
+	if m != nil {
+		return m.Kv
+	}
+	return nil
+}
+
+// Represent operations applied all-or-nothing, in order
+// the ttl of an insert and the expected_version of an update or remove are honoured as in Insert and Update
+// a batch whose version check fails returns FAILED_PRECONDITION
+type BatchRequest struct {
+	Operations []*Operation `protobuf:"bytes,1,rep,name=operations,proto3" json:"operations,omitempty"`
+	// namespace of every key of the batch, empty for the default one
+	Namespace            string   `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BatchRequest) Reset()         { *m = BatchRequest{} }
+func (m *BatchRequest) String() string { return proto.CompactTextString(m) }
+func (*BatchRequest) ProtoMessage()    {}
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{10}
+}
+
+func (m *BatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchRequest.Unmarshal(m, b)
+}
+func (m *BatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchRequest.Marshal(b, m, deterministic)
+}
+func (m *BatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchRequest.Merge(m, src)
+}
+func (m *BatchRequest) XXX_Size() int {
+	return xxx_messageInfo_BatchRequest.Size(m)
+}
+func (m *BatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchRequest proto.InternalMessageInfo
+
+func (m *BatchRequest) GetOperations() []*Operation {
+	if m != nil {
+		return m.Operations
+	}
+	return nil
+}
+
+func (m *BatchRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+// Represent a single step of a transaction session
+type TxnRequest struct {
+	Type                 TxnRequest_Type `protobuf:"varint,1,opt,name=type,proto3,enum=kv.TxnRequest_Type" json:"type,omitempty"`
+	Kv                   *KeyValue       `protobuf:"bytes,2,opt,name=kv,proto3" json:"kv,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *TxnRequest) Reset()         { *m = TxnRequest{} }
+func (m *TxnRequest) String() string { return proto.CompactTextString(m) }
+func (*TxnRequest) ProtoMessage()    {}
+func (*TxnRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{11}
+}
+
+func (m *TxnRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TxnRequest.Unmarshal(m, b)
+}
+func (m *TxnRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TxnRequest.Marshal(b, m, deterministic)
+}
+func (m *TxnRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TxnRequest.Merge(m, src)
+}
+func (m *TxnRequest) XXX_Size() int {
+	return xxx_messageInfo_TxnRequest.Size(m)
+}
+func (m *TxnRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TxnRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TxnRequest proto.InternalMessageInfo
+
+func (m *TxnRequest) GetType() TxnRequest_Type {
+	if m != nil {
+		return m.Type
+	}
+	return TxnRequest_GET
+}
+
+func (m *TxnRequest) GetKv() *KeyValue {
+	if m != nil {
+		return m.Kv
+	}
+	return nil
+}
+
+// Represent the result of a transaction step, found is set by GET
+type TxnResponse struct {
+	Message              string    `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Kv                   *KeyValue `protobuf:"bytes,2,opt,name=kv,proto3" json:"kv,omitempty"`
+	Found                bool      `protobuf:"varint,3,opt,name=found,proto3" json:"found,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *TxnResponse) Reset()         { *m = TxnResponse{} }
+func (m *TxnResponse) String() string { return proto.CompactTextString(m) }
+func (*TxnResponse) ProtoMessage()    {}
+func (*TxnResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{12}
+}
+
+func (m *TxnResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TxnResponse.Unmarshal(m, b)
+}
+func (m *TxnResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TxnResponse.Marshal(b, m, deterministic)
+}
+func (m *TxnResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TxnResponse.Merge(m, src)
+}
+func (m *TxnResponse) XXX_Size() int {
+	return xxx_messageInfo_TxnResponse.Size(m)
+}
+func (m *TxnResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_TxnResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TxnResponse proto.InternalMessageInfo
+
+func (m *TxnResponse) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *TxnResponse) GetKv() *KeyValue {
+	if m != nil {
+		return m.Kv
+	}
+	return nil
+}
+
+func (m *TxnResponse) GetFound() bool {
+	if m != nil {
+		return m.Found
+	}
+	return false
+}
+
+// Represent a namespace
+type Namespace struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Namespace) Reset()         { *m = Namespace{} }
+func (m *Namespace) String() string { return proto.CompactTextString(m) }
+func (*Namespace) ProtoMessage()    {}
+func (*Namespace) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{13}
+}
+
+func (m *Namespace) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Namespace.Unmarshal(m, b)
+}
+func (m *Namespace) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Namespace.Marshal(b, m, deterministic)
+}
+func (m *Namespace) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Namespace.Merge(m, src)
+}
+func (m *Namespace) XXX_Size() int {
+	return xxx_messageInfo_Namespace.Size(m)
+}
+func (m *Namespace) XXX_DiscardUnknown() {
+	xxx_messageInfo_Namespace.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Namespace proto.InternalMessageInfo
+
+func (m *Namespace) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+// Represent a request for the names of the namespaces
+type ListNamespacesRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListNamespacesRequest) Reset()         { *m = ListNamespacesRequest{} }
+func (m *ListNamespacesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListNamespacesRequest) ProtoMessage()    {}
+func (*ListNamespacesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{14}
+}
+
+func (m *ListNamespacesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListNamespacesRequest.Unmarshal(m, b)
+}
+func (m *ListNamespacesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListNamespacesRequest.Marshal(b, m, deterministic)
+}
+func (m *ListNamespacesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListNamespacesRequest.Merge(m, src)
+}
+func (m *ListNamespacesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListNamespacesRequest.Size(m)
+}
+func (m *ListNamespacesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListNamespacesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListNamespacesRequest proto.InternalMessageInfo
+
+// Represent the names of the namespaces in order
+type NamespaceList struct {
+	Names                []string `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *NamespaceList) Reset()         { *m = NamespaceList{} }
+func (m *NamespaceList) String() string { return proto.CompactTextString(m) }
+func (*NamespaceList) ProtoMessage()    {}
+func (*NamespaceList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{15}
+}
+
+func (m *NamespaceList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NamespaceList.Unmarshal(m, b)
+}
+func (m *NamespaceList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NamespaceList.Marshal(b, m, deterministic)
+}
+func (m *NamespaceList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NamespaceList.Merge(m, src)
+}
+func (m *NamespaceList) XXX_Size() int {
+	return xxx_messageInfo_NamespaceList.Size(m)
+}
+func (m *NamespaceList) XXX_DiscardUnknown() {
+	xxx_messageInfo_NamespaceList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NamespaceList proto.InternalMessageInfo
+
+func (m *NamespaceList) GetNames() []string {
+	if m != nil {
+		return m.Names
+	}
+	return nil
+}
+
+// Represent the keys to watch and the revision to watch them from
+type WatchRequest struct {
+	// watch this key only, replaces prefix when set
+	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// watch the keys starting with prefix, empty watches every key
+	Prefix string `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// revision of the first change to stream, 0 streams the changes made after the watch started
+	// pass the revision of the last event received plus one to resume without missing changes
+	StartRevision uint64 `protobuf:"varint,3,opt,name=start_revision,json=startRevision,proto3" json:"start_revision,omitempty"`
+	// namespace to watch, empty for the default one
+	Namespace            string   `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WatchRequest) Reset()         { *m = WatchRequest{} }
+func (m *WatchRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchRequest) ProtoMessage()    {}
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{16}
+}
+
+func (m *WatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchRequest.Unmarshal(m, b)
+}
+func (m *WatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchRequest.Merge(m, src)
+}
+func (m *WatchRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchRequest.Size(m)
+}
+func (m *WatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchRequest proto.InternalMessageInfo
+
+func (m *WatchRequest) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *WatchRequest) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *WatchRequest) GetStartRevision() uint64 {
+	if m != nil {
+		return m.StartRevision
+	}
+	return 0
+}
+
+func (m *WatchRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+// Represent a change of a key, kv has no value for DELETE
+type WatchEvent struct {
+	Type WatchEvent_Type `protobuf:"varint,1,opt,name=type,proto3,enum=kv.WatchEvent_Type" json:"type,omitempty"`
+	Kv   *KeyValue       `protobuf:"bytes,2,opt,name=kv,proto3" json:"kv,omitempty"`
+	// position of the change among the changes of every key, it only increases
+	Revision             uint64   `protobuf:"varint,3,opt,name=revision,proto3" json:"revision,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WatchEvent) Reset()         { *m = WatchEvent{} }
+func (m *WatchEvent) String() string { return proto.CompactTextString(m) }
+func (*WatchEvent) ProtoMessage()    {}
+func (*WatchEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5ddeeba323e93b9f, []int{17}
+}
+
+func (m *WatchEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchEvent.Unmarshal(m, b)
+}
+func (m *WatchEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchEvent.Marshal(b, m, deterministic)
+}
+func (m *WatchEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchEvent.Merge(m, src)
+}
+func (m *WatchEvent) XXX_Size() int {
+	return xxx_messageInfo_WatchEvent.Size(m)
+}
+func (m *WatchEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchEvent proto.InternalMessageInfo
+
+func (m *WatchEvent) GetType() WatchEvent_Type {
+	if m != nil {
+		return m.Type
+	}
+	return WatchEvent_PUT
+}
+
+func (m *WatchEvent) GetKv() *KeyValue {
+	if m != nil {
+		return m.Kv
+	}
+	return nil
+}
+
+func (m *WatchEvent) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterEnum("kv.Operation_Type", Operation_Type_name, Operation_Type_value)
+	proto.RegisterEnum("kv.TxnRequest_Type", TxnRequest_Type_name, TxnRequest_Type_value)
+	proto.RegisterEnum("kv.WatchEvent_Type", WatchEvent_Type_name, WatchEvent_Type_value)
+	proto.RegisterType((*Key)(nil), "kv.Key")
+	proto.RegisterType((*Value)(nil), "kv.Value")
+	proto.RegisterMapType((map[string]string)(nil), "kv.Value.ValueEntry")
+	proto.RegisterType((*KeyValue)(nil), "kv.KeyValue")
+	proto.RegisterType((*Response)(nil), "kv.Response")
+	proto.RegisterType((*PatchRequest)(nil), "kv.PatchRequest")
+	proto.RegisterType((*IncrementRequest)(nil), "kv.IncrementRequest")
+	proto.RegisterType((*IncrementResponse)(nil), "kv.IncrementResponse")
+	proto.RegisterType((*ScanRequest)(nil), "kv.ScanRequest")
+	proto.RegisterType((*QueryRequest)(nil), "kv.QueryRequest")
+	proto.RegisterType((*Operation)(nil), "kv.Operation")
+	proto.RegisterType((*BatchRequest)(nil), "kv.BatchRequest")
+	proto.RegisterType((*TxnRequest)(nil), "kv.TxnRequest")
+	proto.RegisterType((*TxnResponse)(nil), "kv.TxnResponse")
+	proto.RegisterType((*Namespace)(nil), "kv.Namespace")
+	proto.RegisterType((*ListNamespacesRequest)(nil), "kv.ListNamespacesRequest")
+	proto.RegisterType((*NamespaceList)(nil), "kv.NamespaceList")
+	proto.RegisterType((*WatchRequest)(nil), "kv.WatchRequest")
+	proto.RegisterType((*WatchEvent)(nil), "kv.WatchEvent")
+}
+
+func init() { proto.RegisterFile("gokv.proto", fileDescriptor_5ddeeba323e93b9f) }
+
+var fileDescriptor_5ddeeba323e93b9f = []byte{
+	// 1000 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x56, 0xdd, 0x6f, 0xda, 0x56,
+	0x14, 0x8f, 0xbf, 0x08, 0x1c, 0x08, 0x71, 0xef, 0xc8, 0x46, 0xbd, 0x4a, 0x65, 0x96, 0xda, 0x91,
+	0x4e, 0x75, 0x23, 0xb6, 0x87, 0xaa, 0x0f, 0xd3, 0x4a, 0xe2, 0x55, 0x11, 0x49, 0xc3, 0x6e, 0x48,
+	0xaa, 0xa9, 0x0f, 0x91, 0x0b, 0x27, 0x09, 0x02, 0x6c, 0xcf, 0xbe, 0x58, 0x61, 0x52, 0x5f, 0xf7,
+	0x34, 0x69, 0x0f, 0x7b, 0x9c, 0xf6, 0xbf, 0x4e, 0xf7, 0xda, 0xc6, 0x36, 0x61, 0x4b, 0xa6, 0xbe,
+	0xa0, 0x73, 0xce, 0xfd, 0xf9, 0x7c, 0xfe, 0xee, 0xb9, 0x00, 0x5c, 0x79, 0x93, 0xc8, 0xf2, 0x03,
+	0x8f, 0x79, 0x44, 0x9e, 0x44, 0x46, 0xeb, 0xca, 0xf3, 0xae, 0xa6, 0xf8, 0x42, 0x58, 0x3e, 0xcc,
+	0x2f, 0x5f, 0x5c, 0x8e, 0x71, 0x3a, 0xba, 0x98, 0x39, 0xe1, 0x24, 0x46, 0x99, 0x37, 0xa0, 0xf4,
+	0x70, 0x41, 0x74, 0x50, 0x26, 0xb8, 0x68, 0x4a, 0x2d, 0xa9, 0x5d, 0xa1, 0x5c, 0x24, 0xbb, 0xa0,
+	0xe3, 0x8d, 0x8f, 0x43, 0x86, 0xa3, 0x8b, 0x08, 0x83, 0x70, 0xec, 0xb9, 0x4d, 0xb9, 0x25, 0xb5,
+	0x55, 0xba, 0x9d, 0xda, 0xcf, 0x63, 0x33, 0xf9, 0x1c, 0x4a, 0xc2, 0x6f, 0xd8, 0x54, 0x5a, 0x4a,
+	0xbb, 0x42, 0x13, 0x8d, 0x3c, 0x82, 0x8a, 0xeb, 0xcc, 0x30, 0xf4, 0x9d, 0x21, 0x36, 0x55, 0xe1,
+	0x3a, 0x33, 0x98, 0x33, 0xd0, 0xce, 0x9d, 0xe9, 0x1c, 0xc9, 0x33, 0xd0, 0x22, 0x2e, 0x34, 0xa5,
+	0x96, 0xd2, 0xae, 0x76, 0x1a, 0xd6, 0x24, 0xb2, 0xc4, 0x49, 0xfc, 0x6b, 0xbb, 0x2c, 0x58, 0xd0,
+	0x18, 0x62, 0xbc, 0x04, 0xc8, 0x8c, 0x6b, 0xb2, 0x6e, 0xa4, 0xbe, 0x64, 0x61, 0x8b, 0x95, 0x57,
+	0xf2, 0x4b, 0xc9, 0xfc, 0x5b, 0x82, 0x72, 0x0f, 0x17, 0x71, 0xc8, 0x87, 0xd9, 0x87, 0xd5, 0xce,
+	0x26, 0x0f, 0xd8, 0xc3, 0x45, 0xec, 0xe1, 0x71, 0xde, 0x43, 0xb5, 0x53, 0x59, 0x66, 0x93, 0x38,
+	0xe3, 0x41, 0x19, 0x9b, 0x36, 0x95, 0x96, 0xd4, 0x56, 0x28, 0x17, 0x49, 0x13, 0x36, 0xd3, 0x0e,
+	0xa9, 0xa2, 0x43, 0xa9, 0xba, 0xb6, 0x89, 0xda, 0xda, 0x26, 0x9a, 0x5d, 0x28, 0x53, 0x0c, 0x7d,
+	0xcf, 0x0d, 0x91, 0x3b, 0x9c, 0x61, 0x18, 0x3a, 0x57, 0x98, 0xd4, 0x96, 0xaa, 0xe4, 0x11, 0xc8,
+	0x93, 0x28, 0x49, 0xad, 0x96, 0xe4, 0x1d, 0x67, 0x27, 0x4f, 0x22, 0xf3, 0x57, 0xa8, 0xf5, 0x1d,
+	0x36, 0xbc, 0xa6, 0xf8, 0xcb, 0x1c, 0x43, 0xf6, 0x49, 0x65, 0x5a, 0xa0, 0x72, 0x9a, 0x88, 0x3a,
+	0xab, 0x1d, 0xc3, 0x8a, 0x99, 0x64, 0xa5, 0x4c, 0xb2, 0x7e, 0xe4, 0x33, 0x3e, 0x76, 0xc2, 0x09,
+	0x15, 0x38, 0xf3, 0x67, 0xd0, 0x0f, 0xdd, 0x61, 0x80, 0x33, 0x74, 0xd9, 0x3d, 0xe2, 0x37, 0x40,
+	0x13, 0x2c, 0x49, 0x07, 0x25, 0x14, 0x6e, 0x1d, 0xe1, 0x94, 0x39, 0x49, 0x77, 0x63, 0xc5, 0xdc,
+	0x85, 0x07, 0x39, 0xd7, 0x49, 0x8f, 0x1a, 0x19, 0x6b, 0x04, 0x54, 0x28, 0xe6, 0x5f, 0x12, 0x54,
+	0x4f, 0x87, 0x8e, 0x9b, 0x66, 0xd0, 0x00, 0x2d, 0x64, 0x4e, 0xc0, 0x92, 0x3e, 0xc6, 0x0a, 0x1f,
+	0x21, 0xba, 0x69, 0x68, 0x2e, 0x72, 0x0a, 0xfb, 0x01, 0x5e, 0x8e, 0x6f, 0x44, 0xe4, 0x0a, 0x4d,
+	0x34, 0xfe, 0xfd, 0x74, 0x3c, 0x1b, 0x33, 0x31, 0x58, 0x8d, 0xc6, 0x0a, 0x9f, 0x4f, 0x80, 0x7c,
+	0x9e, 0x28, 0xa6, 0x59, 0xa6, 0xa9, 0x5a, 0xa4, 0x7c, 0x69, 0x95, 0xf2, 0xbf, 0x49, 0x50, 0xfb,
+	0x69, 0x8e, 0xc1, 0x22, 0x97, 0x5e, 0xdc, 0x05, 0x69, 0xa5, 0x0b, 0xb7, 0x49, 0xfc, 0x3f, 0x53,
+	0x2c, 0x24, 0xa2, 0xad, 0x26, 0xf2, 0x11, 0x2a, 0x27, 0x3e, 0x06, 0x0e, 0xe3, 0x24, 0x7d, 0x0a,
+	0x2a, 0x5b, 0xf8, 0x71, 0x23, 0xeb, 0x1d, 0xc2, 0xc7, 0xb4, 0x3c, 0xb4, 0x06, 0x0b, 0x1f, 0xa9,
+	0x38, 0xbf, 0x83, 0x7b, 0xcf, 0x40, 0xe5, 0x58, 0x02, 0x50, 0x3a, 0x7c, 0x7b, 0x6a, 0xd3, 0x81,
+	0xbe, 0xc1, 0xe5, 0xb3, 0xfe, 0xc1, 0xeb, 0x81, 0xad, 0x4b, 0x5c, 0xa6, 0xf6, 0xf1, 0xc9, 0xb9,
+	0xad, 0xcb, 0xe6, 0x7b, 0xa8, 0x75, 0xf3, 0x3c, 0x7d, 0x0e, 0xe0, 0xa5, 0x11, 0xc3, 0x64, 0x0d,
+	0x6c, 0x15, 0xf2, 0xa0, 0x39, 0x40, 0xb1, 0x36, 0x79, 0xb5, 0xb6, 0x3f, 0x25, 0x80, 0xc1, 0xcd,
+	0x92, 0x01, 0x5f, 0x17, 0xaa, 0xfb, 0x8c, 0x7b, 0xcd, 0x4e, 0xef, 0x5f, 0xde, 0xf7, 0x49, 0x79,
+	0x9b, 0xa0, 0xbc, 0xb1, 0x79, 0x6d, 0x9b, 0xa0, 0xf4, 0xcf, 0x06, 0x71, 0x61, 0x07, 0xf6, 0x91,
+	0x3d, 0xb0, 0x75, 0x99, 0xcb, 0xfb, 0x27, 0xc7, 0xc7, 0x87, 0x03, 0x5d, 0x21, 0x35, 0x28, 0xd3,
+	0x93, 0xa3, 0xa3, 0xee, 0xeb, 0xfd, 0x9e, 0xae, 0x9a, 0xef, 0xa1, 0x2a, 0xc2, 0x7e, 0xda, 0x0d,
+	0x17, 0x84, 0xf1, 0xe6, 0xee, 0x48, 0x70, 0xa0, 0x4c, 0x63, 0xc5, 0x7c, 0x0c, 0x95, 0xb7, 0x69,
+	0xfd, 0x84, 0x80, 0xca, 0x9b, 0x91, 0xf8, 0x15, 0xb2, 0xf9, 0x05, 0xec, 0x1c, 0x8d, 0x43, 0xb6,
+	0x04, 0x85, 0x49, 0xfd, 0xe6, 0x13, 0xd8, 0x5a, 0x1a, 0x39, 0x82, 0x07, 0x10, 0xad, 0x14, 0x53,
+	0xa8, 0xd0, 0x58, 0x31, 0x3f, 0x42, 0xed, 0x5d, 0x7e, 0x60, 0xb7, 0x17, 0x6f, 0xc6, 0x4e, 0xb9,
+	0xc0, 0xce, 0x27, 0x50, 0x17, 0x77, 0xee, 0x22, 0xc0, 0x68, 0x2c, 0xf6, 0x9f, 0x22, 0xf6, 0xdf,
+	0x96, 0xb0, 0xd2, 0xc4, 0x78, 0xc7, 0x53, 0xf1, 0xbb, 0x04, 0x20, 0xe2, 0xdb, 0x11, 0xba, 0x6b,
+	0x47, 0x9a, 0x9d, 0xde, 0x7b, 0xa4, 0xc4, 0x80, 0xf2, 0x4a, 0x52, 0x4b, 0xdd, 0xfc, 0x32, 0x1b,
+	0x77, 0xff, 0x2c, 0xa1, 0x72, 0x32, 0x65, 0xa9, 0xf3, 0x87, 0x06, 0xea, 0x1b, 0xaf, 0x17, 0x91,
+	0xa7, 0x50, 0x3a, 0x74, 0x43, 0x0c, 0x18, 0x29, 0x78, 0x37, 0x84, 0x96, 0xce, 0xda, 0xdc, 0xe0,
+	0xb8, 0x33, 0x7f, 0xe4, 0x30, 0xbc, 0x03, 0xf7, 0x15, 0x94, 0x4e, 0xd1, 0x09, 0x86, 0xd7, 0x24,
+	0x5d, 0x96, 0xeb, 0x20, 0x14, 0x67, 0x5e, 0x84, 0xff, 0x0e, 0xd9, 0x05, 0x4d, 0xbc, 0x02, 0x44,
+	0xe7, 0x07, 0xf9, 0x07, 0xe1, 0x16, 0xf4, 0x15, 0x54, 0x96, 0x9b, 0x95, 0x88, 0x87, 0x77, 0x75,
+	0x87, 0x1b, 0x3b, 0x2b, 0xd6, 0x5c, 0x18, 0x95, 0x6f, 0x5a, 0xb2, 0xcd, 0x01, 0xb9, 0x9d, 0x6b,
+	0x14, 0x6a, 0x34, 0x37, 0xf6, 0x24, 0xf2, 0x0d, 0x68, 0x62, 0xed, 0xc5, 0x19, 0xe5, 0x37, 0xe0,
+	0x1a, 0xf0, 0x73, 0xd0, 0xde, 0x65, 0xe9, 0xe7, 0x69, 0x67, 0xd4, 0x8b, 0xa3, 0x16, 0xf0, 0x5d,
+	0xd0, 0xba, 0x19, 0xbc, 0xfb, 0x5f, 0xd5, 0xee, 0xc1, 0xf6, 0x7e, 0x80, 0x0e, 0xc3, 0xec, 0xb2,
+	0x88, 0x2d, 0xb3, 0x54, 0x6f, 0x7d, 0x61, 0xc1, 0xd6, 0x41, 0xe0, 0xf9, 0xf7, 0xc6, 0xff, 0x00,
+	0xf5, 0xe2, 0x3d, 0x23, 0x0f, 0x39, 0x62, 0xed, 0xdd, 0x33, 0x1e, 0x14, 0x7c, 0x71, 0x8c, 0xb9,
+	0x41, 0xbe, 0x83, 0xea, 0x20, 0x70, 0xdc, 0xd0, 0x19, 0x8a, 0xdd, 0x5c, 0x2f, 0xee, 0x2b, 0x63,
+	0x7b, 0xa9, 0xa7, 0x31, 0xdb, 0xd2, 0x9e, 0xd4, 0xdd, 0x81, 0x2a, 0xeb, 0x5f, 0xcf, 0x67, 0x68,
+	0xf1, 0x3f, 0x80, 0x5d, 0xc1, 0xce, 0xbe, 0xf4, 0xa1, 0x24, 0x5e, 0xeb, 0x6f, 0xff, 0x19, 0x00,
+	0xbe, 0xaf, 0x46, 0xa0, 0x17, 0x0a, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// GoKvClient is the client API for GoKv service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type GoKvClient interface {
+	// Insert key-value pairs
+	Insert(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*Response, error)
+	// Update key-value pairs
+	Update(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*Response, error)
+	// Search for value with key
+	Search(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error)
+	// Remove a key-value pair with a key
+	Remove(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error)
+	// Set or delete the fields listed in the mask, leaving the other fields of the value untouched
+	Patch(ctx context.Context, in *PatchRequest, opts ...grpc.CallOption) (*Response, error)
+	// Add delta to an integer field, creating the field and the key if missing, and return the new value
+	Increment(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error)
+	// Stream key-value pairs of a range or prefix in key order
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (GoKv_ScanClient, error)
+	// Stream the key-value pairs whose field holds a value in key order, the field must be indexed
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (GoKv_QueryClient, error)
+	// Stream the changes of a key or prefix as they are applied, from start_revision
+	// fails with OUT_OF_RANGE if changes from start_revision are no longer kept
+	// and ends with NOT_FOUND once the namespace is dropped
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (GoKv_WatchClient, error)
+	// Apply every operation of the batch or none of them
+	Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*Response, error)
+	// Create an empty namespace
+	CreateNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Response, error)
+	// Drop a namespace and every key in it
+	DropNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Response, error)
+	// List the names of the namespaces
+	ListNamespaces(ctx context.Context, in *ListNamespacesRequest, opts ...grpc.CallOption) (*NamespaceList, error)
+	// Run a transaction for the lifetime of the stream, each key is read when the transaction first uses it
+	// so values read may be from different points in time, COMMIT checks them and fails with ABORTED
+	// if another writer changed one of them, closing the stream rolls back
+	// the transaction runs in the namespace of the key of the first request
+	Transaction(ctx context.Context, opts ...grpc.CallOption) (GoKv_TransactionClient, error)
+}
+
+type goKvClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGoKvClient(cc grpc.ClientConnInterface) GoKvClient {
+	return &goKvClient{cc}
+}
+
+func (c *goKvClient) Insert(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/Insert", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) Update(ctx context.Context, in *KeyValue, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/Update", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) Search(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/Search", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) Remove(ctx context.Context, in *Key, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) Patch(ctx context.Context, in *PatchRequest, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/Patch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) Increment(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error) {
+	out := new(IncrementResponse)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/Increment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (GoKv_ScanClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GoKv_serviceDesc.Streams[0], "/kv.GoKv/Scan", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goKvScanClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GoKv_ScanClient interface {
+	Recv() (*KeyValue, error)
+	grpc.ClientStream
+}
+
+type goKvScanClient struct {
+	grpc.ClientStream
+}
+
+func (x *goKvScanClient) Recv() (*KeyValue, error) {
+	m := new(KeyValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *goKvClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (GoKv_QueryClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GoKv_serviceDesc.Streams[1], "/kv.GoKv/Query", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goKvQueryClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GoKv_QueryClient interface {
+	Recv() (*KeyValue, error)
+	grpc.ClientStream
+}
+
+type goKvQueryClient struct {
+	grpc.ClientStream
+}
+
+func (x *goKvQueryClient) Recv() (*KeyValue, error) {
+	m := new(KeyValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *goKvClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (GoKv_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GoKv_serviceDesc.Streams[2], "/kv.GoKv/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goKvWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GoKv_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type goKvWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *goKvWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *goKvClient) Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/Batch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) CreateNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/CreateNamespace", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) DropNamespace(ctx context.Context, in *Namespace, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/DropNamespace", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) ListNamespaces(ctx context.Context, in *ListNamespacesRequest, opts ...grpc.CallOption) (*NamespaceList, error) {
+	out := new(NamespaceList)
+	err := c.cc.Invoke(ctx, "/kv.GoKv/ListNamespaces", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goKvClient) Transaction(ctx context.Context, opts ...grpc.CallOption) (GoKv_TransactionClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_GoKv_serviceDesc.Streams[3], "/kv.GoKv/Transaction", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goKvTransactionClient{stream}
+	return x, nil
+}
+
+type GoKv_TransactionClient interface {
+	Send(*TxnRequest) error
+	Recv() (*TxnResponse, error)
+	grpc.ClientStream
+}
+
+type goKvTransactionClient struct {
+	grpc.ClientStream
+}
+
+func (x *goKvTransactionClient) Send(m *TxnRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *goKvTransactionClient) Recv() (*TxnResponse, error) {
+	m := new(TxnResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GoKvServer is the server API for GoKv service.
+type GoKvServer interface {
+	// Insert key-value pairs
+	Insert(context.Context, *KeyValue) (*Response, error)
+	// Update key-value pairs
+	Update(context.Context, *KeyValue) (*Response, error)
+	// Search for value with key
+	Search(context.Context, *Key) (*Response, error)
+	// Remove a key-value pair with a key
+	Remove(context.Context, *Key) (*Response, error)
+	// Set or delete the fields listed in the mask, leaving the other fields of the value untouched
+	Patch(context.Context, *PatchRequest) (*Response, error)
+	// Add delta to an integer field, creating the field and the key if missing, and return the new value
+	Increment(context.Context, *IncrementRequest) (*IncrementResponse, error)
+	// Stream key-value pairs of a range or prefix in key order
+	Scan(*ScanRequest, GoKv_ScanServer) error
+	// Stream the key-value pairs whose field holds a value in key order, the field must be indexed
+	Query(*QueryRequest, GoKv_QueryServer) error
+	// Stream the changes of a key or prefix as they are applied, from start_revision
+	// fails with OUT_OF_RANGE if changes from start_revision are no longer kept
+	// and ends with NOT_FOUND once the namespace is dropped
+	Watch(*WatchRequest, GoKv_WatchServer) error
+	// Apply every operation of the batch or none of them
+	Batch(context.Context, *BatchRequest) (*Response, error)
+	// Create an empty namespace
+	CreateNamespace(context.Context, *Namespace) (*Response, error)
+	// Drop a namespace and every key in it
+	DropNamespace(context.Context, *Namespace) (*Response, error)
+	// List the names of the namespaces
+	ListNamespaces(context.Context, *ListNamespacesRequest) (*NamespaceList, error)
+	// Run a transaction for the lifetime of the stream, each key is read when the transaction first uses it
+	// so values read may be from different points in time, COMMIT checks them and fails with ABORTED
+	// if another writer changed one of them, closing the stream rolls back
+	// the transaction runs in the namespace of the key of the first request
+	Transaction(GoKv_TransactionServer) error
+}
+
+// UnimplementedGoKvServer can be embedded to have forward compatible implementations.
+type UnimplementedGoKvServer struct {
+}
+
+func (*UnimplementedGoKvServer) Insert(ctx context.Context, req *KeyValue) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Insert not implemented")
+}
+func (*UnimplementedGoKvServer) Update(ctx context.Context, req *KeyValue) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (*UnimplementedGoKvServer) Search(ctx context.Context, req *Key) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (*UnimplementedGoKvServer) Remove(ctx context.Context, req *Key) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (*UnimplementedGoKvServer) Patch(ctx context.Context, req *PatchRequest) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Patch not implemented")
+}
+func (*UnimplementedGoKvServer) Increment(ctx context.Context, req *IncrementRequest) (*IncrementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Increment not implemented")
+}
+func (*UnimplementedGoKvServer) Scan(req *ScanRequest, srv GoKv_ScanServer) error {
+	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (*UnimplementedGoKvServer) Query(req *QueryRequest, srv GoKv_QueryServer) error {
+	return status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (*UnimplementedGoKvServer) Watch(req *WatchRequest, srv GoKv_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (*UnimplementedGoKvServer) Batch(ctx context.Context, req *BatchRequest) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Batch not implemented")
+}
+func (*UnimplementedGoKvServer) CreateNamespace(ctx context.Context, req *Namespace) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateNamespace not implemented")
+}
+func (*UnimplementedGoKvServer) DropNamespace(ctx context.Context, req *Namespace) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DropNamespace not implemented")
+}
+func (*UnimplementedGoKvServer) ListNamespaces(ctx context.Context, req *ListNamespacesRequest) (*NamespaceList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNamespaces not implemented")
+}
+func (*UnimplementedGoKvServer) Transaction(srv GoKv_TransactionServer) error {
+	return status.Errorf(codes.Unimplemented, "method Transaction not implemented")
+}
+
+func RegisterGoKvServer(s *grpc.Server, srv GoKvServer) {
+	s.RegisterService(&_GoKv_serviceDesc, srv)
+}
+
+func _GoKv_Insert_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).Insert(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/Insert",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).Insert(ctx, req.(*KeyValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/Update",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).Update(ctx, req.(*KeyValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/Search",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).Search(ctx, req.(*Key))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Key)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
 		FullMethod: "/kv.GoKv/Remove",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
@@ -403,6 +1626,203 @@ func _GoKv_Remove_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GoKv_Patch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).Patch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/Patch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).Patch(ctx, req.(*PatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_Increment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrementRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).Increment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/Increment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).Increment(ctx, req.(*IncrementRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GoKvServer).Scan(m, &goKvScanServer{stream})
+}
+
+type GoKv_ScanServer interface {
+	Send(*KeyValue) error
+	grpc.ServerStream
+}
+
+type goKvScanServer struct {
+	grpc.ServerStream
+}
+
+func (x *goKvScanServer) Send(m *KeyValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GoKv_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GoKvServer).Query(m, &goKvQueryServer{stream})
+}
+
+type GoKv_QueryServer interface {
+	Send(*KeyValue) error
+	grpc.ServerStream
+}
+
+type goKvQueryServer struct {
+	grpc.ServerStream
+}
+
+func (x *goKvQueryServer) Send(m *KeyValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GoKv_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GoKvServer).Watch(m, &goKvWatchServer{stream})
+}
+
+type GoKv_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type goKvWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *goKvWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _GoKv_Batch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).Batch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/Batch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).Batch(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_CreateNamespace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Namespace)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).CreateNamespace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/CreateNamespace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).CreateNamespace(ctx, req.(*Namespace))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_DropNamespace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Namespace)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).DropNamespace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/DropNamespace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).DropNamespace(ctx, req.(*Namespace))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_ListNamespaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNamespacesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoKvServer).ListNamespaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv.GoKv/ListNamespaces",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoKvServer).ListNamespaces(ctx, req.(*ListNamespacesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GoKv_Transaction_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GoKvServer).Transaction(&goKvTransactionServer{stream})
+}
+
+type GoKv_TransactionServer interface {
+	Send(*TxnResponse) error
+	Recv() (*TxnRequest, error)
+	grpc.ServerStream
+}
+
+type goKvTransactionServer struct {
+	grpc.ServerStream
+}
+
+func (x *goKvTransactionServer) Send(m *TxnResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *goKvTransactionServer) Recv() (*TxnRequest, error) {
+	m := new(TxnRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _GoKv_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "kv.GoKv",
 	HandlerType: (*GoKvServer)(nil),
@@ -423,7 +1843,53 @@ var _GoKv_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Remove",
 			Handler:    _GoKv_Remove_Handler,
 		},
+		{
+			MethodName: "Patch",
+			Handler:    _GoKv_Patch_Handler,
+		},
+		{
+			MethodName: "Increment",
+			Handler:    _GoKv_Increment_Handler,
+		},
+		{
+			MethodName: "Batch",
+			Handler:    _GoKv_Batch_Handler,
+		},
+		{
+			MethodName: "CreateNamespace",
+			Handler:    _GoKv_CreateNamespace_Handler,
+		},
+		{
+			MethodName: "DropNamespace",
+			Handler:    _GoKv_DropNamespace_Handler,
+		},
+		{
+			MethodName: "ListNamespaces",
+			Handler:    _GoKv_ListNamespaces_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _GoKv_Scan_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Query",
+			Handler:       _GoKv_Query_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _GoKv_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Transaction",
+			Handler:       _GoKv_Transaction_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "gokv.proto",
 }
@@ -5,37 +5,94 @@ import (
 	"errors"
 	"fmt"
 	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/cdc"
+	"github.com/tPhume/gokv/namespace"
 	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/txn"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"io"
+	"strings"
+	"time"
 )
 
 var keyDoesNotExist = errors.New("key does not exist")
 
+const errorNegativeTTL = "ttl cannot be negative"
+
 // Will return standalone gRPC server
 func DefaultGrpcServer() *grpc.Server {
 	grpcServer := grpc.NewServer()
-	RegisterGoKvServer(grpcServer, &GrpcServer{store: btree.NewBtree(3)})
+	RegisterGoKvServer(grpcServer, &GrpcServer{
+		store:      store.NewSyncStore(btree.NewBtree(3)),
+		namespaces: namespace.NewRegistry(namespace.DefaultFactory),
+	})
 
 	return grpcServer
 }
 
 // Create grpc with store as parameter
+// gRPC serves requests concurrently, so store must be safe for concurrent use (see store.SyncStore)
 func GrpcWithStore(store store.Store) *grpc.Server {
 	grpcServer := grpc.NewServer()
-	RegisterGoKvServer(grpcServer, &GrpcServer{store: store})
+	RegisterGoKvServer(grpcServer, &GrpcServer{
+		store:      store,
+		namespaces: namespace.NewRegistry(namespace.DefaultFactory),
+	})
+
+	return grpcServer
+}
+
+// Create grpc with store as the default namespace and namespaces for the others
+// pass the same registry to RestWithNamespaces to share the namespaces with the REST server
+func GrpcWithNamespaces(store store.Store, namespaces *namespace.Registry) *grpc.Server {
+	return GrpcWithConfig(Config{Store: store, Namespaces: namespaces})
+}
+
+// Create grpc from config
+func GrpcWithConfig(config Config) *grpc.Server {
+	grpcServer := grpc.NewServer()
+	RegisterGoKvServer(grpcServer, &GrpcServer{store: reportChanges(config.Store, config.Changes, ""), namespaces: config.namespaces(), changes: config.Changes})
 
 	return grpcServer
 }
 
 // GrpcServer implements GoKv server which is generated by gRPC
 type GrpcServer struct {
-	store store.Store
+	store      store.Store
+	namespaces *namespace.Registry
+	// nil if Watch is not served
+	changes *cdc.Log
+}
+
+// returns the store of the namespace, the default store for an empty name
+func (g *GrpcServer) namespace(name string) (store.Store, error) {
+	if name == "" {
+		return g.store, nil
+	}
+
+	s, err := g.namespaces.Get(name)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	}
+
+	return reportChanges(s, g.changes, name), nil
 }
 
 func (g *GrpcServer) Insert(ctx context.Context, kv *KeyValue) (*Response, error) {
-	if err := g.store.Insert(kv.Key.Key, kv.Value.Value); err != nil {
+	s, err := g.namespace(kv.GetKey().GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	if kv.GetTtl() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, errorNegativeTTL)
+	}
+
+	if err := store.InsertTTL(s, kv.Key.Key, kv.Value.Value, ttl(kv)); err == store.ErrTTLNotSupported {
+		return nil, status.Errorf(codes.Unimplemented, err.Error())
+	} else if err != nil {
 		return nil, status.Errorf(codes.Internal, err.Error())
 	}
 
@@ -43,31 +100,528 @@ func (g *GrpcServer) Insert(ctx context.Context, kv *KeyValue) (*Response, error
 }
 
 func (g *GrpcServer) Update(ctx context.Context, kv *KeyValue) (*Response, error) {
-	if err := g.store.Update(kv.GetKey().GetKey(), kv.GetValue().GetValue()); err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	s, err := g.namespace(kv.GetKey().GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	if kv.GetTtl() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, errorNegativeTTL)
+	}
+
+	if kv.GetExpectedVersion() != 0 {
+		if kv.GetTtl() != 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "ttl cannot be used with expected_version")
+		}
+
+		err = store.UpdateIf(s, kv.GetKey().GetKey(), kv.GetValue().GetValue(), kv.GetExpectedVersion())
+	} else {
+		err = store.UpdateTTL(s, kv.GetKey().GetKey(), kv.GetValue().GetValue(), ttl(kv))
+	}
+
+	if err != nil {
+		return nil, writeStatus(err)
 	}
 
 	return &Response{Message: fmt.Sprintf("key %v updated", kv.Key.Key)}, nil
 }
 
+// utility function that returns the ttl of kv as a duration
+func ttl(kv *KeyValue) time.Duration {
+	return time.Duration(kv.GetTtl()) * time.Millisecond
+}
+
+// Search returns the value of the key, only the fields listed in k.fields if any
 func (g *GrpcServer) Search(ctx context.Context, k *Key) (*Response, error) {
-	val := g.store.Search(k.GetKey())
+	s, err := g.namespace(k.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	val, version := store.SearchVersion(s, k.GetKey())
 	if val == nil {
 		return nil, status.Errorf(codes.InvalidArgument, keyDoesNotExist.Error())
 	}
 
+	if len(k.GetFields()) != 0 {
+		projected := make(store.Value, len(k.GetFields()))
+		for _, field := range k.GetFields() {
+			if v, ok := val[field]; ok {
+				projected[field] = v
+			}
+		}
+
+		val = projected
+	}
+
 	value := &Value{Value: val}
 
 	return &Response{
 		Message: fmt.Sprintf("key %v found", k.GetKey()),
-		Kv:      &KeyValue{Key: k, Value: value},
+		Kv:      &KeyValue{Key: k, Value: value, Version: version},
 	}, nil
 }
 
 func (g *GrpcServer) Remove(ctx context.Context, k *Key) (*Response, error) {
-	if err := g.store.Remove(k.GetKey()); err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	s, err := g.namespace(k.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	if k.GetExpectedVersion() != 0 {
+		err = store.RemoveIf(s, k.GetKey(), k.GetExpectedVersion())
+	} else {
+		err = s.Remove(k.GetKey())
+	}
+
+	if err != nil {
+		return nil, writeStatus(err)
 	}
 
 	return &Response{Message: fmt.Sprintf("key %v deleted", k.GetKey())}, nil
 }
+
+// Patch sets the fields of the mask found in the value and deletes the others
+// without a mask every field of the value is set, key.expected_version makes the patch conditional
+func (g *GrpcServer) Patch(ctx context.Context, req *PatchRequest) (*Response, error) {
+	s, err := g.namespace(req.GetKey().GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	key := req.GetKey().GetKey()
+	value := req.GetValue().GetValue()
+
+	set := make(store.Value)
+	var remove []string
+	if len(req.GetMask().GetPaths()) == 0 {
+		for field, v := range value {
+			set[field] = v
+		}
+	}
+
+	for _, field := range req.GetMask().GetPaths() {
+		if v, ok := value[field]; ok {
+			set[field] = v
+		} else {
+			remove = append(remove, field)
+		}
+	}
+
+	if version := req.GetKey().GetExpectedVersion(); version != 0 {
+		// UpdateIf fails if the key changed after it was read, so the merge is never based on a stale value
+		current, _ := store.SearchVersion(s, key)
+		if current == nil {
+			err = store.KeyDoesNotExist
+		} else {
+			err = store.UpdateIf(s, key, store.MergeValue(current, set, remove), version)
+		}
+	} else {
+		err = store.Patch(s, key, set, remove)
+	}
+
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+
+	return &Response{Message: fmt.Sprintf("key %v patched", key)}, nil
+}
+
+// Increment adds delta to an integer field of the value
+func (g *GrpcServer) Increment(ctx context.Context, req *IncrementRequest) (*IncrementResponse, error) {
+	s, err := g.namespace(req.GetKey().GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := store.Increment(s, req.GetKey().GetKey(), req.GetField(), req.GetDelta())
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+
+	return &IncrementResponse{Value: value}, nil
+}
+
+func (g *GrpcServer) CreateNamespace(ctx context.Context, ns *Namespace) (*Response, error) {
+	switch _, err := g.namespaces.Create(ns.GetName()); err {
+	case nil:
+		return &Response{Message: fmt.Sprintf("namespace %v created", ns.GetName())}, nil
+	case namespace.ErrBadName:
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	case namespace.ErrExists:
+		return nil, status.Errorf(codes.AlreadyExists, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+}
+
+func (g *GrpcServer) DropNamespace(ctx context.Context, ns *Namespace) (*Response, error) {
+	switch err := g.namespaces.Drop(ns.GetName()); err {
+	case nil:
+		return &Response{Message: fmt.Sprintf("namespace %v dropped", ns.GetName())}, nil
+	case namespace.ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	default:
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+}
+
+func (g *GrpcServer) ListNamespaces(ctx context.Context, req *ListNamespacesRequest) (*NamespaceList, error) {
+	return &NamespaceList{Names: g.namespaces.List()}, nil
+}
+
+// utility function that maps an error of Update, Patch, Increment or Remove to its status
+// a missing key stays InvalidArgument, as it always was for these calls
+func writeStatus(err error) error {
+	switch err {
+	case store.ErrVersionMismatch:
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	case store.ErrTTLNotSupported, store.ErrVersionNotSupported:
+		return status.Errorf(codes.Unimplemented, err.Error())
+	case store.ErrNotInteger:
+		return status.Errorf(codes.FailedPrecondition, err.Error())
+	case store.ErrOverflow:
+		return status.Errorf(codes.OutOfRange, err.Error())
+	}
+
+	return status.Errorf(codes.InvalidArgument, err.Error())
+}
+
+// Scan streams the key-value pairs of the requested range or prefix
+// the scan stops as soon as the client cancels the stream
+func (g *GrpcServer) Scan(req *ScanRequest, stream GoKv_ScanServer) error {
+	s, err := g.namespace(req.GetNamespace())
+	if err != nil {
+		return err
+	}
+
+	opts := store.ScanOptions{
+		Start:   req.GetStart(),
+		End:     req.GetEnd(),
+		Limit:   int(req.GetLimit()),
+		Reverse: req.GetReverse(),
+	}
+
+	if req.GetPrefix() != "" {
+		opts.Start = req.GetPrefix()
+		opts.End = store.PrefixEnd(req.GetPrefix())
+	}
+
+	return streamKeyValues(stream, func(fn store.ScanFunc) error {
+		return s.Scan(opts, fn)
+	})
+}
+
+// Query streams the key-value pairs whose field holds the requested value
+func (g *GrpcServer) Query(req *QueryRequest, stream GoKv_QueryServer) error {
+	s, err := g.namespace(req.GetNamespace())
+	if err != nil {
+		return err
+	}
+
+	opts := store.ScanOptions{Limit: int(req.GetLimit())}
+	if req.GetPrefix() != "" {
+		opts.Start = req.GetPrefix()
+		opts.End = store.PrefixEnd(req.GetPrefix())
+	}
+
+	return streamKeyValues(stream, func(fn store.ScanFunc) error {
+		return store.Query(s, req.GetField(), req.GetValue(), opts, fn)
+	})
+}
+
+// number of changes read from the log at a time by Watch
+const watchBatch = 100
+
+// Watch streams the changes of the log matching req until the client cancels the stream
+// or the namespace is dropped, which ends it with NotFound
+func (g *GrpcServer) Watch(req *WatchRequest, stream GoKv_WatchServer) error {
+	if g.changes == nil {
+		return status.Errorf(codes.Unimplemented, "server does not keep changes")
+	}
+
+	if _, err := g.namespace(req.GetNamespace()); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	var dropped <-chan struct{}
+	if req.GetNamespace() != "" {
+		done, err := g.namespaces.Done(req.GetNamespace())
+		if err != nil {
+			return status.Error(codes.NotFound, err.Error())
+		}
+
+		dropped = done
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	after := g.changes.Last()
+	if req.GetStartRevision() != 0 {
+		after = req.GetStartRevision() - 1
+	}
+
+	for {
+		events, err := g.changes.Read(after, watchBatch)
+		if err == cdc.ErrCompacted {
+			return status.Errorf(codes.OutOfRange, "changes after revision %d are no longer kept, the latest is %d", after, g.changes.Last())
+		}
+
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		for _, e := range events {
+			after = e.Seq
+			if !watches(e, req.GetNamespace(), req.GetKey(), req.GetPrefix()) {
+				continue
+			}
+
+			if err := stream.Send(watchEvent(e)); err != nil {
+				return err
+			}
+		}
+
+		if len(events) == 0 {
+			if err := g.changes.Wait(ctx, after); err != nil {
+				select {
+				case <-dropped:
+					return status.Error(codes.NotFound, namespace.ErrNotFound.Error())
+				default:
+					return err
+				}
+			}
+		}
+	}
+}
+
+// utility function that returns whether the change is to key in namespace, or to a key starting with prefix if key is empty
+func watches(e cdc.Event, namespace string, key string, prefix string) bool {
+	if e.Namespace != namespace {
+		return false
+	}
+
+	if key != "" {
+		return e.Key == key
+	}
+
+	return strings.HasPrefix(e.Key, prefix)
+}
+
+func watchEvent(e cdc.Event) *WatchEvent {
+	event := &WatchEvent{Kv: &KeyValue{Key: &Key{Key: e.Key}}, Revision: e.Seq}
+	if e.Op == cdc.OpRemove {
+		event.Type = WatchEvent_DELETE
+	} else {
+		event.Kv.Value = &Value{Value: e.Value}
+	}
+
+	return event
+}
+
+// server side of the streams sending key-value pairs
+type keyValueStream interface {
+	Send(*KeyValue) error
+	Context() context.Context
+}
+
+// utility function that sends every pair visited by visit, stopping as soon as the client cancels the stream
+func streamKeyValues(stream keyValueStream, visit func(store.ScanFunc) error) error {
+	ctx := stream.Context()
+
+	var streamErr error
+	err := visit(func(key string, value store.Value) bool {
+		if ctx.Err() != nil {
+			streamErr = ctx.Err()
+			return false
+		}
+
+		streamErr = stream.Send(&KeyValue{Key: &Key{Key: key}, Value: &Value{Value: value}})
+		return streamErr == nil
+	})
+
+	if err == store.ErrNotIndexed {
+		return status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, err.Error())
+	}
+
+	switch streamErr {
+	case nil:
+		return nil
+	case context.Canceled:
+		return status.Errorf(codes.Canceled, streamErr.Error())
+	case context.DeadlineExceeded:
+		return status.Errorf(codes.DeadlineExceeded, streamErr.Error())
+	}
+
+	return streamErr
+}
+
+// Batch applies every operation of the request or none of them
+// inserts may have a ttl, and updates and removes an expected_version checked when the batch is applied
+func (g *GrpcServer) Batch(ctx context.Context, req *BatchRequest) (*Response, error) {
+	if len(req.GetOperations()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "batch cannot be empty")
+	}
+
+	s, err := g.namespace(req.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	batch := store.NewBatch()
+	// index in the request of every operation of the batch, a version check and its operation share it
+	indexes := make([]int, 0, len(req.GetOperations()))
+	for i, op := range req.GetOperations() {
+		key := op.GetKv().GetKey().GetKey()
+		value := op.GetKv().GetValue().GetValue()
+		if key == "" || strings.Contains(key, " ") {
+			return nil, status.Errorf(codes.InvalidArgument, "batch operation %d: key cannot be empty or contain white spaces", i)
+		}
+
+		ttl := ttl(op.GetKv())
+		if ttl < 0 || (ttl > 0 && op.GetType() != Operation_INSERT) {
+			return nil, status.Errorf(codes.InvalidArgument, "batch operation %d: ttl must be positive and only inserts have one", i)
+		}
+
+		if version := op.GetKv().GetExpectedVersion(); version != 0 {
+			if op.GetType() == Operation_INSERT {
+				return nil, status.Errorf(codes.InvalidArgument, "batch operation %d: inserts have no expected_version", i)
+			}
+
+			batch.CheckVersion(key, version)
+			indexes = append(indexes, i)
+		}
+
+		switch op.GetType() {
+		case Operation_INSERT:
+			if ttl > 0 {
+				batch.InsertExpire(key, value, time.Now().Add(ttl))
+			} else {
+				batch.Insert(key, value)
+			}
+		case Operation_UPDATE:
+			batch.Update(key, value)
+		case Operation_REMOVE:
+			batch.Remove(key)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, store.ErrUnknownOperation.Error())
+		}
+		indexes = append(indexes, i)
+	}
+
+	if err := store.ApplyBatch(s, batch); err != nil {
+		var batchErr *store.BatchError
+		if !errors.As(err, &batchErr) {
+			return nil, status.Errorf(codes.Internal, err.Error())
+		}
+
+		index := indexes[batchErr.Index]
+		switch batchErr.Err {
+		case store.KeyDoesNotExist:
+			return nil, status.Errorf(codes.InvalidArgument, "batch operation %d: %v", index, batchErr.Err)
+		case store.ErrCheckFailed:
+			return nil, status.Errorf(codes.FailedPrecondition, "batch operation %d: %v", index, store.ErrVersionMismatch)
+		case store.ErrTTLNotSupported:
+			return nil, status.Errorf(codes.Unimplemented, "batch operation %d: %v", index, batchErr.Err)
+		}
+
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	return &Response{Message: fmt.Sprintf("%v operations applied", len(req.GetOperations()))}, nil
+}
+
+// Transaction runs a txn.Txn for the lifetime of the stream, in the namespace of the first request
+// the session ends after COMMIT or ROLLBACK, a stream closed or failed before that rolls back
+func (g *GrpcServer) Transaction(stream GoKv_TransactionServer) error {
+	var t *txn.Txn
+	var name string
+	defer func() {
+		if t != nil {
+			t.Rollback()
+		}
+	}()
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if t == nil {
+			name = req.GetKv().GetKey().GetNamespace()
+			s, err := g.namespace(name)
+			if err != nil {
+				return err
+			}
+
+			t = txn.Begin(s)
+		} else if req.GetKv() != nil && req.GetKv().GetKey().GetNamespace() != name {
+			return status.Errorf(codes.InvalidArgument, "a transaction cannot span namespaces")
+		}
+
+		key := req.GetKv().GetKey().GetKey()
+		res := &TxnResponse{}
+
+		switch req.GetType() {
+		case TxnRequest_GET:
+			value, err := t.Get(key)
+			if err != nil {
+				return status.Errorf(codes.FailedPrecondition, err.Error())
+			}
+
+			res.Found = value != nil
+			res.Message = fmt.Sprintf("key %v found", key)
+			if !res.Found {
+				res.Message = keyDoesNotExist.Error()
+			}
+			res.Kv = &KeyValue{Key: &Key{Key: key}, Value: &Value{Value: value}}
+		case TxnRequest_PUT:
+			if err := t.Put(key, req.GetKv().GetValue().GetValue()); err != nil {
+				return status.Errorf(codes.FailedPrecondition, err.Error())
+			}
+
+			res.Message = fmt.Sprintf("key %v put", key)
+		case TxnRequest_DELETE:
+			if err := t.Delete(key); err == store.KeyDoesNotExist {
+				return status.Errorf(codes.InvalidArgument, err.Error())
+			} else if err != nil {
+				return status.Errorf(codes.FailedPrecondition, err.Error())
+			}
+
+			res.Message = fmt.Sprintf("key %v deleted", key)
+		case TxnRequest_COMMIT:
+			if err := t.Commit(); err == txn.ErrConflict {
+				return status.Errorf(codes.Aborted, err.Error())
+			} else if err != nil {
+				return status.Errorf(codes.Internal, err.Error())
+			}
+
+			return stream.Send(&TxnResponse{Message: "transaction committed"})
+		case TxnRequest_ROLLBACK:
+			return stream.Send(&TxnResponse{Message: "transaction rolled back"})
+		default:
+			return status.Errorf(codes.InvalidArgument, "unknown transaction request")
+		}
+
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
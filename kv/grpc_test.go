@@ -0,0 +1,601 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/cdc"
+	"github.com/tPhume/gokv/index"
+	"github.com/tPhume/gokv/store"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// starts a gRPC server over an in memory listener and returns a client connected to it
+func setUpGrpc(t *testing.T, s store.Store) (GoKvClient, func()) {
+	return setUpGrpcWithConfig(t, Config{Store: s})
+}
+
+func setUpGrpcWithConfig(t *testing.T, config Config) (GoKvClient, func()) {
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := GrpcWithConfig(config)
+	go grpcServer.Serve(lis)
+
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.Dial()
+	}
+
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewGoKvClient(conn), func() {
+		conn.Close()
+		grpcServer.Stop()
+	}
+}
+
+func TestGrpcScan(t *testing.T) {
+	tree := btree.NewBtree(3)
+	for i := 0; i < 20; i++ {
+		prefix := "user"
+		if i%2 == 1 {
+			prefix = "team"
+		}
+
+		key := fmt.Sprintf("%v:%02d", prefix, i)
+		if err := tree.Insert(key, store.Value{"key": key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, tearDown := setUpGrpc(t, tree)
+	defer tearDown()
+
+	scan := func(req *ScanRequest) []string {
+		stream, err := client.Scan(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var keys []string
+		for {
+			kv, err := stream.Recv()
+			if err == io.EOF {
+				return keys
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, kv.GetKey().GetKey(), kv.GetValue().GetValue()["key"])
+			keys = append(keys, kv.GetKey().GetKey())
+		}
+	}
+
+	// prefix
+	keys := scan(&ScanRequest{Prefix: "team:"})
+	assert.Len(t, keys, 10)
+	assert.Equal(t, "team:01", keys[0])
+	assert.Equal(t, "team:19", keys[9])
+
+	// range, limit and reverse
+	keys = scan(&ScanRequest{Start: "user:04", End: "user:12", Limit: 3, Reverse: true})
+	assert.Equal(t, []string{"user:10", "user:08", "user:06"}, keys)
+}
+
+// fakeScanServer cancels its context after the first key-value pair is sent
+type fakeScanServer struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	sent   int
+}
+
+func (f *fakeScanServer) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeScanServer) Send(kv *KeyValue) error {
+	f.sent++
+	f.cancel()
+
+	return nil
+}
+
+func TestGrpcScanCancel(t *testing.T) {
+	tree := btree.NewBtree(3)
+	for i := 0; i < 10; i++ {
+		if err := tree.Insert(fmt.Sprint(i), store.Value{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &fakeScanServer{ctx: ctx, cancel: cancel}
+
+	err := (&GrpcServer{store: tree}).Scan(&ScanRequest{}, stream)
+
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.Equal(t, 1, stream.sent)
+}
+
+func TestGrpcBatch(t *testing.T) {
+	client, tearDown := setUpGrpc(t, store.NewSyncStore(btree.NewBtree(3)))
+	defer tearDown()
+
+	ctx := context.Background()
+	operation := func(opType Operation_Type, key string) *Operation {
+		return &Operation{
+			Type: opType,
+			Kv:   &KeyValue{Key: &Key{Key: key}, Value: &Value{Value: store.Value{"val": key}}},
+		}
+	}
+
+	_, err := client.Batch(ctx, &BatchRequest{Operations: []*Operation{
+		operation(Operation_INSERT, "A"),
+		operation(Operation_INSERT, "B"),
+		operation(Operation_REMOVE, "A"),
+	}})
+	assert.NoError(t, err)
+
+	_, err = client.Batch(ctx, &BatchRequest{Operations: []*Operation{
+		operation(Operation_INSERT, "C"),
+		operation(Operation_UPDATE, "A"),
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Search(ctx, &Key{Key: "C"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	response, err := client.Search(ctx, &Key{Key: "B"})
+	assert.NoError(t, err)
+	assert.Equal(t, "B", response.GetKv().GetValue().GetValue()["val"])
+
+	// fields of the operations are honoured, or rejected
+	expiring := operation(Operation_INSERT, "D")
+	expiring.Kv.Ttl = 60000
+	_, err = client.Batch(ctx, &BatchRequest{Operations: []*Operation{expiring}})
+	assert.NoError(t, err)
+
+	negative := operation(Operation_INSERT, "E")
+	negative.Kv.Ttl = -1
+	_, err = client.Batch(ctx, &BatchRequest{Operations: []*Operation{negative}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Batch(ctx, &BatchRequest{Operations: []*Operation{operation(Operation_INSERT, "bad key")}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	assert.NotZero(t, response.GetKv().GetVersion())
+	checked := operation(Operation_UPDATE, "B")
+	checked.Kv.ExpectedVersion = response.GetKv().GetVersion() + 1
+	_, err = client.Batch(ctx, &BatchRequest{Operations: []*Operation{operation(Operation_INSERT, "F"), checked}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "batch operation 1")
+
+	checked.Kv.ExpectedVersion = response.GetKv().GetVersion()
+	_, err = client.Batch(ctx, &BatchRequest{Operations: []*Operation{checked}})
+	assert.NoError(t, err)
+}
+
+func TestGrpcTransaction(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	s.Insert("A", store.Value{"val": "A"})
+
+	client, tearDown := setUpGrpc(t, s)
+	defer tearDown()
+
+	request := func(reqType TxnRequest_Type, key string, value store.Value) *TxnRequest {
+		return &TxnRequest{Type: reqType, Kv: &KeyValue{Key: &Key{Key: key}, Value: &Value{Value: value}}}
+	}
+
+	// read A, write B from it, then commit
+	stream, err := client.Transaction(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, stream.Send(request(TxnRequest_GET, "A", nil)))
+	response, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.True(t, response.GetFound())
+	assert.Equal(t, "A", response.GetKv().GetValue().GetValue()["val"])
+
+	assert.NoError(t, stream.Send(request(TxnRequest_PUT, "B", store.Value{"val": "from A"})))
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	assert.NoError(t, stream.Send(request(TxnRequest_COMMIT, "", nil)))
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "from A", s.Search("B")["val"])
+
+	// another writer changes A before commit
+	stream, err = client.Transaction(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, stream.Send(request(TxnRequest_GET, "A", nil)))
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	s.Insert("A", store.Value{"val": "other A"})
+
+	assert.NoError(t, stream.Send(request(TxnRequest_DELETE, "B", nil)))
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	assert.NoError(t, stream.Send(request(TxnRequest_COMMIT, "", nil)))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.NotNil(t, s.Search("B"))
+
+	// closing the stream rolls back
+	stream, err = client.Transaction(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, stream.Send(request(TxnRequest_PUT, "C", store.Value{"val": "C"})))
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	assert.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, s.Search("C"))
+}
+
+func TestGrpcTTL(t *testing.T) {
+	client, tearDown := setUpGrpc(t, store.NewSyncStore(btree.NewBtree(3)))
+	defer tearDown()
+
+	ctx := context.Background()
+	kv := &KeyValue{Key: &Key{Key: "session"}, Value: &Value{Value: store.Value{"user": "A"}}, Ttl: 20}
+
+	_, err := client.Insert(ctx, kv)
+	assert.NoError(t, err)
+
+	_, err = client.Search(ctx, &Key{Key: "session"})
+	assert.NoError(t, err)
+
+	time.Sleep(30 * time.Millisecond)
+
+	_, err = client.Search(ctx, &Key{Key: "session"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Update(ctx, kv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// a negative ttl is rejected rather than ignored
+	client.Insert(ctx, &KeyValue{Key: &Key{Key: "session"}, Value: &Value{Value: store.Value{"user": "A"}}})
+	negative := &KeyValue{Key: &Key{Key: "session"}, Value: &Value{Value: store.Value{"user": "B"}}, Ttl: -1}
+
+	_, err = client.Insert(ctx, negative)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Update(ctx, negative)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	response, err := client.Search(ctx, &Key{Key: "session"})
+	assert.NoError(t, err)
+	assert.Equal(t, "A", response.GetKv().GetValue().GetValue()["user"])
+
+	// stores without expiry reject a ttl
+	plain, tearDownLess := setUpGrpc(t, store.NewSyncStore(noTTLStore{btree.NewBtree(3)}))
+	defer tearDownLess()
+
+	_, err = plain.Insert(ctx, kv)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+// hides the expiry methods of the store it embeds
+type noTTLStore struct {
+	store.Store
+}
+
+func TestGrpcExpectedVersion(t *testing.T) {
+	client, tearDown := setUpGrpc(t, store.NewSyncStore(btree.NewBtree(3)))
+	defer tearDown()
+
+	ctx := context.Background()
+	_, err := client.Insert(ctx, &KeyValue{Key: &Key{Key: "A"}, Value: &Value{Value: store.Value{"val": "A"}}})
+	assert.NoError(t, err)
+
+	response, err := client.Search(ctx, &Key{Key: "A"})
+	assert.NoError(t, err)
+	version := response.GetKv().GetVersion()
+	assert.NotZero(t, version)
+
+	update := &KeyValue{Key: &Key{Key: "A"}, Value: &Value{Value: store.Value{"val": "new A"}}, ExpectedVersion: version}
+	_, err = client.Update(ctx, update)
+	assert.NoError(t, err)
+
+	_, err = client.Update(ctx, update)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Remove(ctx, &Key{Key: "A", ExpectedVersion: version})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	response, err = client.Search(ctx, &Key{Key: "A"})
+	assert.NoError(t, err)
+	assert.Equal(t, "new A", response.GetKv().GetValue().GetValue()["val"])
+
+	_, err = client.Remove(ctx, &Key{Key: "A", ExpectedVersion: response.GetKv().GetVersion()})
+	assert.NoError(t, err)
+}
+
+func TestGrpcPatch(t *testing.T) {
+	client, tearDown := setUpGrpc(t, store.NewSyncStore(btree.NewBtree(3)))
+	defer tearDown()
+
+	ctx := context.Background()
+	_, err := client.Insert(ctx, &KeyValue{
+		Key:   &Key{Key: "user"},
+		Value: &Value{Value: store.Value{"name": "A", "email": "a@gokv", "phone": "000"}},
+	})
+	assert.NoError(t, err)
+
+	// city is not in the mask so it is ignored, phone is in the mask but not in the value so it is deleted
+	_, err = client.Patch(ctx, &PatchRequest{
+		Key:   &Key{Key: "user"},
+		Value: &Value{Value: store.Value{"email": "new@gokv", "city": "BKK"}},
+		Mask:  &field_mask.FieldMask{Paths: []string{"email", "phone"}},
+	})
+	assert.NoError(t, err)
+
+	response, err := client.Search(ctx, &Key{Key: "user"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"name": "A", "email": "new@gokv"}, response.GetKv().GetValue().GetValue())
+
+	// without a mask every field of the value is set
+	_, err = client.Patch(ctx, &PatchRequest{
+		Key:   &Key{Key: "user", ExpectedVersion: response.GetKv().GetVersion()},
+		Value: &Value{Value: store.Value{"city": "BKK"}},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Patch(ctx, &PatchRequest{
+		Key:   &Key{Key: "user", ExpectedVersion: response.GetKv().GetVersion()},
+		Value: &Value{Value: store.Value{"city": "CNX"}},
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	response, err = client.Search(ctx, &Key{Key: "user"})
+	assert.NoError(t, err)
+	assert.Equal(t, "BKK", response.GetKv().GetValue().GetValue()["city"])
+
+	_, err = client.Patch(ctx, &PatchRequest{Key: &Key{Key: "nobody"}, Value: &Value{Value: store.Value{"name": "A"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGrpcSearchFields(t *testing.T) {
+	client, tearDown := setUpGrpc(t, store.NewSyncStore(btree.NewBtree(3)))
+	defer tearDown()
+
+	ctx := context.Background()
+	_, err := client.Insert(ctx, &KeyValue{
+		Key:   &Key{Key: "user"},
+		Value: &Value{Value: store.Value{"name": "A", "email": "a@gokv", "phone": "000"}},
+	})
+	assert.NoError(t, err)
+
+	response, err := client.Search(ctx, &Key{Key: "user", Fields: []string{"email", "city"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"email": "a@gokv"}, response.GetKv().GetValue().GetValue())
+
+	response, err = client.Search(ctx, &Key{Key: "user"})
+	assert.NoError(t, err)
+	assert.Len(t, response.GetKv().GetValue().GetValue(), 3)
+}
+
+func TestGrpcIncrement(t *testing.T) {
+	client, tearDown := setUpGrpc(t, store.NewSyncStore(btree.NewBtree(3)))
+	defer tearDown()
+
+	ctx := context.Background()
+	response, err := client.Increment(ctx, &IncrementRequest{Key: &Key{Key: "job"}, Field: "retries", Delta: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), response.GetValue())
+
+	response, err = client.Increment(ctx, &IncrementRequest{Key: &Key{Key: "job"}, Field: "retries", Delta: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), response.GetValue())
+
+	_, err = client.Patch(ctx, &PatchRequest{Key: &Key{Key: "job"}, Value: &Value{Value: store.Value{"state": "failed"}}})
+	assert.NoError(t, err)
+
+	_, err = client.Increment(ctx, &IncrementRequest{Key: &Key{Key: "job"}, Field: "state", Delta: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestGrpcQuery(t *testing.T) {
+	indexed, err := index.NewStore(btree.NewBtree(3), "city")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, tearDown := setUpGrpc(t, store.NewSyncStore(indexed))
+	defer tearDown()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		city := "BKK"
+		if i%2 == 0 {
+			city = "CNX"
+		}
+
+		_, err := client.Insert(ctx, &KeyValue{Key: &Key{Key: fmt.Sprintf("user:%d", i)}, Value: &Value{Value: store.Value{"city": city}}})
+		assert.NoError(t, err)
+	}
+
+	stream, err := client.Query(ctx, &QueryRequest{Field: "city", Value: "BKK"})
+	assert.NoError(t, err)
+
+	var keys []string
+	for {
+		kv, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		assert.NoError(t, err)
+		keys = append(keys, kv.GetKey().GetKey())
+	}
+	assert.Equal(t, []string{"user:1", "user:3"}, keys)
+
+	stream, err = client.Query(ctx, &QueryRequest{Field: "name", Value: "A"})
+	assert.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGrpcNamespaces(t *testing.T) {
+	client, tearDown := setUpGrpc(t, store.NewSyncStore(btree.NewBtree(3)))
+	defer tearDown()
+
+	ctx := context.Background()
+	_, err := client.CreateNamespace(ctx, &Namespace{Name: "team-a"})
+	assert.NoError(t, err)
+
+	_, err = client.CreateNamespace(ctx, &Namespace{Name: "team-a"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	list, err := client.ListNamespaces(ctx, &ListNamespacesRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"team-a"}, list.GetNames())
+
+	_, err = client.Insert(ctx, &KeyValue{Key: &Key{Key: "config"}, Value: &Value{Value: store.Value{"owner": "default"}}})
+	assert.NoError(t, err)
+
+	_, err = client.Insert(ctx, &KeyValue{Key: &Key{Key: "config", Namespace: "team-a"}, Value: &Value{Value: store.Value{"owner": "a"}}})
+	assert.NoError(t, err)
+
+	response, err := client.Search(ctx, &Key{Key: "config", Namespace: "team-a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", response.GetKv().GetValue().GetValue()["owner"])
+
+	response, err = client.Search(ctx, &Key{Key: "config"})
+	assert.NoError(t, err)
+	assert.Equal(t, "default", response.GetKv().GetValue().GetValue()["owner"])
+
+	_, err = client.Batch(ctx, &BatchRequest{Namespace: "team-a", Operations: []*Operation{
+		{Type: Operation_REMOVE, Kv: &KeyValue{Key: &Key{Key: "config"}}},
+	}})
+	assert.NoError(t, err)
+
+	_, err = client.Search(ctx, &Key{Key: "config", Namespace: "team-a"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.DropNamespace(ctx, &Namespace{Name: "team-a"})
+	assert.NoError(t, err)
+
+	_, err = client.Search(ctx, &Key{Key: "config", Namespace: "team-a"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGrpcWatch(t *testing.T) {
+	changes := cdc.NewLog(4)
+	// a store appending its changes already is not wrapped again
+	client, tearDown := setUpGrpcWithConfig(t, Config{
+		Store:   cdc.NewStore(store.NewSyncStore(btree.NewBtree(3)), changes, ""),
+		Changes: changes,
+	})
+	defer tearDown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	insert := func(key, n string) {
+		_, err := client.Insert(ctx, &KeyValue{Key: &Key{Key: key}, Value: &Value{Value: store.Value{"n": n}}})
+		assert.NoError(t, err)
+	}
+
+	// returns the next n events as "revision type key n" strings
+	recv := func(stream GoKv_WatchClient, n int) []string {
+		var events []string
+		for i := 0; i < n; i++ {
+			e, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			events = append(events, fmt.Sprintf("%d %v %v %v", e.GetRevision(), e.GetType(), e.GetKv().GetKey().GetKey(), e.GetKv().GetValue().GetValue()["n"]))
+		}
+
+		return events
+	}
+
+	insert("user:1", "1")
+
+	stream, err := client.Watch(ctx, &WatchRequest{Prefix: "user:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the watch only sees changes made after it started, and only to its prefix
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		insert("team:1", "1")
+		insert("user:2", "1")
+		client.Remove(ctx, &Key{Key: "user:1"})
+	}()
+
+	assert.Equal(t, []string{"3 PUT user:2 1", "4 DELETE user:1 "}, recv(stream, 2))
+
+	// resumes from a revision, watching a single key
+	stream, err = client.Watch(ctx, &WatchRequest{Key: "user:2", StartRevision: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert("user:2", "2")
+	assert.Equal(t, []string{"3 PUT user:2 1", "5 PUT user:2 2"}, recv(stream, 2))
+
+	// revision 1 left the log
+	stream, err = client.Watch(ctx, &WatchRequest{StartRevision: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	// the watch of a namespace ends once it is dropped
+	_, err = client.CreateNamespace(ctx, &Namespace{Name: "team-a"})
+	assert.NoError(t, err)
+
+	stream, err = client.Watch(ctx, &WatchRequest{Namespace: "team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.DropNamespace(ctx, &Namespace{Name: "team-a"})
+	}()
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// a server without changes does not serve Watch
+	noChanges, tearDownNoChanges := setUpGrpc(t, store.NewSyncStore(btree.NewBtree(3)))
+	defer tearDownNoChanges()
+
+	stream, err = noChanges.Watch(ctx, &WatchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
@@ -1,27 +1,83 @@
 package kv
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/cdc"
+	"github.com/tPhume/gokv/namespace"
 	"github.com/tPhume/gokv/store"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	errorWhiteSpaces = "bad format, key cannot contain white spaces"
 	errorValueEmpty  = "bad format, value cannot be empty"
 	errorBadJSON     = "bad format, json"
+	errorBadLimit    = "bad format, limit must be a number between 1 and 1000"
+	errorBadCursor   = "bad format, cursor"
+	errorBatchEmpty  = "bad format, batch cannot be empty"
+	errorBadOp       = "bad format, operation must be insert, update or remove"
+	errorBadTTL      = "bad format, ttl must be a positive duration such as 30s"
+	errorNoTTL       = "store does not support ttl"
+	errorBadIfMatch  = "bad format, If-Match must be an ETag returned by GET"
+	errorIfMatchTTL  = "bad format, ttl cannot be used with If-Match"
+	errorNoVersion   = "store does not support versions"
+	errorVersion     = "key was changed, version does not match If-Match"
+	errorBadPatch    = "bad format, merge patch fields must be strings or null"
+	errorBadBy       = "bad format, by must be an integer"
+	errorNotInteger  = "field is not an integer"
+	errorOverflow    = "counter overflow"
+	errorBadWhere    = "bad format, where must be field:value"
+	errorNotIndexed  = "field is not indexed"
+	errorReserved    = "bad format, key is reserved"
+	errorNoRoute     = "route not found"
+	errorBadAfter    = "bad format, after must be a sequence number"
+	errorCompacted   = "changes after this sequence number are no longer retained"
+	errorBadSnapshot = "bad format, snapshot"
+	errorRestoreRace = "store changed during the restore, nothing was restored, try again"
 	errorInternal    = "an error occurred"
 	errorKeyNotFound = "key not found"
+	errorNoField     = "field not found"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+
+	// POST on this key applies a batch instead of inserting it
+	// gin does not allow a static route next to :key
+	batchKey = "_batch"
+
+	// GET on this key lists the namespaces, and /ns/:namespace/... reaches the keys of a namespace
+	namespacesKey = "ns"
+
+	// GET on this key reads the changes made to every namespace
+	changesKey = "_changes"
+
+	// GET on /:key/watch streams the changes of the key as server-sent events, so it cannot be a field name
+	// and the list route takes it as a query parameter to stream the changes of a prefix
+	watchPath = "watch"
+
+	// an idle watch stream sends a comment this often, so proxies do not close it and dead clients are noticed
+	watchHeartbeat = 15 * time.Second
+
+	// PATCH with this content type merges the body into the value instead of replacing it
+	mergePatchType = "application/merge-patch+json"
 )
 
 // Returns gin's Engine that has KeyValue store handlers
 // Will return standalone Rest server
 func DefaultRestServer() *gin.Engine {
-	kvHandlers := NewKeyValueHandlers(btree.NewBtree(3))
+	kvHandlers := NewKeyValueHandlers(store.NewSyncStore(btree.NewBtree(3)))
 	router := gin.Default()
 	setHandlers(kvHandlers, router)
 
@@ -30,11 +86,12 @@ func DefaultRestServer() *gin.Engine {
 
 // Set default handlers given a gin Engine
 func DefaultRestWithEngine(router *gin.Engine) {
-	kvHandlers := NewKeyValueHandlers(btree.NewBtree(3))
+	kvHandlers := NewKeyValueHandlers(store.NewSyncStore(btree.NewBtree(3)))
 	setHandlers(kvHandlers, router)
 }
 
 // Create new Rest server with store as parameter
+// gin serves requests concurrently, so store must be safe for concurrent use (see store.SyncStore)
 func RestWithStore(store store.Store) *gin.Engine {
 	kvHandlers := NewKeyValueHandlers(store)
 	router := gin.Default()
@@ -43,28 +100,186 @@ func RestWithStore(store store.Store) *gin.Engine {
 	return router
 }
 
+// Create new Rest server with store as the default namespace and namespaces for the others
+// pass the same registry to GrpcWithNamespaces to share the namespaces with the gRPC server
+func RestWithNamespaces(store store.Store, namespaces *namespace.Registry) *gin.Engine {
+	return RestWithConfig(Config{Store: store, Namespaces: namespaces})
+}
+
+// Create new Rest server from config
+func RestWithConfig(config Config) *gin.Engine {
+	kvHandlers := &KeyValueHandlers{store: reportChanges(config.Store, config.Changes, ""), namespaces: config.namespaces(), changes: config.Changes}
+	router := gin.Default()
+	setHandlers(kvHandlers, router)
+
+	return router
+}
+
 // Utility function to set insert,update,search and delete routes
 func setHandlers(kvHandlers *KeyValueHandlers, r *gin.Engine) {
 	storeGroup := r.Group("/store")
 
 	storeGroupV1 := storeGroup.Group("/v1")
+	storeGroupV1.GET("", kvHandlers.list)
 	storeGroupV1.POST("/:key", kvHandlers.insert)
 	storeGroupV1.PATCH("/:key", kvHandlers.update)
 	storeGroupV1.GET("/:key", kvHandlers.search)
 	storeGroupV1.DELETE("/:key", kvHandlers.remove)
+
+	// gin does not allow static routes such as /ns next to :key, longer paths are routed by route
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		storeGroupV1.Handle(method, "/:key/*path", kvHandlers.route)
+	}
 }
 
 // Handles request to the store
 type KeyValueHandlers struct {
 	store store.Store
+	// nil for the handlers of a namespace, namespaces do not nest
+	namespaces *namespace.Registry
+	// name of the namespace of the handlers, empty for the default one
+	namespace string
+	// nil if changes are not served
+	changes *cdc.Log
+	// closed once the namespace of the handlers is dropped, nil for the default one
+	dropped <-chan struct{}
 }
 
+// namespaces created through the handlers are kept in memory
 func NewKeyValueHandlers(store store.Store) *KeyValueHandlers {
-	return &KeyValueHandlers{store: store}
+	return &KeyValueHandlers{store: store, namespaces: namespace.NewRegistry(namespace.DefaultFactory)}
+}
+
+// routes /:key/:field, /:key/:field/increment and the namespace paths
+// /ns/:namespace and /ns/:namespace/:key/... are routed like the same paths without the prefix
+func (kv *KeyValueHandlers) route(c *gin.Context) {
+	path := strings.Split(strings.TrimPrefix(c.Param("path"), "/"), "/")
+	for _, segment := range path {
+		if segment == "" {
+			c.JSON(http.StatusNotFound, gin.H{"message": errorNoRoute})
+			return
+		}
+	}
+
+	key := c.Param("key")
+	if key != namespacesKey || kv.namespaces == nil {
+		kv.routeKey(c, key, path)
+		return
+	}
+
+	name := path[0]
+	if len(path) == 1 {
+		switch c.Request.Method {
+		case http.MethodPut:
+			kv.createNamespace(c, name)
+			return
+		case http.MethodDelete:
+			kv.dropNamespace(c, name)
+			return
+		}
+	}
+
+	s, err := kv.namespaces.Get(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	dropped, err := kv.namespaces.Done(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	nsHandlers := &KeyValueHandlers{store: reportChanges(s, kv.changes, name), namespace: name, changes: kv.changes, dropped: dropped}
+	if len(path) == 1 {
+		if c.Request.Method != http.MethodGet {
+			c.JSON(http.StatusNotFound, gin.H{"message": errorNoRoute})
+			return
+		}
+
+		nsHandlers.list(c)
+		return
+	}
+
+	key = path[1]
+	if len(path) > 2 {
+		nsHandlers.routeKey(c, key, path[2:])
+		return
+	}
+
+	c.Params = gin.Params{{Key: "key", Value: key}}
+	switch c.Request.Method {
+	case http.MethodGet:
+		nsHandlers.search(c)
+	case http.MethodPost:
+		nsHandlers.insert(c)
+	case http.MethodPatch:
+		nsHandlers.update(c)
+	case http.MethodDelete:
+		nsHandlers.remove(c)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"message": errorNoRoute})
+	}
+}
+
+// routes the path following a key
+func (kv *KeyValueHandlers) routeKey(c *gin.Context, key string, path []string) {
+	c.Params = gin.Params{{Key: "key", Value: key}, {Key: "field", Value: path[0]}}
+
+	switch {
+	case len(path) == 1 && path[0] == watchPath && c.Request.Method == http.MethodGet && kv.changes != nil:
+		kv.watch(c, key, "")
+	case len(path) == 1 && c.Request.Method == http.MethodGet:
+		kv.searchField(c)
+	case len(path) == 2 && path[1] == "increment" && c.Request.Method == http.MethodPost:
+		kv.increment(c)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"message": errorNoRoute})
+	}
+}
+
+// responds with the names of the namespaces
+func (kv *KeyValueHandlers) listNamespaces(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"namespaces": kv.namespaces.List()})
+}
+
+func (kv *KeyValueHandlers) createNamespace(c *gin.Context, name string) {
+	switch _, err := kv.namespaces.Create(name); err {
+	case nil:
+		c.JSON(http.StatusCreated, gin.H{"message": fmt.Sprintf("namespace %v created", name)})
+	case namespace.ErrBadName:
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	case namespace.ErrExists:
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorInternal})
+	}
+}
+
+func (kv *KeyValueHandlers) dropNamespace(c *gin.Context, name string) {
+	switch err := kv.namespaces.Drop(name); err {
+	case nil:
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("namespace %v dropped", name)})
+	case namespace.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorInternal})
+	}
 }
 
 func (kv *KeyValueHandlers) insert(c *gin.Context) {
 	key := c.Param("key")
+	if key == batchKey {
+		kv.batch(c)
+		return
+	}
+
+	if key == namespacesKey || (kv.changes != nil && key == changesKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorReserved})
+		return
+	}
+
 	if strings.Contains(key, " ") {
 		c.JSON(http.StatusBadRequest, gin.H{"message": errorWhiteSpaces})
 		return
@@ -83,8 +298,13 @@ func (kv *KeyValueHandlers) insert(c *gin.Context) {
 		return
 	}
 
-	if err := kv.store.Insert(key, value); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": errorInternal})
+	ttl, ok := queryTTL(c)
+	if !ok {
+		return
+	}
+
+	if err := store.InsertTTL(kv.store, key, value, ttl); err != nil {
+		writeError(c, err)
 		return
 	}
 
@@ -98,6 +318,11 @@ func (kv *KeyValueHandlers) update(c *gin.Context) {
 		return
 	}
 
+	if c.ContentType() == mergePatchType {
+		kv.mergePatch(c)
+		return
+	}
+
 	body := c.Request.Body
 	if body == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": errorValueEmpty})
@@ -111,41 +336,542 @@ func (kv *KeyValueHandlers) update(c *gin.Context) {
 		return
 	}
 
-	if err := kv.store.Update(key, value); err == btree.KeyDoesNotExist {
-		c.JSON(http.StatusNotFound, gin.H{"message": errorKeyNotFound})
+	ttl, ok := queryTTL(c)
+	if !ok {
+		return
+	}
+
+	version, conditional, ok := headerIfMatch(c)
+	if !ok {
+		return
+	}
+
+	if conditional && ttl > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorIfMatchTTL})
+		return
+	}
+
+	if conditional {
+		err = store.UpdateIf(kv.store, key, value, version)
+	} else {
+		err = store.UpdateTTL(kv.store, key, value, ttl)
+	}
+
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%v updated", key)})
 }
 
+// utility function that reads the optional ttl query parameter, such as ?ttl=30s
+// responds with bad request and returns false if it is not a positive duration
+func queryTTL(c *gin.Context) (time.Duration, bool) {
+	t := c.Query("ttl")
+	if t == "" {
+		return 0, true
+	}
+
+	ttl, err := time.ParseDuration(t)
+	if err != nil || ttl <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorBadTTL})
+		return 0, false
+	}
+
+	return ttl, true
+}
+
 func (kv *KeyValueHandlers) search(c *gin.Context) {
 	key := c.Param("key")
+	if key == namespacesKey && kv.namespaces != nil {
+		kv.listNamespaces(c)
+		return
+	}
+
+	if key == changesKey && kv.changes != nil && kv.namespaces != nil {
+		kv.listChanges(c)
+		return
+	}
+
 	if strings.Contains(key, " ") {
 		c.JSON(http.StatusBadRequest, gin.H{"message": errorWhiteSpaces})
 		return
 	}
 
-	value := kv.store.Search(key)
+	value, version := store.SearchVersion(kv.store, key)
 	if value == nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": errorKeyNotFound})
 		return
 	}
 
+	if version != 0 {
+		c.Header("ETag", fmt.Sprintf(`"%d"`, version))
+	}
+
 	c.JSON(http.StatusOK, value)
 }
 
-func (kv *KeyValueHandlers) remove(c *gin.Context) {
+// returns a single field of the value as {"field": "value"}
+// the message of the not found response tells a missing key from a missing field
+func (kv *KeyValueHandlers) searchField(c *gin.Context) {
 	key := c.Param("key")
 	if strings.Contains(key, " ") {
 		c.JSON(http.StatusBadRequest, gin.H{"message": errorWhiteSpaces})
 		return
 	}
 
-	if err := kv.store.Remove(key); err != nil {
+	value, version := store.SearchVersion(kv.store, key)
+	if value == nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": errorKeyNotFound})
 		return
 	}
 
+	field := c.Param("field")
+	fieldValue, ok := value[field]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": errorNoField})
+		return
+	}
+
+	if version != 0 {
+		c.Header("ETag", fmt.Sprintf(`"%d"`, version))
+	}
+
+	c.JSON(http.StatusOK, store.Value{field: fieldValue})
+}
+
+// adds the by query parameter, 1 by default and negative to decrement, to an integer field
+// the field, and the key, are created if missing, responds with {"value": new value}
+func (kv *KeyValueHandlers) increment(c *gin.Context) {
+	key := c.Param("key")
+	if strings.Contains(key, " ") {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorWhiteSpaces})
+		return
+	}
+
+	delta := int64(1)
+	if by := c.Query("by"); by != "" {
+		var err error
+		if delta, err = strconv.ParseInt(by, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadBy})
+			return
+		}
+	}
+
+	value, err := store.Increment(kv.store, key, c.Param("field"), delta)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"value": value})
+}
+
+func (kv *KeyValueHandlers) remove(c *gin.Context) {
+	key := c.Param("key")
+	if strings.Contains(key, " ") {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorWhiteSpaces})
+		return
+	}
+
+	version, conditional, ok := headerIfMatch(c)
+	if !ok {
+		return
+	}
+
+	var err error
+	if conditional {
+		err = store.RemoveIf(kv.store, key, version)
+	} else {
+		err = kv.store.Remove(key)
+	}
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "key/value deleted"})
 }
+
+// applies a JSON Merge Patch (RFC 7396) to the value of the key
+// a string sets the field and null deletes it, the key must already exist
+// If-Match is honoured the same way as a full update
+func (kv *KeyValueHandlers) mergePatch(c *gin.Context) {
+	key := c.Param("key")
+
+	body := c.Request.Body
+	if body == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorValueEmpty})
+		return
+	}
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorBadJSON})
+		return
+	}
+
+	set := make(store.Value)
+	var remove []string
+	for field, value := range patch {
+		switch v := value.(type) {
+		case string:
+			set[field] = v
+		case nil:
+			remove = append(remove, field)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadPatch})
+			return
+		}
+	}
+
+	version, conditional, ok := headerIfMatch(c)
+	if !ok {
+		return
+	}
+
+	var err error
+	if conditional {
+		// UpdateIf fails if the key changed after it was read, so the merge is never based on a stale value
+		value, _ := store.SearchVersion(kv.store, key)
+		if value == nil {
+			err = store.KeyDoesNotExist
+		} else {
+			err = store.UpdateIf(kv.store, key, store.MergeValue(value, set, remove), version)
+		}
+	} else {
+		err = store.Patch(kv.store, key, set, remove)
+	}
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%v patched", key)})
+}
+
+// utility function that reads the version of an If-Match header holding an ETag returned by search
+// conditional is false without the header or with *, which only requires the key to exist
+// responds with bad request and returns ok false for any other value
+func headerIfMatch(c *gin.Context) (version uint64, conditional bool, ok bool) {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, false, true
+	}
+
+	version, err := strconv.ParseUint(strings.Trim(ifMatch, `"`), 10, 64)
+	if err != nil || version == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorBadIfMatch})
+		return 0, false, false
+	}
+
+	return version, true, true
+}
+
+// utility function that responds with the status matching an error of a single key write
+func writeError(c *gin.Context, err error) {
+	switch err {
+	case store.KeyDoesNotExist:
+		c.JSON(http.StatusNotFound, gin.H{"message": errorKeyNotFound})
+	case store.ErrVersionMismatch:
+		c.JSON(http.StatusPreconditionFailed, gin.H{"message": errorVersion})
+	case store.ErrTTLNotSupported:
+		c.JSON(http.StatusNotImplemented, gin.H{"message": errorNoTTL})
+	case store.ErrVersionNotSupported:
+		c.JSON(http.StatusNotImplemented, gin.H{"message": errorNoVersion})
+	case store.ErrNotInteger:
+		c.JSON(http.StatusConflict, gin.H{"message": errorNotInteger})
+	case store.ErrOverflow:
+		c.JSON(http.StatusConflict, gin.H{"message": errorOverflow})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorInternal})
+	}
+}
+
+// key-value pair returned by list
+type keyValueJSON struct {
+	Key   string      `json:"key"`
+	Value store.Value `json:"value"`
+}
+
+// lists key-value pairs starting with prefix in key order
+// where=field:value only lists the keys whose field holds value, using the index of that field
+// cursor is returned when there are more pairs, pass it back to get the next page
+// with the watch query parameter the changes of the keys starting with prefix are streamed instead
+func (kv *KeyValueHandlers) list(c *gin.Context) {
+	prefix := c.Query("prefix")
+	if _, ok := c.GetQuery(watchPath); ok && kv.changes != nil {
+		kv.watch(c, "", prefix)
+		return
+	}
+
+	limit := defaultListLimit
+	if l := c.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadLimit})
+			return
+		}
+	}
+
+	opts := store.ScanOptions{
+		Start: prefix,
+		End:   store.PrefixEnd(prefix),
+		Limit: limit + 1,
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		last, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || !strings.HasPrefix(string(last), prefix) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadCursor})
+			return
+		}
+
+		// smallest key after the last one returned
+		opts.Start = string(last) + "\x00"
+	}
+
+	items := make([]keyValueJSON, 0, limit)
+	more := false
+	collect := func(key string, value store.Value) bool {
+		if len(items) == limit {
+			more = true
+			return false
+		}
+
+		items = append(items, keyValueJSON{Key: key, Value: value})
+		return true
+	}
+
+	var err error
+	if where := c.Query("where"); where != "" {
+		field := strings.SplitN(where, ":", 2)
+		if len(field) != 2 || field[0] == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadWhere})
+			return
+		}
+
+		err = store.Query(kv.store, field[0], field[1], opts, collect)
+	} else {
+		err = kv.store.Scan(opts, collect)
+	}
+
+	if err == store.ErrNotIndexed {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorNotIndexed})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorInternal})
+		return
+	}
+
+	response := gin.H{"items": items}
+	if more {
+		response["cursor"] = base64.RawURLEncoding.EncodeToString([]byte(items[len(items)-1].Key))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// responds with the changes following the after sequence number, 0 for the oldest retained, in order
+// last is the sequence number of the last change made, pass the seq of the last event back as after to resume
+func (kv *KeyValueHandlers) listChanges(c *gin.Context) {
+	after := uint64(0)
+	if a := c.Query("after"); a != "" {
+		var err error
+		if after, err = strconv.ParseUint(a, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadAfter})
+			return
+		}
+	}
+
+	limit := defaultListLimit
+	if l := c.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadLimit})
+			return
+		}
+	}
+
+	events, err := kv.changes.Read(after, limit)
+	if err == cdc.ErrCompacted {
+		c.JSON(http.StatusGone, gin.H{"message": errorCompacted, "last": kv.changes.Last()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorInternal})
+		return
+	}
+
+	if events == nil {
+		events = []cdc.Event{}
+	}
+
+	// read after the events, so it is never behind them
+	last := kv.changes.Last()
+	c.JSON(http.StatusOK, gin.H{"events": events, "last": last})
+}
+
+// streams the changes of key, or of the keys starting with prefix when key is empty, as server-sent events
+// each event is named after its op and has the sequence number of the change as id, its data is {"key", "value"}
+// changes start after the Last-Event-ID header, sent by browsers when they reconnect, or the after query parameter
+// and otherwise with the changes made once the stream opened, the stream ends once the namespace is dropped
+func (kv *KeyValueHandlers) watch(c *gin.Context, key string, prefix string) {
+	after := kv.changes.Last()
+
+	a := c.GetHeader("Last-Event-ID")
+	if a == "" {
+		a = c.Query("after")
+	}
+
+	if a != "" {
+		var err error
+		if after, err = strconv.ParseUint(a, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadAfter})
+			return
+		}
+	}
+
+	// checked before streaming so the client gets a status rather than an empty stream
+	if _, err := kv.changes.Read(after, 1); err == cdc.ErrCompacted {
+		c.JSON(http.StatusGone, gin.H{"message": errorCompacted, "last": kv.changes.Last()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	// sends the headers at once, the first event may be a long way off
+	c.Writer.Flush()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	if kv.dropped != nil {
+		go func() {
+			select {
+			case <-kv.dropped:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		events, err := kv.changes.Read(after, watchBatch)
+		if err != nil {
+			// the stream fell behind the log, reconnecting tells the client with 410
+			return false
+		}
+
+		for _, e := range events {
+			after = e.Seq
+			if !watches(e, kv.namespace, key, prefix) {
+				continue
+			}
+
+			data, err := json.Marshal(keyValueJSON{Key: e.Key, Value: e.Value})
+			if err != nil {
+				return false
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %v\ndata: %s\n\n", e.Seq, e.Op, data); err != nil {
+				return false
+			}
+		}
+
+		if len(events) > 0 {
+			return true
+		}
+
+		waitCtx, cancelWait := context.WithTimeout(ctx, watchHeartbeat)
+		defer cancelWait()
+
+		err = kv.changes.Wait(waitCtx, after)
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		}
+
+		return err == nil
+	})
+}
+
+// operation of a batch request, op is insert, update or remove
+type batchOperationJSON struct {
+	Op    string      `json:"op"`
+	Key   string      `json:"key"`
+	Value store.Value `json:"value"`
+}
+
+type batchJSON struct {
+	Operations []batchOperationJSON `json:"operations"`
+}
+
+// applies every operation of the request or none of them
+func (kv *KeyValueHandlers) batch(c *gin.Context) {
+	body := c.Request.Body
+	if body == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorValueEmpty})
+		return
+	}
+
+	var request batchJSON
+	if err := json.NewDecoder(body).Decode(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorBadJSON})
+		return
+	}
+
+	if len(request.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": errorBatchEmpty})
+		return
+	}
+
+	batch := store.NewBatch()
+	for i, op := range request.Operations {
+		if op.Key == "" || strings.Contains(op.Key, " ") {
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorWhiteSpaces, "index": i})
+			return
+		}
+
+		switch op.Op {
+		case "insert", "update":
+			if op.Value == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": errorValueEmpty, "index": i})
+				return
+			}
+
+			if op.Op == "insert" {
+				batch.Insert(op.Key, op.Value)
+			} else {
+				batch.Update(op.Key, op.Value)
+			}
+		case "remove":
+			batch.Remove(op.Key)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"message": errorBadOp, "index": i})
+			return
+		}
+	}
+
+	if err := store.ApplyBatch(kv.store, batch); err != nil {
+		var batchErr *store.BatchError
+		if errors.As(err, &batchErr) && batchErr.Err == store.KeyDoesNotExist {
+			c.JSON(http.StatusNotFound, gin.H{"message": errorKeyNotFound, "index": batchErr.Index})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorInternal})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%v operations applied", batch.Len())})
+}
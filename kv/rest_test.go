@@ -1,14 +1,24 @@
 package kv
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/cdc"
+	"github.com/tPhume/gokv/index"
+	"github.com/tPhume/gokv/namespace"
 	"github.com/tPhume/gokv/store"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -188,3 +198,714 @@ func TestBadPath(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.Equal(t, errorKeyNotFound, resBody["message"])
 }
+
+func TestListPrefix(t *testing.T) {
+	setUp()
+
+	keys := []string{"user:1:profile", "user:2:profile", "user:3:profile", "team:1:profile"}
+	for _, key := range keys {
+		body, _ := json.Marshal(store.Value{"key": key})
+		req, _ := http.NewRequest("POST", "/store/v1/"+key, bytes.NewBuffer(body))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	type listBody struct {
+		Items  []keyValueJSON `json:"items"`
+		Cursor string         `json:"cursor"`
+	}
+
+	// first page
+	req, _ := http.NewRequest("GET", "/store/v1?prefix=user:&limit=2", nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody := listBody{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []keyValueJSON{
+		{Key: "user:1:profile", Value: store.Value{"key": "user:1:profile"}},
+		{Key: "user:2:profile", Value: store.Value{"key": "user:2:profile"}},
+	}, resBody.Items)
+	assert.NotEmpty(t, resBody.Cursor)
+
+	// second and last page
+	req, _ = http.NewRequest("GET", "/store/v1?prefix=user:&limit=2&cursor="+resBody.Cursor, nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody = listBody{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []keyValueJSON{
+		{Key: "user:3:profile", Value: store.Value{"key": "user:3:profile"}},
+	}, resBody.Items)
+	assert.Empty(t, resBody.Cursor)
+
+	// no prefix lists everything
+	req, _ = http.NewRequest("GET", "/store/v1", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody = listBody{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, resBody.Items, len(keys))
+
+	// bad limit
+	req, _ = http.NewRequest("GET", "/store/v1?limit=0", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	errBody := make(map[string]string)
+	_ = json.Unmarshal(w.Body.Bytes(), &errBody)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, errorBadLimit, errBody["message"])
+
+	// cursor outside of prefix
+	req, _ = http.NewRequest("GET", "/store/v1?prefix=team:&cursor=dXNlcg", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	errBody = make(map[string]string)
+	_ = json.Unmarshal(w.Body.Bytes(), &errBody)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, errorBadCursor, errBody["message"])
+}
+
+func TestBatch(t *testing.T) {
+	setUp()
+
+	body, _ := json.Marshal(happyTestBody)
+	req, _ := http.NewRequest("POST", "/store/v1/existing", bytes.NewBuffer(body))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// applied
+	req, _ = http.NewRequest("POST", "/store/v1/_batch", bytes.NewBufferString(`{"operations": [
+		{"op": "insert", "key": "first", "value": {"val": "first"}},
+		{"op": "update", "key": "existing", "value": {"val": "updated"}},
+		{"op": "remove", "key": "first"}
+	]}`))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody := make(map[string]interface{})
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3 operations applied", resBody["message"])
+
+	// not applied, second operation targets a missing key
+	req, _ = http.NewRequest("POST", "/store/v1/_batch", bytes.NewBufferString(`{"operations": [
+		{"op": "insert", "key": "second", "value": {"val": "second"}},
+		{"op": "remove", "key": "first"}
+	]}`))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody = make(map[string]interface{})
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, errorKeyNotFound, resBody["message"])
+	assert.Equal(t, float64(1), resBody["index"])
+
+	req, _ = http.NewRequest("GET", "/store/v1/second", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("GET", "/store/v1/existing", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	value := make(map[string]string)
+	_ = json.Unmarshal(w.Body.Bytes(), &value)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "updated", value["val"])
+
+	// unknown operation
+	req, _ = http.NewRequest("POST", "/store/v1/_batch", bytes.NewBufferString(`{"operations": [{"op": "upsert", "key": "a"}]}`))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody = make(map[string]interface{})
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, errorBadOp, resBody["message"])
+
+	// empty batch
+	req, _ = http.NewRequest("POST", "/store/v1/_batch", bytes.NewBufferString(`{"operations": []}`))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody = make(map[string]interface{})
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, errorBatchEmpty, resBody["message"])
+}
+
+func TestTTL(t *testing.T) {
+	setUp()
+
+	body, _ := json.Marshal(happyTestBody)
+	req, _ := http.NewRequest("POST", "/store/v1/session?ttl=20ms", bytes.NewBuffer(body))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	req, _ = http.NewRequest("GET", "/store/v1/session", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	time.Sleep(30 * time.Millisecond)
+
+	req, _ = http.NewRequest("GET", "/store/v1/session", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// bad ttl
+	for _, ttl := range []string{"soon", "-1s", "0"} {
+		req, _ = http.NewRequest("PATCH", "/store/v1/session?ttl="+ttl, bytes.NewBuffer(body))
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resBody := make(map[string]interface{})
+		_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, errorBadTTL, resBody["message"])
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	setUp()
+
+	body, _ := json.Marshal(happyTestBody)
+	req, _ := http.NewRequest("POST", "/store/v1/shared", bytes.NewBuffer(body))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/store/v1/shared", nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// first writer wins
+	newBody, _ := json.Marshal(newHappyTestBody)
+	req, _ = http.NewRequest("PATCH", "/store/v1/shared", bytes.NewBuffer(newBody))
+	req.Header.Set("If-Match", etag)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// second writer still holds the old ETag
+	req, _ = http.NewRequest("PATCH", "/store/v1/shared", bytes.NewBuffer(body))
+	req.Header.Set("If-Match", etag)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody := make(map[string]interface{})
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, errorVersion, resBody["message"])
+
+	req, _ = http.NewRequest("DELETE", "/store/v1/shared", nil)
+	req.Header.Set("If-Match", etag)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	req, _ = http.NewRequest("GET", "/store/v1/shared", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	value := make(map[string]string)
+	_ = json.Unmarshal(w.Body.Bytes(), &value)
+
+	assert.Equal(t, newHappyTestBody["newValue"], value["newValue"])
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	req, _ = http.NewRequest("DELETE", "/store/v1/shared", nil)
+	req.Header.Set("If-Match", w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// bad If-Match
+	req, _ = http.NewRequest("DELETE", "/store/v1/shared", nil)
+	req.Header.Set("If-Match", "latest")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMergePatch(t *testing.T) {
+	setUp()
+
+	req, _ := http.NewRequest("POST", "/store/v1/user", bytes.NewBufferString(`{"name": "A", "email": "a@gokv", "phone": "000"}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("PATCH", "/store/v1/user", bytes.NewBufferString(`{"email": "new@gokv", "phone": null}`))
+	req.Header.Set("Content-Type", mergePatchType)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/store/v1/user", nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	value := make(map[string]string)
+	_ = json.Unmarshal(w.Body.Bytes(), &value)
+
+	assert.Equal(t, map[string]string{"name": "A", "email": "new@gokv"}, value)
+
+	// stale If-Match
+	etag := w.Header().Get("ETag")
+	req, _ = http.NewRequest("PATCH", "/store/v1/user", bytes.NewBufferString(`{"name": "B"}`))
+	req.Header.Set("Content-Type", mergePatchType)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("PATCH", "/store/v1/user", bytes.NewBufferString(`{"name": "C"}`))
+	req.Header.Set("Content-Type", mergePatchType)
+	req.Header.Set("If-Match", etag)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// only strings and null
+	req, _ = http.NewRequest("PATCH", "/store/v1/user", bytes.NewBufferString(`{"age": 30}`))
+	req.Header.Set("Content-Type", mergePatchType)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resBody := make(map[string]interface{})
+	_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, errorBadPatch, resBody["message"])
+
+	req, _ = http.NewRequest("PATCH", "/store/v1/nobody", bytes.NewBufferString(`{"name": "A"}`))
+	req.Header.Set("Content-Type", mergePatchType)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSearchField(t *testing.T) {
+	setUp()
+
+	req, _ := http.NewRequest("POST", "/store/v1/user", bytes.NewBufferString(`{"name": "A", "email": "a@gokv"}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/store/v1/user/email", nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	value := make(map[string]string)
+	_ = json.Unmarshal(w.Body.Bytes(), &value)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]string{"email": "a@gokv"}, value)
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+
+	// missing field and missing key are both 404 with different messages
+	for path, message := range map[string]string{
+		"/store/v1/user/phone":   errorNoField,
+		"/store/v1/nobody/email": errorKeyNotFound,
+	} {
+		req, _ = http.NewRequest("GET", path, nil)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resBody := make(map[string]interface{})
+		_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, message, resBody["message"])
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	setUp()
+
+	increment := func(path string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("POST", path, nil)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resBody := make(map[string]interface{})
+		_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+		return w.Code, resBody
+	}
+
+	code, resBody := increment("/store/v1/page/views/increment")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), resBody["value"])
+
+	code, resBody = increment("/store/v1/page/views/increment?by=-5")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(-4), resBody["value"])
+
+	code, resBody = increment("/store/v1/page/views/increment?by=many")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorBadBy, resBody["message"])
+
+	req, _ := http.NewRequest("POST", "/store/v1/user", bytes.NewBufferString(`{"name": "A"}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	code, resBody = increment("/store/v1/user/name/increment")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, errorNotInteger, resBody["message"])
+}
+
+func TestListWhere(t *testing.T) {
+	indexed, err := index.NewStore(btree.NewBtree(3), "city")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router = gin.New()
+	setHandlers(NewKeyValueHandlers(store.NewSyncStore(indexed)), router)
+
+	for i := 0; i < 5; i++ {
+		city := "BKK"
+		if i%2 == 0 {
+			city = "CNX"
+		}
+
+		body, _ := json.Marshal(store.Value{"city": city})
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/store/v1/user:%d", i), bytes.NewBuffer(body))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	list := func(query string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("GET", "/store/v1?"+query, nil)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resBody := make(map[string]interface{})
+		_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+		return w.Code, resBody
+	}
+
+	code, resBody := list("where=city:CNX&limit=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resBody["items"], 2)
+	assert.NotEmpty(t, resBody["cursor"])
+
+	code, resBody = list("where=city:CNX&limit=2&cursor=" + resBody["cursor"].(string))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resBody["items"], 1)
+	assert.Equal(t, "user:4", resBody["items"].([]interface{})[0].(map[string]interface{})["key"])
+	assert.Nil(t, resBody["cursor"])
+
+	code, resBody = list("where=name:A")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorNotIndexed, resBody["message"])
+
+	code, resBody = list("where=city")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errorBadWhere, resBody["message"])
+}
+
+func TestNamespaces(t *testing.T) {
+	setUp()
+
+	request := func(method, path, body string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resBody := make(map[string]interface{})
+		_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+		return w.Code, resBody
+	}
+
+	code, _ := request("PUT", "/store/v1/ns/team-a", "")
+	assert.Equal(t, http.StatusCreated, code)
+
+	code, _ = request("PUT", "/store/v1/ns/team-a", "")
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, _ = request("PUT", "/store/v1/ns/team-b", "")
+	assert.Equal(t, http.StatusCreated, code)
+
+	code, resBody := request("GET", "/store/v1/ns", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"team-a", "team-b"}, resBody["namespaces"])
+
+	// the same key in the default namespace and two others
+	request("POST", "/store/v1/config", `{"owner": "default"}`)
+	request("POST", "/store/v1/ns/team-a/config", `{"owner": "a", "runs": "1"}`)
+	request("POST", "/store/v1/ns/team-b/config", `{"owner": "b"}`)
+
+	code, resBody = request("GET", "/store/v1/config", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "default", resBody["owner"])
+
+	code, resBody = request("GET", "/store/v1/ns/team-a/config", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "a", resBody["owner"])
+
+	code, resBody = request("GET", "/store/v1/ns/team-b/config/owner", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "b", resBody["owner"])
+
+	code, resBody = request("POST", "/store/v1/ns/team-a/config/runs/increment", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), resBody["value"])
+
+	code, resBody = request("GET", "/store/v1/ns/team-a", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resBody["items"], 1)
+
+	code, _ = request("DELETE", "/store/v1/ns/team-b/config", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = request("DELETE", "/store/v1/ns/team-a", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = request("GET", "/store/v1/ns/team-a/config", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = request("POST", "/store/v1/ns", `{"owner": "default"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, resBody = request("GET", "/store/v1/config/owner/extra", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, errorNoRoute, resBody["message"])
+}
+
+func TestChanges(t *testing.T) {
+	changes := cdc.NewLog(3)
+	namespaces := namespace.NewRegistry(func(name string) (store.Store, error) {
+		return store.NewSyncStore(btree.NewBtree(3)), nil
+	})
+
+	// the handlers append the changes of stores that do not append them themselves
+	gin.SetMode(gin.ReleaseMode)
+	router = RestWithConfig(Config{Store: store.NewSyncStore(btree.NewBtree(3)), Namespaces: namespaces, Changes: changes})
+
+	request := func(method, path, body string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		resBody := make(map[string]interface{})
+		_ = json.Unmarshal(w.Body.Bytes(), &resBody)
+
+		return w.Code, resBody
+	}
+
+	code, resBody := request("GET", "/store/v1/_changes", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{}, resBody["events"])
+	assert.Equal(t, float64(0), resBody["last"])
+
+	request("POST", "/store/v1/A", `{"n": "1"}`)
+	request("PATCH", "/store/v1/A", `{"n": "2"}`)
+	request("PUT", "/store/v1/ns/team-a", "")
+	request("POST", "/store/v1/ns/team-a/A", `{"n": "1"}`)
+
+	code, resBody = request("GET", "/store/v1/_changes?after=1&limit=2", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"seq": float64(2), "op": "update", "key": "A", "value": map[string]interface{}{"n": "2"}},
+		map[string]interface{}{"seq": float64(3), "namespace": "team-a", "op": "insert", "key": "A", "value": map[string]interface{}{"n": "1"}},
+	}, resBody["events"])
+	assert.Equal(t, float64(3), resBody["last"])
+
+	request("DELETE", "/store/v1/A", "")
+
+	code, resBody = request("GET", "/store/v1/_changes?after=3", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"seq": float64(4), "op": "remove", "key": "A"},
+	}, resBody["events"])
+
+	// the first change left the ring
+	code, resBody = request("GET", "/store/v1/_changes", "")
+	assert.Equal(t, http.StatusGone, code)
+	assert.Equal(t, float64(4), resBody["last"])
+
+	code, _ = request("GET", "/store/v1/_changes?after=first", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = request("POST", "/store/v1/_changes", `{"n": "1"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestWatch(t *testing.T) {
+	changes := cdc.NewLog(4)
+	namespaces := namespace.NewRegistry(func(name string) (store.Store, error) {
+		return store.NewSyncStore(btree.NewBtree(3)), nil
+	})
+
+	// the handlers append the changes of stores that do not append them themselves
+	gin.SetMode(gin.ReleaseMode)
+	router = RestWithConfig(Config{Store: store.NewSyncStore(btree.NewBtree(3)), Namespaces: namespaces, Changes: changes})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	request := func(method, path, body string) int {
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	// opens the stream and returns a function reading its next n events, without blank lines
+	watch := func(path string, lastEventID string) (func(n int) []string, func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+		reader := bufio.NewReader(res.Body)
+		next := func(n int) []string {
+			var lines []string
+			for len(lines) < n*3 {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if line = strings.TrimSuffix(line, "\n"); line != "" {
+					lines = append(lines, line)
+				}
+			}
+
+			return lines
+		}
+
+		return next, func() {
+			cancel()
+			res.Body.Close()
+		}
+	}
+
+	request("POST", "/store/v1/config", `{"n": "1"}`)
+
+	next, stop := watch("/store/v1/config/watch", "")
+	request("POST", "/store/v1/other", `{"n": "1"}`)
+	request("PATCH", "/store/v1/config", `{"n": "2"}`)
+	request("DELETE", "/store/v1/config", "")
+
+	assert.Equal(t, []string{
+		"id: 3", "event: update", `data: {"key":"config","value":{"n":"2"}}`,
+		"id: 4", "event: remove", `data: {"key":"config","value":null}`,
+	}, next(2))
+	stop()
+
+	// browsers resume with Last-Event-ID
+	next, stop = watch("/store/v1?prefix=o&watch", "1")
+	assert.Equal(t, []string{"id: 2", "event: insert", `data: {"key":"other","value":{"n":"1"}}`}, next(1))
+	stop()
+
+	// namespaces are watched on their own
+	request("PUT", "/store/v1/ns/team-a", "")
+	next, stop = watch("/store/v1/ns/team-a?watch", "")
+	request("POST", "/store/v1/config", `{"n": "1"}`)
+	request("POST", "/store/v1/ns/team-a/config", `{"n": "a"}`)
+	assert.Equal(t, []string{"id: 6", "event: insert", `data: {"key":"config","value":{"n":"a"}}`}, next(1))
+	stop()
+
+	// the stream of a namespace ends once it is dropped
+	res, err := http.Get(server.URL + "/store/v1/ns/team-a?watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request("DELETE", "/store/v1/ns/team-a", "")
+	if _, err := ioutil.ReadAll(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	// the first change left the log
+	assert.Equal(t, http.StatusGone, request("GET", "/store/v1?watch&after=0", ""))
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/store/v1/config/watch?after=last", ""))
+
+	// watch is not a reserved key, only a path
+	assert.Equal(t, http.StatusCreated, request("POST", "/store/v1/watch", `{"n": "1"}`))
+	assert.Equal(t, http.StatusOK, request("GET", "/store/v1/watch", ""))
+}
@@ -0,0 +1,94 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// REST and gRPC servers share one store, run with -race
+func TestSharedStore(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	shared := store.NewSyncStore(btree.NewBtree(3))
+
+	restRouter := gin.New()
+	setHandlers(NewKeyValueHandlers(shared), restRouter)
+
+	client, tearDown := setUpGrpc(t, shared)
+	defer tearDown()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("key%02d", i%20)
+				body, _ := json.Marshal(store.Value{"rest": fmt.Sprint(w)})
+
+				var req *http.Request
+				switch i % 4 {
+				case 0:
+					req, _ = http.NewRequest("POST", "/store/v1/"+key, bytes.NewBuffer(body))
+				case 1:
+					req, _ = http.NewRequest("PATCH", "/store/v1/"+key, bytes.NewBuffer(body))
+				case 2:
+					req, _ = http.NewRequest("GET", "/store/v1?prefix=key&limit=5", nil)
+				default:
+					req, _ = http.NewRequest("DELETE", "/store/v1/"+key, nil)
+				}
+
+				restRouter.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		}(w)
+
+		go func(w int) {
+			defer wg.Done()
+
+			ctx := context.Background()
+			for i := 0; i < 200; i++ {
+				key := &Key{Key: fmt.Sprintf("key%02d", i%20)}
+				kv := &KeyValue{Key: key, Value: &Value{Value: store.Value{"grpc": fmt.Sprint(w)}}}
+
+				switch i % 4 {
+				case 0:
+					client.Insert(ctx, kv)
+				case 1:
+					client.Update(ctx, kv)
+				case 2:
+					stream, err := client.Scan(ctx, &ScanRequest{Prefix: "key"})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+
+					for err == nil {
+						_, err = stream.Recv()
+					}
+
+					if err != io.EOF {
+						t.Error(err)
+						return
+					}
+				default:
+					client.Search(ctx, key)
+					client.Remove(ctx, key)
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,226 @@
+package lsm
+
+import (
+	"os"
+	"sort"
+)
+
+// Leveled compaction
+// level 0 is compacted as a whole into level 1 once it holds L0Trigger tables
+// level n (n >= 1) is compacted one table at a time into level n+1 once it grows above its size limit
+// tombstones are dropped when no deeper level can hold an older version of the key
+
+func (l *LSM) compact() error {
+	if len(l.levels[0]) >= l.opts.L0Trigger {
+		if err := l.compactLevel(0, l.levels[0]); err != nil {
+			return err
+		}
+	}
+
+	for level := 1; level < len(l.levels)-1; level++ {
+		for l.levelSize(level) > l.maxLevelSize(level) {
+			if err := l.compactLevel(level, []*sstable{l.pickTable(level)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// merges inputs of level with the overlapping tables of level+1
+func (l *LSM) compactLevel(level int, inputs []*sstable) error {
+	start, end := keyRange(inputs)
+	target := level + 1
+
+	var overlapping []*sstable
+	for _, t := range l.levels[target] {
+		if t.overlaps(start, end) {
+			overlapping = append(overlapping, t)
+		}
+	}
+
+	// newest first, level 0 tables are appended in the order they were flushed
+	var sources []iterator
+	for i := len(inputs) - 1; i >= 0; i-- {
+		sources = append(sources, inputs[i].iterator())
+	}
+
+	for _, t := range overlapping {
+		sources = append(sources, t.iterator())
+	}
+
+	outputs, err := l.writeTables(newMergeIterator(sources), l.isBottom(target))
+	if err != nil {
+		return err
+	}
+
+	removed := make(map[*sstable]bool)
+	for _, t := range inputs {
+		removed[t] = true
+	}
+	for _, t := range overlapping {
+		removed[t] = true
+	}
+
+	oldSource, oldTarget := l.levels[level], l.levels[target]
+	l.levels[level] = without(l.levels[level], removed)
+	l.levels[target] = append(without(l.levels[target], removed), outputs...)
+	sort.Slice(l.levels[target], func(i, j int) bool {
+		return l.levels[target][i].first() < l.levels[target][j].first()
+	})
+
+	if err := l.saveManifest(); err != nil {
+		l.levels[level], l.levels[target] = oldSource, oldTarget
+		for _, t := range outputs {
+			t.close()
+			os.Remove(tableName(l.dir, t.num))
+		}
+
+		return err
+	}
+
+	// inputs are only removed once the manifest no longer references them
+	for t := range removed {
+		t.close()
+		os.Remove(tableName(l.dir, t.num))
+	}
+
+	l.compactPointer[level] = end
+
+	return nil
+}
+
+// writes the merged stream into tables of roughly TableSize bytes
+func (l *LSM) writeTables(it iterator, dropTombstones bool) ([]*sstable, error) {
+	var outputs []*sstable
+	var w *tableWriter
+
+	cleanup := func() {
+		if w != nil {
+			w.abort()
+		}
+
+		for _, t := range outputs {
+			t.close()
+			os.Remove(tableName(l.dir, t.num))
+		}
+	}
+
+	for it.next() {
+		r := it.record()
+		if r.tombstone && dropTombstones {
+			continue
+		}
+
+		if w == nil {
+			var err error
+			if w, err = newTableWriter(l.dir, l.allocFile()); err != nil {
+				cleanup()
+				return nil, err
+			}
+		}
+
+		if err := w.add(r); err != nil {
+			cleanup()
+			return nil, err
+		}
+
+		if w.offset >= l.opts.TableSize {
+			t, err := w.finish()
+			w = nil
+			if err != nil {
+				cleanup()
+				return nil, err
+			}
+
+			outputs = append(outputs, t)
+		}
+	}
+
+	if err := it.err(); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	if w != nil {
+		t, err := w.finish()
+		w = nil
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+
+		outputs = append(outputs, t)
+	}
+
+	return outputs, nil
+}
+
+// picks the first table after the compaction pointer, wrapping around at the end of the level
+func (l *LSM) pickTable(level int) *sstable {
+	tables := l.levels[level]
+	for _, t := range tables {
+		if t.first() > l.compactPointer[level] {
+			return t
+		}
+	}
+
+	return tables[0]
+}
+
+// checks if no level below level holds any table
+func (l *LSM) isBottom(level int) bool {
+	for _, tables := range l.levels[level+1:] {
+		if len(tables) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *LSM) levelSize(level int) int64 {
+	var size int64
+	for _, t := range l.levels[level] {
+		size += t.size
+	}
+
+	return size
+}
+
+func (l *LSM) maxLevelSize(level int) int64 {
+	size := l.opts.BaseLevelSize
+	for i := 1; i < level; i++ {
+		size *= int64(l.opts.LevelRatio)
+	}
+
+	return size
+}
+
+// utility function that returns the smallest and biggest key of tables
+func keyRange(tables []*sstable) (string, string) {
+	start, end := tables[0].first(), tables[0].last
+	for _, t := range tables[1:] {
+		if t.first() < start {
+			start = t.first()
+		}
+
+		if t.last > end {
+			end = t.last
+		}
+	}
+
+	return start, end
+}
+
+func without(tables []*sstable, removed map[*sstable]bool) []*sstable {
+	kept := make([]*sstable, 0, len(tables))
+	for _, t := range tables {
+		if !removed[t] {
+			kept = append(kept, t)
+		}
+	}
+
+	return kept
+}
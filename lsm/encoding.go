@@ -0,0 +1,160 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/tPhume/gokv/store"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+var (
+	errCorrupted = errors.New("lsm: corrupted record")
+)
+
+// a record is how every key is laid out inside a sorted run
+// | crc32 (4) | record length (uvarint) | key | tombstone (1) | value |
+type record struct {
+	key       string
+	value     store.Value
+	tombstone bool
+}
+
+// utility function to serialize a record, fields of the value are sorted
+// so that the same record always produces the same bytes
+func encodeRecord(r *record) []byte {
+	body := appendString(nil, r.key)
+	if r.tombstone {
+		body = append(body, 1)
+	} else {
+		body = append(body, 0)
+		body = appendValue(body, r.value)
+	}
+
+	buf := make([]byte, 4, 4+binary.MaxVarintLen64+len(body))
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(body))
+	buf = appendUvarint(buf, uint64(len(body)))
+
+	return append(buf, body...)
+}
+
+// utility function to read the next record, returns io.EOF when there is nothing left
+func decodeRecord(r *bufio.Reader) (*record, int, error) {
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return nil, 0, err
+	}
+
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, errCorrupted
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, errCorrupted
+	}
+
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(sum[:]) {
+		return nil, 0, errCorrupted
+	}
+
+	rec, err := parseRecord(body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return rec, 4 + uvarintLen(length) + len(body), nil
+}
+
+func parseRecord(body []byte) (*record, error) {
+	key, body, err := readString(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		return nil, errCorrupted
+	}
+
+	rec := &record{key: key, tombstone: body[0] == 1}
+	if rec.tombstone {
+		return rec, nil
+	}
+
+	rec.value, _, err = readValue(body[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func appendValue(buf []byte, v store.Value) []byte {
+	fields := make([]string, 0, len(v))
+	for field := range v {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	buf = appendUvarint(buf, uint64(len(fields)))
+	for _, field := range fields {
+		buf = appendString(buf, field)
+		buf = appendString(buf, v[field])
+	}
+
+	return buf
+}
+
+func readValue(buf []byte) (store.Value, []byte, error) {
+	count, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, nil, errCorrupted
+	}
+	buf = buf[n:]
+
+	value := make(store.Value, count)
+	for i := uint64(0); i < count; i++ {
+		var field, v string
+		var err error
+
+		if field, buf, err = readString(buf); err != nil {
+			return nil, nil, err
+		}
+
+		if v, buf, err = readString(buf); err != nil {
+			return nil, nil, err
+		}
+
+		value[field] = v
+	}
+
+	return value, buf, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(buf []byte) (string, []byte, error) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < length {
+		return "", nil, errCorrupted
+	}
+
+	return string(buf[n : n+int(length)]), buf[n+int(length):], nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+func uvarintLen(x uint64) int {
+	var tmp [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(tmp[:], x)
+}
@@ -0,0 +1,106 @@
+package lsm
+
+// iterator walks records of a source in ascending key order
+type iterator interface {
+	next() bool
+	record() *record
+	err() error
+}
+
+// sliceIterator iterates over records already held in memory
+type sliceIterator struct {
+	records []*record
+	pos     int
+}
+
+func newSliceIterator(records []*record) *sliceIterator {
+	return &sliceIterator{records: records, pos: -1}
+}
+
+func (it *sliceIterator) next() bool {
+	it.pos++
+	return it.pos < len(it.records)
+}
+
+func (it *sliceIterator) record() *record {
+	return it.records[it.pos]
+}
+
+func (it *sliceIterator) err() error {
+	return nil
+}
+
+// mergeIterator merges several sources into one sorted stream
+// sources are ordered newest first, so when two sources hold the same key
+// the record from the source with the lowest index wins
+type mergeIterator struct {
+	sources []iterator
+	valid   []bool
+	current *record
+	failure error
+}
+
+func newMergeIterator(sources []iterator) *mergeIterator {
+	m := &mergeIterator{
+		sources: sources,
+		valid:   make([]bool, len(sources)),
+	}
+
+	for i, source := range sources {
+		m.valid[i] = m.advance(source)
+	}
+
+	return m
+}
+
+func (m *mergeIterator) next() bool {
+	if m.failure != nil {
+		return false
+	}
+
+	smallest := -1
+	for i, source := range m.sources {
+		if !m.valid[i] {
+			continue
+		}
+
+		if smallest == -1 || source.record().key < m.sources[smallest].record().key {
+			smallest = i
+		}
+	}
+
+	if smallest == -1 {
+		return false
+	}
+
+	m.current = m.sources[smallest].record()
+
+	// skip older versions of the same key
+	for i, source := range m.sources {
+		for m.valid[i] && source.record().key == m.current.key {
+			m.valid[i] = m.advance(source)
+		}
+	}
+
+	return m.failure == nil
+}
+
+func (m *mergeIterator) record() *record {
+	return m.current
+}
+
+func (m *mergeIterator) err() error {
+	return m.failure
+}
+
+func (m *mergeIterator) advance(source iterator) bool {
+	if source.next() {
+		return true
+	}
+
+	if err := source.err(); err != nil && m.failure == nil {
+		m.failure = err
+	}
+
+	return false
+}
@@ -0,0 +1,401 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/wal"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Package contains a log-structured merge tree implementation of store.Store
+// writes are appended to a log then go to an in memory memtable which is flushed to disk as an immutable sorted run (level 0)
+// the log is replayed into the memtable on startup, and replaced by a new one after every flush
+// sorted runs are merged into larger non overlapping levels by leveled compaction
+
+var (
+	ErrClosed = errors.New("lsm: store is closed")
+)
+
+// Options tune when the memtable is flushed and when levels are compacted
+type Options struct {
+	// bytes held by the memtable before it is flushed to level 0
+	MemtableSize int
+	// number of level 0 tables that triggers a compaction into level 1
+	L0Trigger int
+	// maximum bytes of level 1, every following level is LevelRatio times bigger
+	BaseLevelSize int64
+	LevelRatio    int
+	// target size of a table written by compaction
+	TableSize int64
+	// number of levels including level 0
+	MaxLevels int
+	// fsync policy of the memtable log
+	Log wal.Options
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MemtableSize:  4 << 20,
+		L0Trigger:     4,
+		BaseLevelSize: 10 << 20,
+		LevelRatio:    10,
+		TableSize:     2 << 20,
+		MaxLevels:     7,
+		Log:           wal.DefaultOptions(),
+	}
+}
+
+// LSM implements the store interface on top of a directory of sorted runs
+type LSM struct {
+	dir      string
+	opts     Options
+	mem      *memtable
+	log      *wal.Log
+	logNum   uint64
+	levels   [][]*sstable
+	nextFile uint64
+	// key where the next compaction of each level starts, so work is spread over the key space
+	compactPointer []string
+	closed         bool
+}
+
+// Open loads the store kept in dir, creating dir if needed
+// tables listed in the manifest are reopened, its log is replayed into the memtable
+// and leftovers of interrupted flushes or compactions are removed
+func Open(dir string, opts Options) (*LSM, error) {
+	if opts.MaxLevels < 2 {
+		opts.MaxLevels = 2
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	m, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := removeOrphans(dir, m); err != nil {
+		return nil, err
+	}
+
+	l := &LSM{
+		dir:            dir,
+		opts:           opts,
+		mem:            newMemtable(),
+		levels:         make([][]*sstable, opts.MaxLevels),
+		nextFile:       m.NextFile,
+		compactPointer: make([]string, opts.MaxLevels),
+	}
+
+	for level, nums := range m.Levels {
+		if level >= opts.MaxLevels {
+			l.closeTables()
+			return nil, errors.New("lsm: manifest has more levels than MaxLevels")
+		}
+
+		for _, num := range nums {
+			t, err := openTable(dir, num)
+			if err != nil {
+				l.closeTables()
+				return nil, err
+			}
+
+			l.levels[level] = append(l.levels[level], t)
+		}
+	}
+
+	if err := l.openLog(m.Log); err != nil {
+		l.closeTables()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *LSM) Insert(key string, value store.Value) error {
+	if l.closed {
+		return ErrClosed
+	}
+
+	return l.put(key, value)
+}
+
+func (l *LSM) Update(key string, value store.Value) error {
+	if l.closed {
+		return ErrClosed
+	}
+
+	r, err := l.get(key)
+	if err != nil {
+		return err
+	}
+
+	if r == nil {
+		return store.KeyDoesNotExist
+	}
+
+	return l.put(key, value)
+}
+
+// returns nil if the key does not exist or the tables could not be read
+func (l *LSM) Search(key string) store.Value {
+	if l.closed {
+		return nil
+	}
+
+	r, err := l.get(key)
+	if err != nil || r == nil {
+		return nil
+	}
+
+	return store.CopyValue(r.value)
+}
+
+func (l *LSM) Remove(key string) error {
+	if l.closed {
+		return ErrClosed
+	}
+
+	r, err := l.get(key)
+	if err != nil {
+		return err
+	}
+
+	if r == nil {
+		return store.KeyDoesNotExist
+	}
+
+	if err := l.log.Append(wal.Record{Op: wal.OpRemove, Key: key}); err != nil {
+		return err
+	}
+
+	l.mem.delete(key)
+	return l.maybeFlush()
+}
+
+// Flush writes the memtable to level 0 even if it is not full
+func (l *LSM) Flush() error {
+	if l.closed {
+		return ErrClosed
+	}
+
+	return l.flush()
+}
+
+// Close flushes the memtable and closes all tables and the log
+func (l *LSM) Close() error {
+	if l.closed {
+		return nil
+	}
+
+	err := l.flush()
+	l.closeTables()
+	if closeErr := l.log.Close(); err == nil {
+		err = closeErr
+	}
+	l.closed = true
+
+	return err
+}
+
+// logs the write before it is applied to the memtable
+func (l *LSM) put(key string, value store.Value) error {
+	if err := l.log.Append(wal.Record{Op: wal.OpInsert, Key: key, Value: value}); err != nil {
+		return err
+	}
+
+	l.mem.put(key, value)
+	return l.maybeFlush()
+}
+
+// returns the newest live record of key, nil if it does not exist or was removed
+func (l *LSM) get(key string) (*record, error) {
+	if r, ok := l.mem.get(key); ok {
+		return live(r), nil
+	}
+
+	// level 0 tables overlap, newest is at the end
+	level0 := l.levels[0]
+	for i := len(level0) - 1; i >= 0; i-- {
+		r, ok, err := level0[i].get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return live(r), nil
+		}
+	}
+
+	// other levels are sorted and do not overlap, so at most one table can hold the key
+	for _, tables := range l.levels[1:] {
+		pos := sort.Search(len(tables), func(i int) bool {
+			return tables[i].last >= key
+		})
+
+		if pos == len(tables) {
+			continue
+		}
+
+		r, ok, err := tables[pos].get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return live(r), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (l *LSM) maybeFlush() error {
+	if l.mem.size < l.opts.MemtableSize {
+		return nil
+	}
+
+	return l.flush()
+}
+
+// writes the memtable as a new level 0 table then compacts if needed
+func (l *LSM) flush() error {
+	if l.mem.isEmpty() {
+		return nil
+	}
+
+	w, err := newTableWriter(l.dir, l.allocFile())
+	if err != nil {
+		return err
+	}
+
+	for _, r := range l.mem.sorted() {
+		if err := w.add(r); err != nil {
+			w.abort()
+			return err
+		}
+	}
+
+	t, err := w.finish()
+	if err != nil {
+		return err
+	}
+
+	// the table and a new empty log replace the memtable and its log in a single manifest write
+	oldLog, oldNum := l.log, l.logNum
+	num := l.allocFile()
+	log, err := wal.Open(logName(l.dir, num), l.opts.Log)
+	if err != nil {
+		t.close()
+		return err
+	}
+
+	l.levels[0] = append(l.levels[0], t)
+	l.log, l.logNum = log, num
+	if err := l.saveManifest(); err != nil {
+		l.levels[0] = l.levels[0][:len(l.levels[0])-1]
+		l.log, l.logNum = oldLog, oldNum
+		log.Close()
+		t.close()
+		return err
+	}
+
+	l.mem = newMemtable()
+
+	// a log left behind is removed as an orphan on the next open
+	oldLog.Close()
+	os.Remove(logName(l.dir, oldNum))
+
+	return l.compact()
+}
+
+// opens the log of the memtable and replays it, a new log is created if the manifest has none yet
+func (l *LSM) openLog(num uint64) error {
+	created := num == 0
+	if created {
+		num = l.allocFile()
+	}
+
+	log, err := wal.Open(logName(l.dir, num), l.opts.Log)
+	if err != nil {
+		return err
+	}
+
+	err = log.Replay(func(r wal.Record) error {
+		switch r.Op {
+		case wal.OpInsert:
+			l.mem.put(r.Key, r.Value)
+		case wal.OpRemove:
+			l.mem.delete(r.Key)
+		default:
+			return wal.ErrCorrupted
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.Close()
+		return err
+	}
+
+	l.log, l.logNum = log, num
+	if created {
+		if err := l.saveManifest(); err != nil {
+			log.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *LSM) allocFile() uint64 {
+	num := l.nextFile
+	l.nextFile++
+
+	return num
+}
+
+func (l *LSM) saveManifest() error {
+	m := &manifest{
+		NextFile: l.nextFile,
+		Levels:   make([][]uint64, len(l.levels)),
+		Log:      l.logNum,
+	}
+
+	for level, tables := range l.levels {
+		m.Levels[level] = make([]uint64, 0, len(tables))
+		for _, t := range tables {
+			m.Levels[level] = append(m.Levels[level], t.num)
+		}
+	}
+
+	return writeManifest(l.dir, m)
+}
+
+func logName(dir string, num uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.log", num))
+}
+
+func (l *LSM) closeTables() {
+	for _, tables := range l.levels {
+		for _, t := range tables {
+			t.close()
+		}
+	}
+}
+
+// utility function to turn tombstones into nil
+func live(r *record) *record {
+	if r.tombstone {
+		return nil
+	}
+
+	return r
+}
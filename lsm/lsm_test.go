@@ -0,0 +1,342 @@
+package lsm
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/store/storetest"
+	"github.com/tPhume/gokv/wal"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testOptions() Options {
+	return Options{
+		MemtableSize:  256,
+		L0Trigger:     2,
+		BaseLevelSize: 1024,
+		LevelRatio:    2,
+		TableSize:     512,
+		MaxLevels:     4,
+		Log:           wal.Options{Sync: wal.SyncNever},
+	}
+}
+
+func openTestStore(t *testing.T, dir string) *LSM {
+	l, err := Open(dir, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestLSM_Simple(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := openTestStore(t, dir)
+	defer l.Close()
+
+	if v := l.Search("A"); v != nil {
+		t.Fatalf("search empty store, expected nil, got = [%v]", v)
+	}
+
+	if err := l.Insert("A", store.Value{"val": "A"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := l.Search("A"); v["val"] != "A" {
+		t.Fatalf("expected [A], got = [%v]", v["val"])
+	}
+
+	if err := l.Update("B", store.Value{"val": "B"}); err != store.KeyDoesNotExist {
+		t.Fatalf("expected error = [KeyDoesNotExist], got = [%v]", err)
+	}
+
+	if err := l.Update("A", store.Value{"val": "new A"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := l.Search("A"); v["val"] != "new A" {
+		t.Fatalf("expected [new A], got = [%v]", v["val"])
+	}
+
+	if err := l.Remove("A"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Remove("A"); err != store.KeyDoesNotExist {
+		t.Fatalf("expected error = [KeyDoesNotExist], got = [%v]", err)
+	}
+
+	if v := l.Search("A"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+}
+
+func TestLSM_CopiesValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := openTestStore(t, dir)
+	defer l.Close()
+
+	storetest.CopiesValues(t, l)
+}
+
+func TestLSM_Compaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := openTestStore(t, dir)
+	defer l.Close()
+
+	for i := 0; i < 500; i++ {
+		if err := l.Insert(testKey(i), store.Value{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// overwrite and remove keys that were already flushed
+	for i := 0; i < 500; i += 3 {
+		if err := l.Update(testKey(i), store.Value{"val": "updated"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < 500; i += 3 {
+		if err := l.Remove(testKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(l.levels[0]) >= l.opts.L0Trigger {
+		t.Fatalf("level 0 should have been compacted, got = [%v] tables", len(l.levels[0]))
+	}
+
+	deeper := 0
+	for _, tables := range l.levels[1:] {
+		deeper += len(tables)
+
+		// tables of a level must not overlap
+		for i := 1; i < len(tables); i++ {
+			if tables[i-1].last >= tables[i].first() {
+				t.Fatalf("tables [%v] and [%v] overlap", tables[i-1].num, tables[i].num)
+			}
+		}
+	}
+
+	if deeper == 0 {
+		t.Fatalf("expected tables below level 0")
+	}
+
+	checkTestKeys(t, l)
+}
+
+func TestLSM_Recovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := openTestStore(t, dir)
+	for i := 0; i < 500; i++ {
+		if err := l.Insert(testKey(i), store.Value{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 500; i += 3 {
+		if err := l.Update(testKey(i), store.Value{"val": "updated"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < 500; i += 3 {
+		if err := l.Remove(testKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// leftover of an interrupted flush
+	orphan := filepath.Join(dir, "999999.sst")
+	if err := ioutil.WriteFile(orphan, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l = openTestStore(t, dir)
+	defer l.Close()
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("expected orphan table to be removed, got = [%v]", err)
+	}
+
+	checkTestKeys(t, l)
+}
+
+// writes still in the memtable when the store is not closed are replayed from its log
+func TestLSM_LogReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := openTestStore(t, dir)
+	for i := 0; i < 500; i++ {
+		if err := l.Insert(testKey(i), store.Value{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 500; i += 3 {
+		if err := l.Update(testKey(i), store.Value{"val": "updated"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < 500; i += 3 {
+		if err := l.Remove(testKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if l.mem.isEmpty() {
+		t.Fatalf("expected writes left in the memtable")
+	}
+
+	// the first store is dropped without Close, as if the process had crashed
+	l.closeTables()
+	l.log.Close()
+
+	l = openTestStore(t, dir)
+	checkTestKeys(t, l)
+
+	logs, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logs) != 1 {
+		t.Fatalf("expected a single log, got = %v", logs)
+	}
+
+	// the replayed writes are flushed on close and not replayed twice
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l = openTestStore(t, dir)
+	defer l.Close()
+
+	if !l.mem.isEmpty() {
+		t.Fatalf("expected an empty memtable")
+	}
+
+	checkTestKeys(t, l)
+}
+
+func TestLSM_Scan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := openTestStore(t, dir)
+	defer l.Close()
+
+	for i := 0; i < 500; i++ {
+		if err := l.Insert(testKey(i), store.Value{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 500; i += 3 {
+		if err := l.Update(testKey(i), store.Value{"val": "updated"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// removed keys are spread between the memtable and the tables
+	for i := 1; i < 500; i += 3 {
+		if err := l.Remove(testKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var keys []string
+	err = l.Scan(store.ScanOptions{Start: testKey(100), End: testKey(200)}, func(key string, value store.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, key := range keys {
+		if i > 0 && keys[i-1] >= key {
+			t.Fatalf("keys out of order, [%v] before [%v]", keys[i-1], key)
+		}
+	}
+
+	// 100 keys in the range, every key after a multiple of 3 was removed
+	if len(keys) != 66 || keys[0] != testKey(101) || keys[len(keys)-1] != testKey(198) {
+		t.Fatalf("expected [66] keys from [%v] to [%v], got = [%v]", testKey(101), testKey(198), keys)
+	}
+
+	keys = nil
+	err = l.Scan(store.ScanOptions{End: testKey(10), Limit: 3, Reverse: true}, func(key string, value store.Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(keys) != fmt.Sprint([]string{testKey(9), testKey(8), testKey(6)}) {
+		t.Fatalf("expected [%v %v %v], got = [%v]", testKey(9), testKey(8), testKey(6), keys)
+	}
+}
+
+func testKey(i int) string {
+	return fmt.Sprintf("key%04d", i)
+}
+
+// checks the state left by inserting 500 keys, updating every third and removing the ones after
+func checkTestKeys(t *testing.T, l *LSM) {
+	for i := 0; i < 500; i++ {
+		v := l.Search(testKey(i))
+
+		switch i % 3 {
+		case 0:
+			if v["val"] != "updated" {
+				t.Fatalf("key [%v], expected [updated], got = [%v]", testKey(i), v)
+			}
+		case 1:
+			if v != nil {
+				t.Fatalf("key [%v], expected nil, got = [%v]", testKey(i), v)
+			}
+		default:
+			if v["val"] != fmt.Sprint(i) {
+				t.Fatalf("key [%v], expected [%v], got = [%v]", testKey(i), i, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package lsm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The manifest records which table files make up each level, and which log holds the writes of the memtable
+// it is replaced atomically (write to a temporary file then rename) after every flush and compaction
+// so tables and logs that are not listed in it are leftovers of an interrupted write and can be removed
+
+const (
+	manifestName    = "MANIFEST"
+	manifestTmpName = "MANIFEST.tmp"
+)
+
+type manifest struct {
+	NextFile uint64     `json:"next_file"`
+	Levels   [][]uint64 `json:"levels"`
+	// 0 until the first log is created
+	Log uint64 `json:"log"`
+}
+
+// returns an empty manifest if none was written yet
+func readManifest(dir string) (*manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return &manifest{NextFile: 1}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func writeManifest(dir string, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, manifestTmpName)
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(dir, manifestName))
+}
+
+// utility function to delete table and log files the manifest does not reference
+func removeOrphans(dir string, m *manifest) error {
+	live := map[string]bool{logName(dir, m.Log): true}
+	for _, level := range m.Levels {
+		for _, num := range level {
+			live[tableName(dir, num)] = true
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if ext != ".sst" && ext != ".log" || live[filepath.Join(dir, name)] {
+			continue
+		}
+
+		if _, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64); err != nil {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package lsm
+
+import (
+	"github.com/tPhume/gokv/store"
+	"sort"
+)
+
+// memtable holds the most recent writes in memory until it is flushed to level 0
+// removed keys are kept as tombstones so they can shadow older sorted runs
+type memtable struct {
+	records map[string]*record
+	size    int
+}
+
+func newMemtable() *memtable {
+	return &memtable{records: make(map[string]*record)}
+}
+
+func (m *memtable) put(key string, value store.Value) {
+	m.set(&record{key: key, value: store.CopyValue(value)})
+}
+
+func (m *memtable) delete(key string) {
+	m.set(&record{key: key, tombstone: true})
+}
+
+func (m *memtable) set(r *record) {
+	if old, ok := m.records[r.key]; ok {
+		m.size -= recordSize(old)
+	}
+
+	m.records[r.key] = r
+	m.size += recordSize(r)
+}
+
+// returns the record for key and whether the memtable knows about the key at all
+func (m *memtable) get(key string) (*record, bool) {
+	r, ok := m.records[key]
+	return r, ok
+}
+
+func (m *memtable) isEmpty() bool {
+	return len(m.records) == 0
+}
+
+// utility function that returns the records sorted by key
+func (m *memtable) sorted() []*record {
+	records := make([]*record, 0, len(m.records))
+	for _, r := range m.records {
+		records = append(records, r)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].key < records[j].key
+	})
+
+	return records
+}
+
+// utility function to estimate how many bytes a record occupies
+func recordSize(r *record) int {
+	size := len(r.key) + 1
+	for field, value := range r.value {
+		size += len(field) + len(value)
+	}
+
+	return size
+}
@@ -0,0 +1,92 @@
+package lsm
+
+import (
+	"github.com/tPhume/gokv/store"
+)
+
+// Scan merges the memtable and every table overlapping the range of opts
+// a reverse scan has to read the whole range before visiting it backwards
+func (l *LSM) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	if l.closed {
+		return ErrClosed
+	}
+
+	it := newMergeIterator(l.scanSources(opts))
+
+	var records []*record
+	count := 0
+	for it.next() {
+		r := it.record()
+		if r.key < opts.Start || r.tombstone {
+			continue
+		}
+
+		if opts.End != "" && r.key >= opts.End {
+			break
+		}
+
+		if opts.Reverse {
+			records = append(records, r)
+			continue
+		}
+
+		if opts.Limit > 0 && count >= opts.Limit {
+			break
+		}
+
+		count++
+		if !fn(r.key, store.CopyValue(r.value)) {
+			return nil
+		}
+	}
+
+	if err := it.err(); err != nil {
+		return err
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if opts.Limit > 0 && count >= opts.Limit {
+			break
+		}
+
+		count++
+		if !fn(records[i].key, store.CopyValue(records[i].value)) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// returns the sources of a scan, newest first
+func (l *LSM) scanSources(opts store.ScanOptions) []iterator {
+	var memRecords []*record
+	for _, r := range l.mem.sorted() {
+		if opts.InRange(r.key) {
+			memRecords = append(memRecords, r)
+		}
+	}
+
+	sources := []iterator{newSliceIterator(memRecords)}
+
+	level0 := l.levels[0]
+	for i := len(level0) - 1; i >= 0; i-- {
+		if overlapsScan(level0[i], opts) {
+			sources = append(sources, level0[i].seek(opts.Start))
+		}
+	}
+
+	for _, tables := range l.levels[1:] {
+		for _, t := range tables {
+			if overlapsScan(t, opts) {
+				sources = append(sources, t.seek(opts.Start))
+			}
+		}
+	}
+
+	return sources
+}
+
+func overlapsScan(t *sstable, opts store.ScanOptions) bool {
+	return !t.isEmpty() && t.last >= opts.Start && (opts.End == "" || t.first() < opts.End)
+}
@@ -0,0 +1,306 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Sorted runs are immutable files of records in ascending key order
+// | records ... | index | index offset (8) | magic (8) |
+// the index keeps the key and offset of every indexInterval-th record
+// plus the last key of the file so lookups can skip whole tables
+
+const (
+	tableMagic    = uint64(0x676f6b766c736d31) // "gokvlsm1"
+	footerSize    = 16
+	indexInterval = 16
+)
+
+var (
+	errBadTable = errors.New("lsm: bad table file")
+)
+
+type indexEntry struct {
+	key    string
+	offset int64
+}
+
+type sstable struct {
+	num     uint64
+	file    *os.File
+	size    int64
+	dataEnd int64
+	index   []indexEntry
+	last    string
+}
+
+func tableName(dir string, num uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.sst", num))
+}
+
+func openTable(dir string, num uint64) (*sstable, error) {
+	file, err := os.Open(tableName(dir, num))
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := readTable(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	t.num = num
+	return t, nil
+}
+
+// utility function to read footer and index of a table file
+func readTable(file *os.File) (*sstable, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := stat.Size()
+	if size < footerSize {
+		return nil, errBadTable
+	}
+
+	var footer [footerSize]byte
+	if _, err := file.ReadAt(footer[:], size-footerSize); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint64(footer[8:]) != tableMagic {
+		return nil, errBadTable
+	}
+
+	indexOffset := int64(binary.LittleEndian.Uint64(footer[:8]))
+	if indexOffset > size-footerSize {
+		return nil, errBadTable
+	}
+
+	buf := make([]byte, size-footerSize-indexOffset)
+	if _, err := file.ReadAt(buf, indexOffset); err != nil {
+		return nil, err
+	}
+
+	t := &sstable{file: file, size: size, dataEnd: indexOffset}
+
+	count, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, errBadTable
+	}
+	buf = buf[n:]
+
+	for i := uint64(0); i < count; i++ {
+		var key string
+		if key, buf, err = readString(buf); err != nil {
+			return nil, errBadTable
+		}
+
+		offset, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errBadTable
+		}
+		buf = buf[n:]
+
+		t.index = append(t.index, indexEntry{key: key, offset: int64(offset)})
+	}
+
+	if t.last, _, err = readString(buf); err != nil {
+		return nil, errBadTable
+	}
+
+	return t, nil
+}
+
+func (t *sstable) first() string {
+	if len(t.index) == 0 {
+		return ""
+	}
+
+	return t.index[0].key
+}
+
+func (t *sstable) isEmpty() bool {
+	return len(t.index) == 0
+}
+
+// checks if the key range of the table intersects [start, end]
+func (t *sstable) overlaps(start, end string) bool {
+	return !t.isEmpty() && t.first() <= end && t.last >= start
+}
+
+// returns the record of key and whether it was found in this table
+func (t *sstable) get(key string) (*record, bool, error) {
+	if t.isEmpty() || key < t.first() || key > t.last {
+		return nil, false, nil
+	}
+
+	// last index entry with a key less than or equal to the key
+	pos := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].key > key
+	}) - 1
+
+	it := t.iteratorAt(t.index[pos].offset)
+	for it.next() {
+		r := it.record()
+		if r.key == key {
+			return r, true, nil
+		}
+
+		if r.key > key {
+			break
+		}
+	}
+
+	return nil, false, it.err()
+}
+
+// returns an iterator positioned before the first index block that can hold key
+func (t *sstable) seek(key string) *tableIterator {
+	pos := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].key > key
+	}) - 1
+
+	if pos < 0 {
+		return t.iterator()
+	}
+
+	return t.iteratorAt(t.index[pos].offset)
+}
+
+func (t *sstable) iterator() *tableIterator {
+	return t.iteratorAt(0)
+}
+
+func (t *sstable) iteratorAt(offset int64) *tableIterator {
+	section := io.NewSectionReader(t.file, offset, t.dataEnd-offset)
+	return &tableIterator{reader: bufio.NewReader(section)}
+}
+
+func (t *sstable) close() error {
+	return t.file.Close()
+}
+
+// tableIterator reads records of a table sequentially
+type tableIterator struct {
+	reader  *bufio.Reader
+	current *record
+	failure error
+}
+
+func (it *tableIterator) next() bool {
+	r, _, err := decodeRecord(it.reader)
+	if err != nil {
+		if err != io.EOF {
+			it.failure = err
+		}
+
+		return false
+	}
+
+	it.current = r
+	return true
+}
+
+func (it *tableIterator) record() *record {
+	return it.current
+}
+
+func (it *tableIterator) err() error {
+	return it.failure
+}
+
+// tableWriter writes records, which must be added in ascending key order, to a new table file
+type tableWriter struct {
+	dir    string
+	num    uint64
+	file   *os.File
+	writer *bufio.Writer
+	offset int64
+	count  int
+	index  []indexEntry
+	last   string
+}
+
+func newTableWriter(dir string, num uint64) (*tableWriter, error) {
+	file, err := os.OpenFile(tableName(dir, num), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tableWriter{
+		dir:    dir,
+		num:    num,
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+func (w *tableWriter) add(r *record) error {
+	if w.count%indexInterval == 0 {
+		w.index = append(w.index, indexEntry{key: r.key, offset: w.offset})
+	}
+
+	n, err := w.writer.Write(encodeRecord(r))
+	if err != nil {
+		return err
+	}
+
+	w.offset += int64(n)
+	w.count++
+	w.last = r.key
+
+	return nil
+}
+
+// writes index and footer, syncs the file and opens it for reading
+func (w *tableWriter) finish() (*sstable, error) {
+	buf := appendUvarint(nil, uint64(len(w.index)))
+	for _, entry := range w.index {
+		buf = appendString(buf, entry.key)
+		buf = appendUvarint(buf, uint64(entry.offset))
+	}
+	buf = appendString(buf, w.last)
+
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint64(footer[:8], uint64(w.offset))
+	binary.LittleEndian.PutUint64(footer[8:], tableMagic)
+	buf = append(buf, footer[:]...)
+
+	if _, err := w.writer.Write(buf); err != nil {
+		w.abort()
+		return nil, err
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		w.abort()
+		return nil, err
+	}
+
+	if err := w.file.Sync(); err != nil {
+		w.abort()
+		return nil, err
+	}
+
+	if err := w.file.Close(); err != nil {
+		os.Remove(tableName(w.dir, w.num))
+		return nil, err
+	}
+
+	return openTable(w.dir, w.num)
+}
+
+// closes and removes a table that could not be completed
+func (w *tableWriter) abort() {
+	w.file.Close()
+	os.Remove(tableName(w.dir, w.num))
+}
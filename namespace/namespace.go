@@ -0,0 +1,242 @@
+package namespace
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Package contains named namespaces, each backed by its own store.Store
+// so several users of one server can use the same keys without colliding
+
+var (
+	ErrExists   = errors.New("namespace already exists")
+	ErrNotFound = errors.New("namespace does not exist")
+	ErrBadName  = errors.New("namespace name must be 1 to 64 letters, digits, '_', '-' or '.'")
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Factory creates the store of a new namespace
+// the store is shared by the REST and gRPC servers, so it must be safe for concurrent use
+type Factory func(name string) (store.Store, error)
+
+// DefaultFactory backs every namespace with an in memory btree
+func DefaultFactory(name string) (store.Store, error) {
+	return store.NewSyncStore(btree.NewBtree(3)), nil
+}
+
+// Registry holds the namespaces by name, it is safe for concurrent use
+type Registry struct {
+	mu      sync.RWMutex
+	stores  map[string]store.Store
+	factory Factory
+	// closed once the namespace of the same name is dropped
+	done map[string]chan struct{}
+	// file the names are kept in, empty for registries from NewRegistry
+	path   string
+	onDrop func(name string) error
+}
+
+func NewRegistry(factory Factory) *Registry {
+	return &Registry{
+		stores:  make(map[string]store.Store),
+		done:    make(map[string]chan struct{}),
+		factory: factory,
+	}
+}
+
+// OpenRegistry returns a registry that keeps the names of its namespaces in the file at path
+// the namespaces listed there are created again by factory, which must find their keys where it left them
+// onDrop, if not nil, is called once a namespace is dropped so the data factory kept for it can be deleted
+// an empty path keeps the names in memory only
+func OpenRegistry(path string, factory Factory, onDrop func(name string) error) (*Registry, error) {
+	r := NewRegistry(factory)
+	r.path, r.onDrop = path, onDrop
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		s, err := factory(name)
+		if err != nil {
+			return nil, err
+		}
+
+		r.stores[name] = s
+		r.done[name] = make(chan struct{})
+	}
+
+	return r, nil
+}
+
+// Create makes a new namespace with a store from the factory
+func (r *Registry) Create(name string) (store.Store, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrBadName
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.stores[name]; ok {
+		return nil, ErrExists
+	}
+
+	s, err := r.factory(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r.stores[name] = s
+	if err := r.save(); err != nil {
+		delete(r.stores, name)
+		r.release(name, s)
+		return nil, err
+	}
+	r.done[name] = make(chan struct{})
+
+	return s, nil
+}
+
+// Get returns the store of the namespace
+func (r *Registry) Get(name string) (store.Store, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.stores[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return s, nil
+}
+
+// Done returns a channel that is closed once the namespace is dropped
+// so streams of its changes can end rather than carry on with a namespace created again under the same name
+func (r *Registry) Done(name string) (<-chan struct{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	done, ok := r.done[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return done, nil
+}
+
+// List returns the names of the namespaces in order
+func (r *Registry) List() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.stores))
+	for name := range r.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Drop removes the namespace and every key in it, its store is closed if it is an io.Closer
+// requests already holding the store may still finish against it
+func (r *Registry) Drop(name string) error {
+	r.mu.Lock()
+	s, ok := r.stores[name]
+	if !ok {
+		r.mu.Unlock()
+		return ErrNotFound
+	}
+
+	delete(r.stores, name)
+	if err := r.save(); err != nil {
+		r.stores[name] = s
+		r.mu.Unlock()
+		return err
+	}
+
+	close(r.done[name])
+	delete(r.done, name)
+	r.mu.Unlock()
+
+	return r.release(name, s)
+}
+
+// utility function to close the store of a namespace that is gone and delete its data
+func (r *Registry) release(name string, s store.Store) error {
+	if closer, ok := s.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+
+	if r.onDrop != nil {
+		return r.onDrop(name)
+	}
+
+	return nil
+}
+
+// save replaces the file of the registry with the current names, written to a temporary file then renamed
+// so a crash leaves either the old or the new list, the caller holds the lock
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	names := make([]string, 0, len(r.stores))
+	for name := range r.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,149 @@
+package namespace
+
+import (
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// closableStore records whether it was closed
+type closableStore struct {
+	store.Store
+	closed bool
+}
+
+func (c *closableStore) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	var created []*closableStore
+	r := NewRegistry(func(name string) (store.Store, error) {
+		s := &closableStore{Store: btree.NewBtree(3)}
+		created = append(created, s)
+		return s, nil
+	})
+
+	teamA, err := r.Create("team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	teamB, err := r.Create("team-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same key in two namespaces
+	teamA.Insert("config", store.Value{"owner": "a"})
+	teamB.Insert("config", store.Value{"owner": "b"})
+
+	if s, _ := r.Get("team-a"); s.Search("config")["owner"] != "a" {
+		t.Fatalf("expected [a], got = [%v]", s.Search("config"))
+	}
+
+	if _, err := r.Create("team-a"); err != ErrExists {
+		t.Fatalf("expected error = [ErrExists], got = [%v]", err)
+	}
+
+	for _, name := range []string{"", "team a", "team/a"} {
+		if _, err := r.Create(name); err != ErrBadName {
+			t.Fatalf("expected error = [ErrBadName] for [%v], got = [%v]", name, err)
+		}
+	}
+
+	if names := r.List(); len(names) != 2 || names[0] != "team-a" || names[1] != "team-b" {
+		t.Fatalf("expected [team-a team-b], got = %v", names)
+	}
+
+	done, err := r.Done("team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Drop("team-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("expected done to be closed once the namespace is dropped")
+	}
+
+	if !created[0].closed {
+		t.Fatal("expected the store of the dropped namespace to be closed")
+	}
+
+	if _, err := r.Get("team-a"); err != ErrNotFound {
+		t.Fatalf("expected error = [ErrNotFound], got = [%v]", err)
+	}
+
+	if err := r.Drop("team-a"); err != ErrNotFound {
+		t.Fatalf("expected error = [ErrNotFound], got = [%v]", err)
+	}
+}
+
+func TestOpenRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "namespace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the trees stand in for data the factory keeps on disk
+	trees := make(map[string]*btree.Btree)
+	factory := func(name string) (store.Store, error) {
+		if trees[name] == nil {
+			trees[name] = btree.NewBtree(3)
+		}
+		return trees[name], nil
+	}
+
+	var dropped []string
+	onDrop := func(name string) error {
+		dropped = append(dropped, name)
+		delete(trees, name)
+		return nil
+	}
+
+	path := filepath.Join(dir, "namespaces")
+	r, err := OpenRegistry(path, factory, onDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"team-a", "team-b"} {
+		s, err := r.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Insert("config", store.Value{"owner": name})
+	}
+
+	if err := r.Drop("team-b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dropped) != 1 || dropped[0] != "team-b" {
+		t.Fatalf("expected [team-b] dropped, got = %v", dropped)
+	}
+
+	// reopened, only the namespace left is created again
+	r, err = OpenRegistry(path, factory, onDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := r.List(); len(names) != 1 || names[0] != "team-a" {
+		t.Fatalf("expected [team-a], got = %v", names)
+	}
+
+	if s, _ := r.Get("team-a"); s.Search("config")["owner"] != "team-a" {
+		t.Fatalf("expected [team-a], got = [%v]", s.Search("config"))
+	}
+}
@@ -0,0 +1,124 @@
+package skiplist
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+// every workload runs against both engines, btree is wrapped in a SyncStore since it is not safe for concurrent use
+// go test -bench . -cpu 1,4,8 ./skiplist
+
+const benchKeys = 100000
+
+var engines = []struct {
+	name     string
+	newStore func() store.Store
+}{
+	{"btree", func() store.Store { return store.NewSyncStore(btree.NewBtree(16)) }},
+	{"skiplist", func() store.Store { return NewSkipList() }},
+}
+
+func benchKey(i int) string {
+	return fmt.Sprintf("key%08d", i)
+}
+
+// returns a store holding benchKeys keys inserted in random order
+func filledStore(newStore func() store.Store) store.Store {
+	s := newStore()
+	for _, i := range rand.New(rand.NewSource(1)).Perm(benchKeys) {
+		s.Insert(benchKey(i), store.Value{"val": fmt.Sprint(i)})
+	}
+
+	return s
+}
+
+func BenchmarkInsert(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			s := engine.newStore()
+			keys := rand.New(rand.NewSource(1)).Perm(b.N)
+			value := store.Value{"val": "value"}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Insert(benchKey(keys[i]), value)
+			}
+		})
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			s := filledStore(engine.newStore)
+			r := rand.New(rand.NewSource(1))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Search(benchKey(r.Intn(benchKeys)))
+			}
+		})
+	}
+}
+
+func BenchmarkScan100(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			s := filledStore(engine.newStore)
+			r := rand.New(rand.NewSource(1))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Scan(store.ScanOptions{Start: benchKey(r.Intn(benchKeys)), Limit: 100}, func(string, store.Value) bool {
+					return true
+				})
+			}
+		})
+	}
+}
+
+// readers only, every goroutine searches random keys
+func BenchmarkParallelSearch(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			s := filledStore(engine.newStore)
+			var seed int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+				for pb.Next() {
+					s.Search(benchKey(r.Intn(benchKeys)))
+				}
+			})
+		})
+	}
+}
+
+// every goroutine searches random keys and replaces one key out of ten
+func BenchmarkParallelMixed(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			s := filledStore(engine.newStore)
+			value := store.Value{"val": "value"}
+			var seed int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+				for pb.Next() {
+					key := benchKey(r.Intn(benchKeys))
+					if r.Intn(10) == 0 {
+						s.Insert(key, value)
+					} else {
+						s.Search(key)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package skiplist
+
+import (
+	"github.com/tPhume/gokv/store"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Package contains a concurrent skip list implementation of store.Store
+// keys are kept in a sorted linked list, with higher levels of the list skipping over more and more nodes
+// writers are serialized by a mutex, readers take no lock at all: every link and value is published atomically
+// a node is fully built before it is linked in, and a removed node keeps its links so readers standing on it carry on
+// unlike SyncStore, a scan is not a point-in-time view, it sees writes that land ahead of it while it runs
+
+const (
+	// enough levels for billions of keys with p = 1/4
+	maxLevel = 16
+	// one node out of levelRatio is promoted to the next level
+	levelRatio = 4
+)
+
+var (
+	KeyDoesNotExist = store.KeyDoesNotExist
+)
+
+type node struct {
+	key string
+	// holds a store.Value that is never changed once stored, replaced as a whole by updates
+	value atomic.Value
+	// set once the node is unlinked, so readers that already reached it skip it
+	removed int32
+	// next node on every level of the node, *node behind unsafe.Pointer so they can be loaded atomically
+	next []unsafe.Pointer
+}
+
+func newNode(key string, value store.Value, level int) *node {
+	n := &node{key: key, next: make([]unsafe.Pointer, level)}
+	n.value.Store(value)
+
+	return n
+}
+
+func (n *node) loadNext(level int) *node {
+	return (*node)(atomic.LoadPointer(&n.next[level]))
+}
+
+func (n *node) storeNext(level int, next *node) {
+	atomic.StorePointer(&n.next[level], unsafe.Pointer(next))
+}
+
+func (n *node) load() store.Value {
+	return n.value.Load().(store.Value)
+}
+
+func (n *node) isRemoved() bool {
+	return atomic.LoadInt32(&n.removed) == 1
+}
+
+// SkipList is safe for concurrent use, Search and Scan never wait for writers
+type SkipList struct {
+	mu   sync.Mutex
+	head *node
+	// number of levels in use, only grows
+	level int32
+	// only used by writers, under mu
+	rand *rand.Rand
+}
+
+func NewSkipList() *SkipList {
+	return &SkipList{
+		head:  newNode("", nil, maxLevel),
+		level: 1,
+		rand:  rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// Concurrent marks the list as safe for concurrent use, see store.Concurrent
+func (s *SkipList) Concurrent() {}
+
+// inserting an existing key replaces its value
+func (s *SkipList) Insert(key string, value store.Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insert(key, value)
+
+	return nil
+}
+
+func (s *SkipList) Update(key string, value store.Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(key, value)
+}
+
+func (s *SkipList) Search(key string) store.Value {
+	n := s.seek(key)
+	if n == nil || n.key != key {
+		return nil
+	}
+
+	return store.CopyValue(n.load())
+}
+
+func (s *SkipList) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remove(key)
+}
+
+// ApplyBatch holds the writer lock for the whole batch, so it is all-or-nothing for other writers
+// readers never wait, so they can see the batch half applied
+func (s *SkipList) ApplyBatch(b *store.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return b.Apply(writer{s})
+}
+
+func (s *SkipList) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	count := 0
+	visit := func(n *node) bool {
+		if opts.Limit > 0 && count >= opts.Limit {
+			return false
+		}
+
+		count++
+		return fn(n.key, store.CopyValue(n.load()))
+	}
+
+	if opts.Reverse {
+		s.reverseScan(opts, visit)
+		return nil
+	}
+
+	for n := s.seek(opts.Start); n != nil; n = n.loadNext(0) {
+		if opts.End != "" && n.key >= opts.End {
+			break
+		}
+
+		if n.isRemoved() {
+			continue
+		}
+
+		if !visit(n) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// the list only links forward, so every step of a reverse scan looks up the node before the previous one
+func (s *SkipList) reverseScan(opts store.ScanOptions, visit func(*node) bool) {
+	bound, bounded := opts.End, opts.End != ""
+	for {
+		n := s.last(bound, bounded)
+		if n == nil || n.key < opts.Start {
+			return
+		}
+
+		if !visit(n) {
+			return
+		}
+
+		bound, bounded = n.key, true
+	}
+}
+
+// returns the first node with a key greater than or equal to key, nil if there is none
+func (s *SkipList) seek(key string) *node {
+	prev := s.head
+	for level := int(atomic.LoadInt32(&s.level)) - 1; level >= 0; level-- {
+		for next := prev.loadNext(level); next != nil && next.key < key; next = prev.loadNext(level) {
+			prev = next
+		}
+	}
+
+	for n := prev.loadNext(0); n != nil; n = n.loadNext(0) {
+		if !n.isRemoved() {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// returns the last node with a key smaller than bound, or the last node if it is not bounded
+func (s *SkipList) last(bound string, bounded bool) *node {
+	var found *node
+
+	prev := s.head
+	for level := int(atomic.LoadInt32(&s.level)) - 1; level >= 0; level-- {
+		for next := prev.loadNext(level); next != nil && (!bounded || next.key < bound); next = prev.loadNext(level) {
+			prev = next
+		}
+	}
+
+	// prev may have been removed meanwhile, walk forward to the last live node before the bound
+	if prev != s.head && !prev.isRemoved() {
+		found = prev
+	}
+
+	for n := prev.loadNext(0); n != nil && (!bounded || n.key < bound); n = n.loadNext(0) {
+		if !n.isRemoved() {
+			found = n
+		}
+	}
+
+	return found
+}
+
+// returns the node before key on every level, the caller must hold mu
+func (s *SkipList) predecessors(key string) [maxLevel]*node {
+	var preds [maxLevel]*node
+
+	prev := s.head
+	for level := maxLevel - 1; level >= 0; level-- {
+		for next := prev.loadNext(level); next != nil && next.key < key; next = prev.loadNext(level) {
+			prev = next
+		}
+		preds[level] = prev
+	}
+
+	return preds
+}
+
+func (s *SkipList) randomLevel() int {
+	level := 1
+	for level < maxLevel && s.rand.Intn(levelRatio) == 0 {
+		level++
+	}
+
+	return level
+}
+
+func (s *SkipList) insert(key string, value store.Value) {
+	preds := s.predecessors(key)
+	if n := preds[0].loadNext(0); n != nil && n.key == key {
+		n.value.Store(store.CopyValue(value))
+		return
+	}
+
+	level := s.randomLevel()
+	if level > int(s.level) {
+		atomic.StoreInt32(&s.level, int32(level))
+	}
+
+	// link bottom up, once it is reachable on level 0 the node is in the list
+	n := newNode(key, store.CopyValue(value), level)
+	for i := 0; i < level; i++ {
+		n.next[i] = unsafe.Pointer(preds[i].loadNext(i))
+		preds[i].storeNext(i, n)
+	}
+}
+
+func (s *SkipList) update(key string, value store.Value) error {
+	preds := s.predecessors(key)
+	n := preds[0].loadNext(0)
+	if n == nil || n.key != key {
+		return KeyDoesNotExist
+	}
+
+	n.value.Store(store.CopyValue(value))
+
+	return nil
+}
+
+func (s *SkipList) remove(key string) error {
+	preds := s.predecessors(key)
+	n := preds[0].loadNext(0)
+	if n == nil || n.key != key {
+		return KeyDoesNotExist
+	}
+
+	atomic.StoreInt32(&n.removed, 1)
+
+	// unlink top down, n keeps its own links for readers that already reached it
+	for i := len(n.next) - 1; i >= 0; i-- {
+		preds[i].storeNext(i, n.loadNext(i))
+	}
+
+	return nil
+}
+
+// writer gives batches access to the skip list while ApplyBatch holds the lock
+type writer struct {
+	s *SkipList
+}
+
+func (w writer) Insert(key string, value store.Value) error {
+	w.s.insert(key, value)
+	return nil
+}
+
+func (w writer) Update(key string, value store.Value) error {
+	return w.s.update(key, value)
+}
+
+func (w writer) Search(key string) store.Value {
+	return w.s.Search(key)
+}
+
+func (w writer) Remove(key string) error {
+	return w.s.remove(key)
+}
+
+func (w writer) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	return w.s.Scan(opts, fn)
+}
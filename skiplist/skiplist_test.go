@@ -0,0 +1,47 @@
+package skiplist
+
+import (
+	"github.com/tPhume/gokv/store/storetest"
+	"testing"
+)
+
+// checks that every level is sorted and only holds nodes that are also on the level below
+func checkList(t *testing.T, s *SkipList) {
+	for level := int(s.level) - 1; level >= 0; level-- {
+		last := ""
+		for n := s.head.loadNext(level); n != nil; n = n.loadNext(level) {
+			if n.key <= last && last != "" {
+				t.Fatalf("level %v: keys out of order [%v] after [%v]", level, n.key, last)
+			}
+
+			if n.isRemoved() || len(n.next) <= level {
+				t.Fatalf("level %v: unexpected node [%v]", level, n.key)
+			}
+			last = n.key
+		}
+	}
+}
+
+func TestSkipList_Random(t *testing.T) {
+	s := NewSkipList()
+	storetest.Random(t, s, nil, func() { checkList(t, s) })
+}
+
+func TestSkipList_Scan(t *testing.T) {
+	storetest.Scan(t, NewSkipList())
+}
+
+func TestSkipList_CopiesValues(t *testing.T) {
+	storetest.CopiesValues(t, NewSkipList())
+}
+
+func TestSkipList_ApplyBatch(t *testing.T) {
+	storetest.ApplyBatch(t, NewSkipList())
+}
+
+// readers run next to writers without locking
+func TestSkipList_Concurrent(t *testing.T) {
+	s := NewSkipList()
+	storetest.Concurrent(t, s)
+	checkList(t, s)
+}
@@ -0,0 +1,376 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Package contains point-in-time snapshots of a store.Store, for backups of a store in use
+// a snapshot holds every key-value pair in key order, the checksum covers every byte before it
+// | magic "GOKVSNAP" (8) | format version (1) |
+// | 1 (1) | key | field count (uvarint) | field | value | ... | expires (uvarint) |   for every pair
+// | 0 (1) | pair count (uvarint) | crc32 (4) |
+// strings are written as their length (uvarint) followed by their bytes
+// expires is the unix nano time the key expires at, 0 if it never expires
+// versions of the keys are not kept, restored keys get new ones
+
+var (
+	ErrCorrupted = errors.New("snapshot: corrupted file")
+	ErrVersion   = errors.New("snapshot: unsupported format version")
+)
+
+const (
+	magic = "GOKVSNAP"
+
+	// Version is the format version written by this package
+	Version = 1
+
+	// strings longer than this are taken for corruption rather than allocated
+	maxStringLength = 1 << 30
+
+	// degree of the btree snapshots are read into
+	minDegree = 3
+)
+
+// Write writes every pair of s with its expiry as it was at one point in time, see store.ScanEntries
+// and returns the number of pairs written
+func Write(w io.Writer, s store.Store) (int, error) {
+	crc := crc32.NewIEEE()
+	writer := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	buf := append([]byte(magic), Version)
+	if _, err := writer.Write(buf); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var writeErr error
+	err := store.ScanEntries(s, store.ScanOptions{}, func(e store.Entry) bool {
+		buf = appendEntry(buf[:0], e)
+		if _, writeErr = writer.Write(buf); writeErr != nil {
+			return false
+		}
+
+		count++
+		return true
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if writeErr != nil {
+		return 0, writeErr
+	}
+
+	buf = appendUvarint(append(buf[:0], 0), uint64(count))
+	if _, err := writer.Write(buf); err != nil {
+		return 0, err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc.Sum32())
+	if _, err := w.Write(sum[:]); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Save writes a snapshot of s to the file at path, which is only replaced once the snapshot is complete
+func Save(path string, s store.Store) (int, error) {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := Write(file, s)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return 0, err
+	}
+
+	// makes the rename durable
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return count, nil
+}
+
+// Read reads a snapshot into a new btree.Btree, keys keep their expiry and those that expired since are left out
+// nothing is returned unless the whole snapshot was read and its checksum matches
+func Read(r io.Reader) (*btree.Btree, error) {
+	reader := &hashReader{reader: bufio.NewReader(r), crc: crc32.NewIEEE()}
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, corrupted(err)
+	}
+
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrCorrupted
+	}
+
+	if header[len(magic)] != Version {
+		return nil, ErrVersion
+	}
+
+	tree := btree.NewBtree(minDegree)
+	count := uint64(0)
+	last := ""
+
+	for {
+		more, err := reader.ReadByte()
+		if err != nil {
+			return nil, corrupted(err)
+		}
+
+		if more == 0 {
+			break
+		}
+
+		if more != 1 {
+			return nil, ErrCorrupted
+		}
+
+		e, err := readEntry(reader)
+		if err != nil {
+			return nil, corrupted(err)
+		}
+
+		// pairs are written in key order, anything else is damage
+		if count > 0 && e.Key <= last {
+			return nil, ErrCorrupted
+		}
+
+		if e.Expires.IsZero() {
+			err = tree.Insert(e.Key, e.Value)
+		} else {
+			err = tree.InsertExpire(e.Key, e.Value, e.Expires)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		count++
+		last = e.Key
+	}
+
+	written, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, corrupted(err)
+	}
+
+	expected := reader.crc.Sum32()
+
+	var sum [4]byte
+	if _, err := io.ReadFull(reader.reader, sum[:]); err != nil {
+		return nil, corrupted(err)
+	}
+
+	if written != count || binary.LittleEndian.Uint32(sum[:]) != expected {
+		return nil, ErrCorrupted
+	}
+
+	return tree, nil
+}
+
+// Load reads the snapshot in the file at path into a new btree.Btree
+func Load(path string) (*btree.Btree, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Replace makes s hold exactly the pairs of from, such as a tree returned by Read, in a single batch
+// so readers of s see either every old pair or every new one, pairs keep their expiry
+// a write to s made while the batch is built may make it fail, nothing is changed then
+// store.ErrTTLNotSupported is returned if some pairs expire and s does not implement store.Expirer
+func Replace(s store.Store, from store.Store) error {
+	b := store.NewBatch()
+
+	err := s.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		if from.Search(key) == nil {
+			b.Remove(key)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = store.ScanEntries(from, store.ScanOptions{}, func(e store.Entry) bool {
+		if e.Expires.IsZero() {
+			b.Insert(e.Key, e.Value)
+		} else {
+			b.InsertExpire(e.Key, e.Value, e.Expires)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if b.Len() == 0 {
+		return nil
+	}
+
+	return store.ApplyBatch(s, b)
+}
+
+// hashes every byte read
+type hashReader struct {
+	reader *bufio.Reader
+	crc    hash.Hash32
+}
+
+func (h *hashReader) Read(p []byte) (int, error) {
+	n, err := h.reader.Read(p)
+	h.crc.Write(p[:n])
+
+	return n, err
+}
+
+func (h *hashReader) ReadByte() (byte, error) {
+	b, err := h.reader.ReadByte()
+	if err == nil {
+		h.crc.Write([]byte{b})
+	}
+
+	return b, err
+}
+
+func appendEntry(buf []byte, e store.Entry) []byte {
+	buf = append(buf, 1)
+	buf = appendString(buf, e.Key)
+
+	value := e.Value
+	fields := make([]string, 0, len(value))
+	for field := range value {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	buf = appendUvarint(buf, uint64(len(fields)))
+	for _, field := range fields {
+		buf = appendString(buf, field)
+		buf = appendString(buf, value[field])
+	}
+
+	expires := uint64(0)
+	if !e.Expires.IsZero() {
+		expires = uint64(e.Expires.UnixNano())
+	}
+
+	return appendUvarint(buf, expires)
+}
+
+func readEntry(reader *hashReader) (store.Entry, error) {
+	key, err := readString(reader)
+	if err != nil {
+		return store.Entry{}, err
+	}
+
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return store.Entry{}, err
+	}
+
+	e := store.Entry{Key: key, Value: make(store.Value)}
+	for i := uint64(0); i < count; i++ {
+		field, err := readString(reader)
+		if err != nil {
+			return store.Entry{}, err
+		}
+
+		if e.Value[field], err = readString(reader); err != nil {
+			return store.Entry{}, err
+		}
+	}
+
+	expires, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return store.Entry{}, err
+	}
+
+	if expires != 0 {
+		e.Expires = time.Unix(0, int64(expires))
+	}
+
+	return e, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(reader *hashReader) (string, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return "", err
+	}
+
+	if length > maxStringLength {
+		return "", ErrCorrupted
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+// a snapshot that ends early is corrupted, other errors come from the reader
+func corrupted(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupted
+	}
+
+	return err
+}
@@ -0,0 +1,226 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/tPhume/gokv/bplustree"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// returns every pair of s as "key=value" strings in key order
+func pairs(t *testing.T, s store.Store) []string {
+	var p []string
+	err := s.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		p = append(p, fmt.Sprintf("%v=%v", key, value))
+		return true
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestWriteRead(t *testing.T) {
+	tree := btree.NewBtree(3)
+	for i := 0; i < 100; i++ {
+		tree.Insert(fmt.Sprintf("key%03d", i), store.Value{"i": fmt.Sprint(i), "empty": ""})
+	}
+	tree.Insert("no fields", store.Value{})
+
+	var buf bytes.Buffer
+	count, err := Write(&buf, tree)
+	if err != nil || count != 101 {
+		t.Fatalf("expected 101 pairs, got = %v, %v", count, err)
+	}
+
+	restored, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(pairs(t, restored)) != fmt.Sprint(pairs(t, tree)) {
+		t.Fatalf("expected %v, got = %v", pairs(t, tree), pairs(t, restored))
+	}
+
+	// an empty store makes a valid snapshot too
+	buf.Reset()
+	if _, err := Write(&buf, btree.NewBtree(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored, err := Read(&buf); err != nil || len(pairs(t, restored)) != 0 {
+		t.Fatalf("expected an empty tree, got = %v", err)
+	}
+}
+
+func TestRead_Corrupted(t *testing.T) {
+	tree := btree.NewBtree(3)
+	for i := 0; i < 10; i++ {
+		tree.Insert(fmt.Sprint(i), store.Value{"i": fmt.Sprint(i)})
+	}
+
+	var buf bytes.Buffer
+	if _, err := Write(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// every truncation and every flipped byte is detected
+	for i := 0; i < len(data); i++ {
+		if _, err := Read(bytes.NewReader(data[:i])); err != ErrCorrupted {
+			t.Fatalf("truncated at %d: expected %v, got = %v", i, ErrCorrupted, err)
+		}
+
+		flipped := append([]byte(nil), data...)
+		flipped[i] ^= 0x40
+		if _, err := Read(bytes.NewReader(flipped)); err != ErrCorrupted && err != ErrVersion {
+			t.Fatalf("flipped at %d: expected %v, got = %v", i, ErrCorrupted, err)
+		}
+	}
+
+	future := append([]byte(nil), data...)
+	future[len(magic)] = Version + 1
+	if _, err := Read(bytes.NewReader(future)); err != ErrVersion {
+		t.Fatalf("expected %v, got = %v", ErrVersion, err)
+	}
+}
+
+func TestSave_Consistent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// every write moves one unit between two keys, a consistent snapshot always holds 100 units
+	s := store.NewSyncStore(btree.NewBtree(3))
+	s.Insert("a", store.Value{"units": "100"})
+	s.Insert("b", store.Value{"units": "0"})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			b := store.NewBatch()
+			b.Update("a", store.Value{"units": fmt.Sprint(100 - i%101)})
+			b.Update("b", store.Value{"units": fmt.Sprint(i % 101)})
+			store.ApplyBatch(s, b)
+		}
+	}()
+
+	path := filepath.Join(dir, "gokv.snapshot")
+	for i := 0; i < 50; i++ {
+		if _, err := Save(path, s); err != nil {
+			t.Fatal(err)
+		}
+
+		tree, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var a, b int
+		fmt.Sscan(tree.Search("a")["units"], &a)
+		fmt.Sscan(tree.Search("b")["units"], &b)
+		if a+b != 100 {
+			t.Fatalf("expected 100 units, got = %v + %v", a, b)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("expected the temporary file to be gone, got = %v", err)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	s.Insert("kept", store.Value{"v": "old"})
+	s.Insert("removed", store.Value{"v": "old"})
+
+	from := btree.NewBtree(3)
+	from.Insert("kept", store.Value{"v": "new"})
+	from.Insert("added", store.Value{"v": "new"})
+
+	if err := Replace(s, from); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[added=map[v:new] kept=map[v:new]]"
+	if got := fmt.Sprint(pairs(t, s)); got != expected {
+		t.Fatalf("expected %v, got = %v", expected, got)
+	}
+
+	// replacing with an empty store removes everything
+	if err := Replace(s, btree.NewBtree(3)); err != nil || len(pairs(t, s)) != 0 {
+		t.Fatalf("expected an empty store, got = %v, %v", pairs(t, s), err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+
+	tree := btree.NewBtree(3)
+	tree.InsertExpire("session", store.Value{"user": "a"}, at)
+	tree.InsertExpire("gone", store.Value{"user": "b"}, time.Now().Add(50*time.Millisecond))
+	tree.Insert("config", store.Value{"n": "1"})
+
+	var buf bytes.Buffer
+	if _, err := Write(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+
+	// a key that expired since the snapshot was taken is left out
+	time.Sleep(100 * time.Millisecond)
+
+	restored, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e, _ := store.SearchEntry(restored, "session"); !e.Expires.Equal(at) {
+		t.Fatalf("expected expiry [%v], got = [%v]", at, e.Expires)
+	}
+
+	if restored.Search("gone") != nil {
+		t.Fatal("expected the expired key to be left out")
+	}
+
+	s := store.NewSyncStore(btree.NewBtree(3))
+	if err := Replace(s, restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if e, _ := store.SearchEntry(s, "session"); !e.Expires.Equal(at) {
+		t.Fatalf("expected expiry [%v], got = [%v]", at, e.Expires)
+	}
+
+	if e, _ := store.SearchEntry(s, "config"); !e.Expires.IsZero() {
+		t.Fatalf("expected no expiry, got = [%v]", e.Expires)
+	}
+
+	// stores without expiries cannot take the keys that expire
+	if err := Replace(bplustree.NewBPlusTree(3), restored); !errors.Is(err, store.ErrTTLNotSupported) {
+		t.Fatalf("expected %v, got = %v", store.ErrTTLNotSupported, err)
+	}
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrUnknownOperation = errors.New("unknown batch operation")
+	// ErrCheckFailed is returned when the value or version of a key no longer matches an OpCheck of the batch
+	ErrCheckFailed = errors.New("key does not hold the expected value")
+)
+
+// OpType is the kind of mutation of a batch operation
+type OpType int
+
+const (
+	OpInsert OpType = iota
+	OpUpdate
+	OpRemove
+	// OpCheck does not change anything, it fails the batch unless the key holds Value
+	// a nil Value means the key must not exist, a check with a Version compares versions instead
+	OpCheck
+)
+
+// Operation is a single mutation of a batch, Value is ignored by OpRemove
+// Version is only set by checks made with CheckVersion, Expires only by inserts made with InsertExpire
+type Operation struct {
+	Type    OpType
+	Key     string
+	Value   Value
+	Version uint64
+	Expires time.Time
+}
+
+// Batch groups mutations that are applied all-or-nothing, in the order they were added
+type Batch struct {
+	ops []Operation
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+func (b *Batch) Insert(key string, value Value) {
+	b.ops = append(b.ops, Operation{Type: OpInsert, Key: key, Value: value})
+}
+
+// InsertExpire inserts key so it expires at the given time, the batch fails with ErrTTLNotSupported
+// on stores that do not implement Expirer
+func (b *Batch) InsertExpire(key string, value Value, at time.Time) {
+	b.ops = append(b.ops, Operation{Type: OpInsert, Key: key, Value: value, Expires: at})
+}
+
+func (b *Batch) Update(key string, value Value) {
+	b.ops = append(b.ops, Operation{Type: OpUpdate, Key: key, Value: value})
+}
+
+func (b *Batch) Remove(key string) {
+	b.ops = append(b.ops, Operation{Type: OpRemove, Key: key})
+}
+
+// Check makes the batch fail with ErrCheckFailed unless key holds value when the batch is applied
+// a nil value means the key must not exist
+func (b *Batch) Check(key string, value Value) {
+	b.ops = append(b.ops, Operation{Type: OpCheck, Key: key, Value: value})
+}
+
+// CheckVersion makes the batch fail with ErrCheckFailed unless key is at version when the batch is applied
+// so a key changed and changed back in the meantime fails it too, see Versioner
+// the check fails if an earlier operation of the batch writes key, the version it gets is not known yet
+func (b *Batch) CheckVersion(key string, version uint64) {
+	b.ops = append(b.ops, Operation{Type: OpCheck, Key: key, Version: version})
+}
+
+func (b *Batch) Operations() []Operation {
+	return b.ops
+}
+
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// BatchError reports which operation stopped a batch, Err is the error of that operation
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Batcher is implemented by stores that apply a batch atomically on their own
+type Batcher interface {
+	ApplyBatch(*Batch) error
+}
+
+// ApplyBatch applies every operation of b to s or none of them
+// stores that do not implement Batcher get the batch checked first, then applied one operation
+// at a time with the previous entries restored if an operation fails
+func ApplyBatch(s Store, b *Batch) error {
+	if batcher, ok := s.(Batcher); ok {
+		return batcher.ApplyBatch(b)
+	}
+
+	return b.Apply(s)
+}
+
+// Validate checks that every update and remove of the batch targets a key that exists
+// and every check holds at that point of the batch, without changing s
+func (b *Batch) Validate(s Store) error {
+	// value of the keys as changed by the operations seen so far, nil if removed
+	values := make(map[string]Value)
+	for i, op := range b.ops {
+		current, ok := values[op.Key]
+		if !ok {
+			current = s.Search(op.Key)
+		}
+
+		switch op.Type {
+		case OpInsert:
+			if _, ok := s.(Expirer); !ok && !op.Expires.IsZero() {
+				return &BatchError{Index: i, Err: ErrTTLNotSupported}
+			}
+
+			values[op.Key] = op.Value
+		case OpUpdate:
+			if current == nil {
+				return &BatchError{Index: i, Err: KeyDoesNotExist}
+			}
+
+			values[op.Key] = op.Value
+		case OpRemove:
+			if current == nil {
+				return &BatchError{Index: i, Err: KeyDoesNotExist}
+			}
+
+			values[op.Key] = nil
+		case OpCheck:
+			if op.Version != 0 {
+				_, written := values[op.Key]
+				if _, version := SearchVersion(s, op.Key); written || version != op.Version {
+					return &BatchError{Index: i, Err: ErrCheckFailed}
+				}
+			} else if !EqualValues(current, op.Value) {
+				return &BatchError{Index: i, Err: ErrCheckFailed}
+			}
+		default:
+			return &BatchError{Index: i, Err: ErrUnknownOperation}
+		}
+	}
+
+	return nil
+}
+
+// Apply validates the batch then applies it to s one operation at a time
+// restoring the previous entries if an operation fails, it is used by Batcher implementations
+// that wrap another store
+// keys of a Restorer get their expiry and version back, other stores only keep values
+func (b *Batch) Apply(s Store) error {
+	if err := b.Validate(s); err != nil {
+		return err
+	}
+
+	// previous entry of every applied operation, with a nil value if the key did not exist
+	undo := make([]Entry, 0, len(b.ops))
+	for i, op := range b.ops {
+		previous, _ := SearchEntry(s, op.Key)
+
+		var err error
+		switch op.Type {
+		case OpCheck:
+			// already verified by Validate
+		case OpInsert:
+			if op.Expires.IsZero() {
+				err = s.Insert(op.Key, op.Value)
+			} else {
+				err = s.(Expirer).InsertExpire(op.Key, op.Value, op.Expires)
+			}
+		case OpUpdate:
+			err = s.Update(op.Key, op.Value)
+		case OpRemove:
+			err = s.Remove(op.Key)
+		}
+
+		if err != nil {
+			b.rollback(s, undo)
+			return &BatchError{Index: i, Err: err}
+		}
+
+		undo = append(undo, previous)
+	}
+
+	return nil
+}
+
+// utility function to restore the entries replaced by the first len(undo) operations, newest first
+func (b *Batch) rollback(s Store, undo []Entry) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		if b.ops[i].Type == OpCheck {
+			continue
+		}
+
+		if undo[i].Value == nil {
+			s.Remove(b.ops[i].Key)
+		} else {
+			Restore(s, undo[i])
+		}
+	}
+}
+
+// EqualValues checks if two values hold the same fields, nil is only equal to nil
+func EqualValues(a, b Value) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+
+	for field, value := range a {
+		if other, ok := b[field]; !ok || other != value {
+			return false
+		}
+	}
+
+	return true
+}
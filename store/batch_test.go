@@ -0,0 +1,176 @@
+package store_test
+
+import (
+	"errors"
+	"github.com/tPhume/gokv/art"
+	"github.com/tPhume/gokv/bplustree"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/hashstore"
+	"github.com/tPhume/gokv/skiplist"
+	"github.com/tPhume/gokv/store"
+	"testing"
+	"time"
+)
+
+var errFailing = errors.New("failing store")
+
+// failingStore fails every insert of the key "fail"
+type failingStore struct {
+	*btree.Btree
+}
+
+func (f *failingStore) Insert(key string, value store.Value) error {
+	if key == "fail" {
+		return errFailing
+	}
+
+	return f.Btree.Insert(key, value)
+}
+
+func TestApplyBatch(t *testing.T) {
+	stores := map[string]func() store.Store{
+		"btree":      func() store.Store { return btree.NewBtree(3) },
+		"sync btree": func() store.Store { return store.NewSyncStore(btree.NewBtree(3)) },
+		"cow btree":  func() store.Store { return btree.NewCowBtree(3) },
+		"bplustree":  func() store.Store { return bplustree.NewBPlusTree(4) },
+		"skiplist":   func() store.Store { return skiplist.NewSkipList() },
+		"hashstore":  func() store.Store { return hashstore.NewHashStore(4) },
+		"art":        func() store.Store { return art.NewRadixTree() },
+	}
+
+	for name, newStore := range stores {
+		s := newStore()
+		if err := s.Insert("A", store.Value{"val": "A"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// insert then update a key inside the same batch
+		b := store.NewBatch()
+		b.Insert("B", store.Value{"val": "B"})
+		b.Update("B", store.Value{"val": "new B"})
+		b.Remove("A")
+		if err := store.ApplyBatch(s, b); err != nil {
+			t.Fatalf("%v, got error = [%v]", name, err)
+		}
+
+		if v := s.Search("B"); v["val"] != "new B" {
+			t.Fatalf("%v, expected [new B], got = [%v]", name, v)
+		}
+
+		if v := s.Search("A"); v != nil {
+			t.Fatalf("%v, expected nil, got = [%v]", name, v)
+		}
+
+		// nothing is applied when an operation targets a missing key
+		b = store.NewBatch()
+		b.Insert("C", store.Value{"val": "C"})
+		b.Remove("B")
+		b.Update("B", store.Value{"val": "B again"})
+
+		err := store.ApplyBatch(s, b)
+
+		var batchErr *store.BatchError
+		if !errors.As(err, &batchErr) || batchErr.Index != 2 || batchErr.Err != store.KeyDoesNotExist {
+			t.Fatalf("%v, expected error at operation [2], got = [%v]", name, err)
+		}
+
+		if v := s.Search("C"); v != nil {
+			t.Fatalf("%v, expected nil, got = [%v]", name, v)
+		}
+
+		if v := s.Search("B"); v["val"] != "new B" {
+			t.Fatalf("%v, expected [new B], got = [%v]", name, v)
+		}
+	}
+}
+
+func TestApplyBatch_Rollback(t *testing.T) {
+	s := &failingStore{Btree: btree.NewBtree(3)}
+	at := time.Now().Add(time.Hour)
+	if err := s.InsertExpire("A", store.Value{"val": "A"}, at); err != nil {
+		t.Fatal(err)
+	}
+
+	_, version := s.SearchVersion("A")
+
+	b := store.NewBatch()
+	b.Update("A", store.Value{"val": "new A"})
+	b.Insert("B", store.Value{"val": "B"})
+	b.Remove("A")
+	b.Insert("fail", store.Value{"val": "fail"})
+
+	err := store.ApplyBatch(s, b)
+	if !errors.Is(err, errFailing) {
+		t.Fatalf("expected error = [%v], got = [%v]", errFailing, err)
+	}
+
+	// A is back as it was, with its expiry and version
+	e, _ := s.SearchEntry("A")
+	if e.Value["val"] != "A" || !e.Expires.Equal(at) || e.Version != version {
+		t.Fatalf("expected [A] at [%v] expiring at [%v], got = [%+v]", version, at, e)
+	}
+
+	if v := s.Search("B"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+}
+
+func TestBatch_CheckVersion(t *testing.T) {
+	s := btree.NewBtree(3)
+	s.Insert("A", store.Value{"val": "A"})
+	_, version := s.SearchVersion("A")
+
+	// same value, new version
+	s.Insert("A", store.Value{"val": "A"})
+
+	b := store.NewBatch()
+	b.CheckVersion("A", version)
+	b.Insert("B", store.Value{"val": "B"})
+	if err := store.ApplyBatch(s, b); !errors.Is(err, store.ErrCheckFailed) {
+		t.Fatalf("expected error = [ErrCheckFailed], got = [%v]", err)
+	}
+
+	_, version = s.SearchVersion("A")
+	b = store.NewBatch()
+	b.CheckVersion("A", version)
+	b.Insert("B", store.Value{"val": "B"})
+	if err := store.ApplyBatch(s, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// the version A gets from the batch is not known before it is applied
+	b = store.NewBatch()
+	b.Insert("A", store.Value{"val": "new A"})
+	b.CheckVersion("A", version)
+	if err := store.ApplyBatch(s, b); !errors.Is(err, store.ErrCheckFailed) {
+		t.Fatalf("expected error = [ErrCheckFailed], got = [%v]", err)
+	}
+}
+
+func TestBatch_InsertExpire(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+
+	b := store.NewBatch()
+	b.Insert("A", store.Value{"val": "A"})
+	b.InsertExpire("B", store.Value{"val": "B"}, at)
+
+	s := btree.NewBtree(3)
+	if err := store.ApplyBatch(s, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if e, _ := s.SearchEntry("B"); !e.Expires.Equal(at) {
+		t.Fatalf("expected expiry [%v], got = [%v]", at, e.Expires)
+	}
+
+	// stores without expiries refuse the whole batch
+	for _, s := range []store.Store{bplustree.NewBPlusTree(3), skiplist.NewSkipList(), btree.NewCowBtree(3)} {
+		if err := store.ApplyBatch(s, b); !errors.Is(err, store.ErrTTLNotSupported) {
+			t.Fatalf("%T: expected error = [ErrTTLNotSupported], got = [%v]", s, err)
+		}
+
+		if s.Search("A") != nil {
+			t.Fatalf("%T: expected nothing applied", s)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package store
+
+// ConsistentScanner is implemented by stores whose scans can see every key as it was at one point in time
+// while writes go on, such as for a backup of a store in use
+type ConsistentScanner interface {
+	// ScanConsistent calls fn for every key in the range of opts as they all were when the scan started
+	ScanConsistent(opts ScanOptions, fn ScanFunc) error
+}
+
+// ScanConsistent calls fn for every key in the range of opts as they all were at one point in time
+// stores that do not implement ConsistentScanner are scanned with Scan, which is consistent
+// as long as nothing writes to them meanwhile
+func ScanConsistent(s Store, opts ScanOptions, fn ScanFunc) error {
+	scanner, ok := s.(ConsistentScanner)
+	if !ok {
+		return s.Scan(opts, fn)
+	}
+
+	return scanner.ScanConsistent(opts, fn)
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	// ErrNotInteger is returned when a counter field holds something other than a base 10 integer
+	ErrNotInteger = errors.New("field is not an integer")
+	// ErrOverflow is returned when an increment would not fit in an int64
+	ErrOverflow = errors.New("counter overflow")
+)
+
+// Incrementer is implemented by stores that increment counter fields on their own
+type Incrementer interface {
+	// Increment adds delta to field of key and returns the new value
+	Increment(key string, field string, delta int64) (int64, error)
+}
+
+// Increment adds delta, which may be negative, to the integer held by field of key and returns the new value
+// a missing field counts as 0, and a missing key is inserted with only that field
+// an existing key keeps its expiry
+// stores that do not implement Incrementer get a search followed by a write
+func Increment(s Store, key string, field string, delta int64) (int64, error) {
+	if incrementer, ok := s.(Incrementer); ok {
+		return incrementer.Increment(key, field, delta)
+	}
+
+	e, _ := SearchEntry(s, key)
+	value := e.Value
+
+	var current int64
+	if v, ok := value[field]; ok {
+		var err error
+		if current, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+
+	current += delta
+	set := Value{field: strconv.FormatInt(current, 10)}
+
+	var err error
+	if value == nil {
+		err = s.Insert(key, set)
+	} else {
+		err = updateKeepExpiry(s, e, MergeValue(value, set, nil))
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return current, nil
+}
@@ -0,0 +1,81 @@
+package store_test
+
+import (
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncrement(t *testing.T) {
+	s := btree.NewBtree(3)
+
+	// missing key and field start at 0
+	if n, err := store.Increment(s, "page", "views", 1); err != nil || n != 1 {
+		t.Fatalf("expected [1], got = [%v] error = [%v]", n, err)
+	}
+
+	s.Update("page", store.Value{"views": "1", "title": "home"})
+
+	if n, err := store.Increment(s, "page", "views", -3); err != nil || n != -2 {
+		t.Fatalf("expected [-2], got = [%v] error = [%v]", n, err)
+	}
+
+	if v := s.Search("page"); v["title"] != "home" || v["views"] != "-2" {
+		t.Fatalf("expected other fields to be kept, got = [%v]", v)
+	}
+
+	if _, err := store.Increment(s, "page", "title", 1); err != store.ErrNotInteger {
+		t.Fatalf("expected error = [ErrNotInteger], got = [%v]", err)
+	}
+
+	s.Insert("max", store.Value{"n": strconv.FormatInt(math.MaxInt64, 10)})
+	if _, err := store.Increment(s, "max", "n", 1); err != store.ErrOverflow {
+		t.Fatalf("expected error = [ErrOverflow], got = [%v]", err)
+	}
+}
+
+func TestIncrement_KeepsExpiry(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	at := time.Now().Add(time.Hour)
+
+	if err := s.InsertExpire("page", store.Value{"views": "1"}, at); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := store.Increment(s, "page", "views", 1); err != nil || n != 2 {
+		t.Fatalf("expected [2], got = [%v] error = [%v]", n, err)
+	}
+
+	if e, _ := store.SearchEntry(s, "page"); e.Value["views"] != "2" || !e.Expires.Equal(at) {
+		t.Fatalf("expected [2] expiring at [%v], got = [%+v]", at, e)
+	}
+}
+
+// run with -race
+func TestIncrement_Concurrent(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				if _, err := store.Increment(s, "page", "views", 1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v := s.Search("page"); v["views"] != "800" {
+		t.Fatalf("expected [800], got = [%v]", v)
+	}
+}
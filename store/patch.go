@@ -0,0 +1,52 @@
+package store
+
+// Patcher is implemented by stores that merge a patch into the value of a key on their own
+type Patcher interface {
+	// Patch sets the fields of set and deletes the fields of remove in the value of key
+	Patch(key string, set Value, remove []string) error
+}
+
+// Patch sets the fields of set and deletes the fields of remove in the value of key
+// KeyDoesNotExist is returned if key is missing, a field both set and removed is removed
+// the key keeps its expiry
+// stores that do not implement Patcher get a search followed by an update
+func Patch(s Store, key string, set Value, remove []string) error {
+	if patcher, ok := s.(Patcher); ok {
+		return patcher.Patch(key, set, remove)
+	}
+
+	e, ok := SearchEntry(s, key)
+	if !ok {
+		return KeyDoesNotExist
+	}
+
+	return updateKeepExpiry(s, e, MergeValue(e.Value, set, remove))
+}
+
+// utility function that writes value over the key of e, which keeps the expiry e has
+func updateKeepExpiry(s Store, e Entry, value Value) error {
+	expirer, ok := s.(Expirer)
+	if !ok || e.Expires.IsZero() {
+		return s.Update(e.Key, value)
+	}
+
+	return expirer.UpdateExpire(e.Key, value, e.Expires)
+}
+
+// MergeValue returns a copy of value with the fields of set added and the fields of remove deleted
+func MergeValue(value Value, set Value, remove []string) Value {
+	merged := make(Value, len(value)+len(set))
+	for field, v := range value {
+		merged[field] = v
+	}
+
+	for field, v := range set {
+		merged[field] = v
+	}
+
+	for _, field := range remove {
+		delete(merged, field)
+	}
+
+	return merged
+}
@@ -0,0 +1,50 @@
+package store_test
+
+import (
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"testing"
+	"time"
+)
+
+func TestPatch(t *testing.T) {
+	stores := map[string]store.Store{
+		"btree":      btree.NewBtree(3),
+		"sync btree": store.NewSyncStore(btree.NewBtree(3)),
+	}
+
+	for name, s := range stores {
+		s.Insert("A", store.Value{"name": "A", "email": "a@gokv", "phone": "000"})
+
+		if err := store.Patch(s, "A", store.Value{"email": "new@gokv", "city": "BKK"}, []string{"phone", "missing"}); err != nil {
+			t.Fatalf("%v, got error = [%v]", name, err)
+		}
+
+		expected := store.Value{"name": "A", "email": "new@gokv", "city": "BKK"}
+		if v := s.Search("A"); !store.EqualValues(v, expected) {
+			t.Fatalf("%v, expected [%v], got = [%v]", name, expected, v)
+		}
+
+		if err := store.Patch(s, "B", store.Value{"name": "B"}, nil); err != store.KeyDoesNotExist {
+			t.Fatalf("%v, expected error = [KeyDoesNotExist], got = [%v]", name, err)
+		}
+	}
+}
+
+func TestPatch_KeepsExpiry(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	at := time.Now().Add(time.Hour)
+
+	if err := s.InsertExpire("A", store.Value{"name": "A"}, at); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Patch(s, "A", store.Value{"email": "a@gokv"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := store.SearchEntry(s, "A")
+	if expected := (store.Value{"name": "A", "email": "a@gokv"}); !store.EqualValues(e.Value, expected) || !e.Expires.Equal(at) {
+		t.Fatalf("expected [%v] expiring at [%v], got = [%+v]", expected, at, e)
+	}
+}
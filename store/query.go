@@ -0,0 +1,23 @@
+package store
+
+import "errors"
+
+// ErrNotIndexed is returned when a query uses a field the store has no index for
+var ErrNotIndexed = errors.New("field is not indexed")
+
+// Querier is implemented by stores that can find keys by the value of one of their fields
+type Querier interface {
+	// Query calls fn for every key in the range of opts whose value has field set to value, in key order
+	Query(field string, value string, opts ScanOptions, fn ScanFunc) error
+}
+
+// Query calls fn for every key in the range of opts whose value has field set to value
+// stores that do not implement Querier return ErrNotIndexed rather than scanning every key
+func Query(s Store, field string, value string, opts ScanOptions, fn ScanFunc) error {
+	querier, ok := s.(Querier)
+	if !ok {
+		return ErrNotIndexed
+	}
+
+	return querier.Query(field, value, opts, fn)
+}
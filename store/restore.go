@@ -0,0 +1,70 @@
+package store
+
+import "time"
+
+// Entry is a key as a store holds it, with the time it expires at and the version it was written at
+type Entry struct {
+	Key   string
+	Value Value
+	// zero if the key never expires
+	Expires time.Time
+	// 0 for stores without versions
+	Version uint64
+}
+
+// Restorer is implemented by stores that can read keys with their expiry and version and write them back as they were
+// so a write can be undone, or the store saved and reloaded, without losing either
+type Restorer interface {
+	// SearchEntry returns the entry of key, false if it does not exist
+	SearchEntry(key string) (Entry, bool)
+	// ScanEntries calls fn for every entry in the range of opts as they all were when the scan started
+	ScanEntries(opts ScanOptions, fn func(Entry) bool) error
+	// Restore writes e without handing out a new version, versions handed out afterwards are bigger than e.Version
+	Restore(e Entry) error
+}
+
+// SearchEntry returns the entry of key, false if it does not exist
+// stores that do not implement Restorer report no expiry and the version of SearchVersion
+func SearchEntry(s Store, key string) (Entry, bool) {
+	if restorer, ok := s.(Restorer); ok {
+		return restorer.SearchEntry(key)
+	}
+
+	value, version := SearchVersion(s, key)
+	if value == nil {
+		return Entry{}, false
+	}
+
+	return Entry{Key: key, Value: value, Version: version}, true
+}
+
+// ScanEntries calls fn for every entry in the range of opts as they all were at one point in time
+// stores that do not implement Restorer are scanned with ScanConsistent and report no expiry and no version
+func ScanEntries(s Store, opts ScanOptions, fn func(Entry) bool) error {
+	if restorer, ok := s.(Restorer); ok {
+		return restorer.ScanEntries(opts, fn)
+	}
+
+	return ScanConsistent(s, opts, func(key string, value Value) bool {
+		return fn(Entry{Key: key, Value: value})
+	})
+}
+
+// Restore writes e back as it was read, stores that do not implement Restorer get it inserted
+// with its expiry and a new version
+func Restore(s Store, e Entry) error {
+	if restorer, ok := s.(Restorer); ok {
+		return restorer.Restore(e)
+	}
+
+	if e.Expires.IsZero() {
+		return s.Insert(e.Key, e.Value)
+	}
+
+	expirer, ok := s.(Expirer)
+	if !ok {
+		return ErrTTLNotSupported
+	}
+
+	return expirer.InsertExpire(e.Key, e.Value, e.Expires)
+}
@@ -1,14 +1,75 @@
 package store
 
+import "errors"
+
 // Universal interface that btree must implement
 // Only support string as key and map[string]string as value type
 // Store type is used by the api package - btree and lsm is never accessed direct
 
+var (
+	// KeyDoesNotExist is returned by every Store implementation when the key is missing
+	KeyDoesNotExist = errors.New("key does not exist")
+)
+
 type Value map[string]string
 
+// CopyValue returns a copy of v that can be changed without changing v, nil if v is nil
+// stores copy values on the way in and out so callers never share them
+func CopyValue(v Value) Value {
+	if v == nil {
+		return nil
+	}
+
+	c := make(Value, len(v))
+	for field, value := range v {
+		c[field] = value
+	}
+
+	return c
+}
+
+// Inserting a key that already exists replaces its value
+// stores are not safe for concurrent use unless their doc says so, and neither are the stores wrapping them
+// nor the helpers of this package falling back to several calls, wrap them with SyncStore to share them
 type Store interface {
 	Insert(string, Value) error
 	Update(string, Value) error
 	Search(string) Value
 	Remove(string) error
+	Scan(ScanOptions, ScanFunc) error
+}
+
+// ScanOptions bounds an ordered scan over the keys of a store
+type ScanOptions struct {
+	// first key of the range, inclusive, empty starts at the smallest key
+	Start string
+	// last key of the range, exclusive, empty runs to the biggest key
+	End string
+	// maximum number of key-value pairs, 0 means no limit
+	Limit int
+	// visit keys in descending order, starting from the biggest key before End
+	Reverse bool
+}
+
+// ScanFunc is called for every key-value pair in order, returning false stops the scan
+// the value is a copy and can be kept by the caller
+type ScanFunc func(key string, value Value) bool
+
+// InRange checks if key is between Start and End
+func (o ScanOptions) InRange(key string) bool {
+	return key >= o.Start && (o.End == "" || key < o.End)
+}
+
+// PrefixEnd returns the smallest key bigger than every key starting with prefix
+// it can be used as ScanOptions.End, empty means there is no such key
+func PrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	return ""
 }
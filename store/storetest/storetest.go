@@ -0,0 +1,350 @@
+package storetest
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// Conformance tests shared by the store.Store implementations
+// every test takes an empty store, engines add the checks of their own structure through check
+
+// Random runs random inserts, updates and removes against s and compares it with a map
+// key returns the key of the next operation, nil uses 500 keys of the same length
+// check verifies the structure of s, it is called every 100 operations and after every key is removed, it may be nil
+func Random(t *testing.T, s store.Store, key func(r *rand.Rand) string, check func()) {
+	if key == nil {
+		key = func(r *rand.Rand) string {
+			return fmt.Sprintf("key%04d", r.Intn(500))
+		}
+	}
+
+	if check == nil {
+		check = func() {}
+	}
+
+	r := rand.New(rand.NewSource(1))
+	expected := make(map[string]string)
+
+	for i := 0; i < 10000; i++ {
+		key := key(r)
+		val := fmt.Sprint(i)
+
+		switch r.Intn(4) {
+		case 0:
+			err := s.Remove(key)
+			if _, ok := expected[key]; ok != (err == nil) {
+				t.Fatalf("remove [%v], got error = [%v]", key, err)
+			}
+
+			delete(expected, key)
+		case 1:
+			err := s.Update(key, store.Value{"val": val})
+			if _, ok := expected[key]; ok != (err == nil) {
+				t.Fatalf("update [%v], got error = [%v]", key, err)
+			}
+
+			if err == nil {
+				expected[key] = val
+			}
+		default:
+			if err := s.Insert(key, store.Value{"val": val}); err != nil {
+				t.Fatal(err)
+			}
+			expected[key] = val
+		}
+
+		if i%100 == 0 {
+			check()
+		}
+	}
+
+	for key, value := range expected {
+		if v := s.Search(key); v["val"] != value {
+			t.Fatalf("key [%v], expected [%v], got = [%v]", key, value, v)
+		}
+	}
+
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// random ranges are compared with the sorted keys
+	for i := 0; i < 500; i++ {
+		opts := store.ScanOptions{Limit: r.Intn(20), Reverse: r.Intn(2) == 0}
+		if r.Intn(4) > 0 {
+			opts.Start = key(r)
+		}
+
+		if r.Intn(4) > 0 {
+			opts.End = key(r)
+		}
+
+		var want []string
+		for _, key := range keys {
+			if opts.InRange(key) {
+				want = append(want, key)
+			}
+		}
+
+		if opts.Reverse {
+			for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+				want[i], want[j] = want[j], want[i]
+			}
+		}
+
+		if opts.Limit > 0 && len(want) > opts.Limit {
+			want = want[:opts.Limit]
+		}
+
+		var got []string
+		if err := s.Scan(opts, func(key string, value store.Value) bool {
+			if value["val"] != expected[key] {
+				t.Fatalf("key [%v], expected [%v], got = [%v]", key, expected[key], value)
+			}
+
+			got = append(got, key)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%+v: expected %v, got = %v", opts, want, got)
+		}
+	}
+
+	// removing everything leaves an empty store
+	for _, key := range keys {
+		if err := s.Remove(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		t.Fatalf("expected an empty store, got key [%v]", key)
+		return false
+	})
+
+	check()
+}
+
+// Scan checks ranges, limits and directions of scans over 1000 keys
+// stores implementing store.ConsistentScanner get the same checks for ScanConsistent
+func Scan(t *testing.T, s store.Store) {
+	for i := 0; i < 1000; i++ {
+		if err := s.Insert(fmt.Sprintf("key%04d", i), store.Value{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		opts        store.ScanOptions
+		count       int
+		first, last string
+	}{
+		{"all", store.ScanOptions{}, 1000, "key0000", "key0999"},
+		{"range", store.ScanOptions{Start: "key0100", End: "key0200"}, 100, "key0100", "key0199"},
+		{"start between keys", store.ScanOptions{Start: "key0100a", End: "key0103"}, 2, "key0101", "key0102"},
+		{"limit", store.ScanOptions{Start: "key0500", Limit: 10}, 10, "key0500", "key0509"},
+		{"reverse", store.ScanOptions{End: "key0500", Reverse: true}, 500, "key0499", "key0000"},
+		{"reverse all", store.ScanOptions{Reverse: true}, 1000, "key0999", "key0000"},
+		{"reverse range limit", store.ScanOptions{Start: "key0100", End: "key0200", Limit: 5, Reverse: true}, 5, "key0199", "key0195"},
+	}
+
+	scans := []func(store.ScanOptions, store.ScanFunc) error{s.Scan}
+	if scanner, ok := s.(store.ConsistentScanner); ok {
+		scans = append(scans, scanner.ScanConsistent)
+	}
+
+	for _, scan := range scans {
+		for _, test := range tests {
+			var keys []string
+			if err := scan(test.opts, func(key string, value store.Value) bool {
+				keys = append(keys, key)
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(keys) != test.count || keys[0] != test.first || keys[len(keys)-1] != test.last {
+				t.Fatalf("%v: expected [%v] keys from [%v] to [%v], got = [%v] keys %v", test.name, test.count, test.first, test.last, len(keys), keys)
+			}
+		}
+
+		// stopping early
+		count := 0
+		scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+			count++
+			return count < 3
+		})
+
+		if count != 3 {
+			t.Fatalf("expected scan to stop after [3] keys, got = [%v]", count)
+		}
+	}
+}
+
+// CopiesValues checks that values written, searched and scanned are not shared with the caller
+func CopiesValues(t *testing.T, s store.Store) {
+	value := store.Value{"val": "A"}
+	s.Insert("A", value)
+	value["val"] = "changed"
+
+	found := s.Search("A")
+	found["val"] = "changed"
+
+	s.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		value["val"] = "changed"
+		return true
+	})
+
+	if v := s.Search("A"); v["val"] != "A" {
+		t.Fatalf("expected [A], got = [%v]", v["val"])
+	}
+
+	if v := s.Search("missing"); v != nil {
+		t.Fatalf("expected nil, got = %v", v)
+	}
+}
+
+// ApplyBatch checks that a batch failing part way leaves s unchanged
+func ApplyBatch(t *testing.T, s store.Store) {
+	s.Insert("A", store.Value{"val": "A"})
+
+	b := store.NewBatch()
+	b.Insert("B", store.Value{"val": "B"})
+	b.Remove("A")
+	b.Update("missing", store.Value{})
+
+	if err := store.ApplyBatch(s, b); err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+
+	if s.Search("A") == nil || s.Search("B") != nil {
+		t.Fatalf("expected the batch to leave the store unchanged")
+	}
+}
+
+// Concurrent runs readers next to writers, they must never see a key out of order
+// or a key that is never removed go missing, s must be safe for concurrent use, run with -race
+func Concurrent(t *testing.T, s store.Store) {
+	for i := 0; i < 100; i++ {
+		s.Insert(fmt.Sprintf("stable%03d", i), store.Value{"val": "stable"})
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("key%03d", r.Intn(200))
+				if r.Intn(2) == 0 {
+					s.Insert(key, store.Value{"val": fmt.Sprint(i)})
+				} else {
+					s.Remove(key)
+				}
+			}
+		}(w)
+	}
+
+	errs := make(chan error, 8)
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+		go func(reverse bool) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				stable, last := 0, ""
+				s.Scan(store.ScanOptions{Reverse: reverse}, func(key string, value store.Value) bool {
+					if last != "" && (key > last) == reverse {
+						errs <- fmt.Errorf("keys out of order [%v] after [%v]", key, last)
+						return false
+					}
+
+					if value["val"] == "stable" {
+						stable++
+					}
+					last = key
+					return true
+				})
+
+				if stable != 100 {
+					errs <- fmt.Errorf("expected [100] stable keys, got = [%v]", stable)
+					return
+				}
+
+				if s.Search("stable050") == nil {
+					errs <- fmt.Errorf("stable key is missing")
+					return
+				}
+			}
+		}(reader%2 == 0)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+// ReadModifyWrite runs store.Increment and store.Patch from many goroutines at once, no update may be lost
+// s must be shared the way the servers share it, see store.Share, the keys are removed at the end
+func ReadModifyWrite(t *testing.T, s store.Store) {
+	if err := s.Insert("patched", store.Value{}); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, writes = 8, 2000
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				if _, err := store.Increment(s, "counter", "n", 1); err != nil {
+					errs <- err
+					return
+				}
+
+				// every goroutine sets a field of its own, a lost patch drops the field of another
+				if err := store.Patch(s, "patched", store.Value{fmt.Sprint("w", w): fmt.Sprint(i)}, nil); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if v := s.Search("counter"); v["n"] != fmt.Sprint(workers*writes) {
+		t.Fatalf("expected [%v], got = [%v]", workers*writes, v["n"])
+	}
+
+	patched := s.Search("patched")
+	for w := 0; w < workers; w++ {
+		if field := fmt.Sprint("w", w); patched[field] != fmt.Sprint(writes-1) {
+			t.Fatalf("field [%v], expected [%v], got = [%v]", field, writes-1, patched[field])
+		}
+	}
+
+	s.Remove("counter")
+	s.Remove("patched")
+}
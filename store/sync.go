@@ -0,0 +1,320 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// number of key-value pairs read under the lock at a time by Scan
+const syncScanChunk = 128
+
+// Concurrent is implemented by stores that are safe for concurrent use on their own
+type Concurrent interface {
+	Store
+	// Concurrent does nothing, it marks the store
+	Concurrent()
+}
+
+// Share returns s ready to be shared by many goroutines, a Concurrent store in a SyncStore from NewWriteSyncStore
+// and any other in a SyncStore, so helpers reading and writing a key such as Increment and Patch are not interleaved
+func Share(s Store) Store {
+	if _, ok := s.(Concurrent); ok {
+		return NewWriteSyncStore(s)
+	}
+
+	return NewSyncStore(s)
+}
+
+// SyncStore wraps a Store so it can be shared by many goroutines
+// such as the REST and gRPC servers, reads share the lock and writes hold it exclusively
+type SyncStore struct {
+	mu    sync.RWMutex
+	store Store
+	// Search and Scan do not take the lock, see NewWriteSyncStore
+	writesOnly bool
+}
+
+func NewSyncStore(store Store) *SyncStore {
+	return &SyncStore{store: store}
+}
+
+// NewWriteSyncStore wraps stores such as the write-ahead log, changes or indexes around a Concurrent store
+// writes hold the lock so they are applied one at a time, Search and Scan go to the store without it and never wait
+// ScanConsistent, ScanEntries and Query still share the lock so no write lands while they read
+func NewWriteSyncStore(store Store) *SyncStore {
+	return &SyncStore{store: store, writesOnly: true}
+}
+
+func (s *SyncStore) Insert(key string, value Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.Insert(key, value)
+}
+
+func (s *SyncStore) Update(key string, value Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.Update(key, value)
+}
+
+func (s *SyncStore) Search(key string) Value {
+	if s.writesOnly {
+		return s.store.Search(key)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.store.Search(key)
+}
+
+func (s *SyncStore) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store.Remove(key)
+}
+
+// ApplyBatch holds the lock for the whole batch so no reader sees it half applied
+func (s *SyncStore) ApplyBatch(b *Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return ApplyBatch(s.store, b)
+}
+
+func (s *SyncStore) InsertExpire(key string, value Value, at time.Time) error {
+	expirer, ok := s.store.(Expirer)
+	if !ok {
+		return ErrTTLNotSupported
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return expirer.InsertExpire(key, value, at)
+}
+
+func (s *SyncStore) UpdateExpire(key string, value Value, at time.Time) error {
+	expirer, ok := s.store.(Expirer)
+	if !ok {
+		return ErrTTLNotSupported
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return expirer.UpdateExpire(key, value, at)
+}
+
+// RemoveExpired holds the lock while the wrapped store removes up to limit expired keys
+func (s *SyncStore) RemoveExpired(limit int) []Entry {
+	expirer, ok := s.store.(Expirer)
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return expirer.RemoveExpired(limit)
+}
+
+func (s *SyncStore) SearchVersion(key string) (Value, uint64) {
+	if s.writesOnly {
+		return SearchVersion(s.store, key)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return SearchVersion(s.store, key)
+}
+
+// UpdateIf holds the lock so the version cannot change between the check and the update
+func (s *SyncStore) UpdateIf(key string, value Value, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return UpdateIf(s.store, key, value, version)
+}
+
+func (s *SyncStore) RemoveIf(key string, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return RemoveIf(s.store, key, version)
+}
+
+// Patch holds the lock so no other write lands between reading the value and writing the merged one
+func (s *SyncStore) Patch(key string, set Value, remove []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Patch(s.store, key, set, remove)
+}
+
+// Increment holds the lock so no other write lands between reading the counter and writing it back
+func (s *SyncStore) Increment(key string, field string, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Increment(s.store, key, field, delta)
+}
+
+// Query reads every match under the lock then calls fn without holding it
+func (s *SyncStore) Query(field string, value string, opts ScanOptions, fn ScanFunc) error {
+	var keys []string
+	var values []Value
+
+	s.mu.RLock()
+	err := Query(s.store, field, value, opts, func(key string, value Value) bool {
+		keys = append(keys, key)
+		values = append(values, value)
+		return true
+	})
+	s.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	for i := range keys {
+		if !fn(keys[i], values[i]) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// ScanConsistent copies the range under a single read lock, then calls fn without holding it
+// writers wait for the copy, not for fn, but the copy keeps every pair of the range at once
+// so scanning a whole large store, as snapshots do, takes memory in proportion to the store
+// and holds up writers for as long as the underlying scan takes
+func (s *SyncStore) ScanConsistent(opts ScanOptions, fn ScanFunc) error {
+	var keys []string
+	var values []Value
+
+	s.mu.RLock()
+	err := s.store.Scan(opts, func(key string, value Value) bool {
+		keys = append(keys, key)
+		values = append(values, value)
+		return true
+	})
+	s.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	for i := range keys {
+		if !fn(keys[i], values[i]) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *SyncStore) SearchEntry(key string) (Entry, bool) {
+	if s.writesOnly {
+		return SearchEntry(s.store, key)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return SearchEntry(s.store, key)
+}
+
+// ScanEntries copies the range under a single read lock like ScanConsistent
+func (s *SyncStore) ScanEntries(opts ScanOptions, fn func(Entry) bool) error {
+	var entries []Entry
+
+	s.mu.RLock()
+	err := ScanEntries(s.store, opts, func(e Entry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	s.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !fn(e) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *SyncStore) Restore(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Restore(s.store, e)
+}
+
+// Scan reads the range in chunks and calls fn without holding the lock
+// so a slow consumer does not block writers and fn may use the store itself
+// writes that happen between two chunks are visible to the rest of the scan
+func (s *SyncStore) Scan(opts ScanOptions, fn ScanFunc) error {
+	if s.writesOnly {
+		return s.store.Scan(opts, fn)
+	}
+
+	count := 0
+
+	for {
+		chunk := opts
+		chunk.Limit = syncScanChunk
+		if opts.Limit > 0 && opts.Limit-count < chunk.Limit {
+			chunk.Limit = opts.Limit - count
+		}
+
+		var keys []string
+		var values []Value
+
+		s.mu.RLock()
+		err := s.store.Scan(chunk, func(key string, value Value) bool {
+			keys = append(keys, key)
+			values = append(values, value)
+			return true
+		})
+		s.mu.RUnlock()
+
+		if err != nil {
+			return err
+		}
+
+		for i := range keys {
+			if !fn(keys[i], values[i]) {
+				return nil
+			}
+		}
+
+		count += len(keys)
+		if len(keys) < chunk.Limit || (opts.Limit > 0 && count >= opts.Limit) {
+			return nil
+		}
+
+		// continue after the last key read
+		last := keys[len(keys)-1]
+		if opts.Reverse {
+			// an empty End means no bound, but nothing is smaller than the empty key anyway
+			if last == "" {
+				return nil
+			}
+
+			opts.End = last
+		} else {
+			opts.Start = last + "\x00"
+		}
+	}
+}
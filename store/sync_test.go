@@ -0,0 +1,155 @@
+package store_test
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"github.com/tPhume/gokv/store/storetest"
+	"sync"
+	"testing"
+)
+
+func TestSyncStore_Scan(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	for i := 0; i < 1000; i++ {
+		if err := s.Insert(fmt.Sprintf("key%04d", i), store.Value{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		opts        store.ScanOptions
+		count       int
+		first, last string
+	}{
+		{"all", store.ScanOptions{}, 1000, "key0000", "key0999"},
+		{"limit across chunks", store.ScanOptions{Start: "key0100", Limit: 300}, 300, "key0100", "key0399"},
+		{"reverse", store.ScanOptions{End: "key0500", Reverse: true}, 500, "key0499", "key0000"},
+		{"reverse limit", store.ScanOptions{Reverse: true, Limit: 129}, 129, "key0999", "key0871"},
+	}
+
+	for _, test := range tests {
+		var keys []string
+		err := s.Scan(test.opts, func(key string, value store.Value) bool {
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(keys) != test.count || keys[0] != test.first || keys[len(keys)-1] != test.last {
+			t.Fatalf("%v, expected [%v] keys from [%v] to [%v], got = [%v] keys from [%v] to [%v]",
+				test.name, test.count, test.first, test.last, len(keys), keys[0], keys[len(keys)-1])
+		}
+
+		for i := 1; i < len(keys); i++ {
+			if (keys[i-1] < keys[i]) == test.opts.Reverse {
+				t.Fatalf("%v, keys out of order, [%v] before [%v]", test.name, keys[i-1], keys[i])
+			}
+		}
+	}
+
+	// fn can write to the store while scanning
+	err := s.Scan(store.ScanOptions{Limit: 10}, func(key string, value store.Value) bool {
+		return s.Update(key, store.Value{"val": "updated"}) == nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := s.Search("key0009"); v["val"] != "updated" {
+		t.Fatalf("expected [updated], got = [%v]", v)
+	}
+}
+
+// run with -race
+func TestSyncStore_Concurrent(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("key%03d", i%50)
+
+				switch (w + i) % 4 {
+				case 0:
+					s.Insert(key, store.Value{"writer": fmt.Sprint(w)})
+				case 1:
+					s.Update(key, store.Value{"writer": fmt.Sprint(w)})
+				case 2:
+					s.Remove(key)
+				default:
+					s.Search(key)
+					s.Scan(store.ScanOptions{Limit: 10}, func(key string, value store.Value) bool {
+						return true
+					})
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+}
+
+// holds up Insert until release is closed
+type slowInsertStore struct {
+	store.Store
+	started, release chan struct{}
+}
+
+func (s slowInsertStore) Insert(key string, value store.Value) error {
+	close(s.started)
+	<-s.release
+
+	return s.Store.Insert(key, value)
+}
+
+func TestWriteSyncStore(t *testing.T) {
+	tree := btree.NewCowBtree(3)
+	tree.Insert("A", store.Value{"val": "A"})
+
+	slow := slowInsertStore{Store: tree, started: make(chan struct{}), release: make(chan struct{})}
+	s := store.NewWriteSyncStore(slow)
+
+	inserted := make(chan error)
+	go func() {
+		inserted <- s.Insert("B", store.Value{"val": "B"})
+	}()
+	<-slow.started
+
+	// reads do not wait for the insert holding the lock
+	if v := s.Search("A"); v["val"] != "A" {
+		t.Fatalf("expected [A], got = [%v]", v)
+	}
+
+	count := 0
+	s.Scan(store.ScanOptions{}, func(key string, value store.Value) bool {
+		count++
+		return true
+	})
+
+	if count != 1 {
+		t.Fatalf("expected [1] key, got = [%v]", count)
+	}
+
+	close(slow.release)
+	if err := <-inserted; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.Share(tree).(*store.SyncStore); !ok {
+		t.Fatal("expected a sync store around the concurrent btree")
+	}
+
+	if _, ok := store.Share(btree.NewBtree(3)).(*store.SyncStore); !ok {
+		t.Fatal("expected a sync store around the btree")
+	}
+
+	storetest.ReadModifyWrite(t, store.Share(btree.NewCowBtree(3)))
+}
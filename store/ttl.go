@@ -0,0 +1,86 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTTLNotSupported is returned when an expiry is requested from a store that cannot expire keys
+var ErrTTLNotSupported = errors.New("store does not support ttl")
+
+// number of expired keys StartSweeper removes at a time
+const sweepChunk = 128
+
+// Expirer is implemented by stores whose keys can expire
+// an expired key is treated as missing by every read and write even before it is removed
+// Insert and Update without an expiry clear the expiry of the key
+type Expirer interface {
+	InsertExpire(key string, value Value, at time.Time) error
+	UpdateExpire(key string, value Value, at time.Time) error
+	// RemoveExpired removes up to limit expired keys, every one of them if limit is 0
+	// and returns them as they were before they expired
+	RemoveExpired(limit int) []Entry
+}
+
+// InsertTTL inserts key so it expires after ttl, a ttl of 0 or less never expires
+func InsertTTL(s Store, key string, value Value, ttl time.Duration) error {
+	if ttl <= 0 {
+		return s.Insert(key, value)
+	}
+
+	expirer, ok := s.(Expirer)
+	if !ok {
+		return ErrTTLNotSupported
+	}
+
+	return expirer.InsertExpire(key, value, time.Now().Add(ttl))
+}
+
+// UpdateTTL updates key so it expires after ttl, a ttl of 0 or less never expires
+func UpdateTTL(s Store, key string, value Value, ttl time.Duration) error {
+	if ttl <= 0 {
+		return s.Update(key, value)
+	}
+
+	expirer, ok := s.(Expirer)
+	if !ok {
+		return ErrTTLNotSupported
+	}
+
+	return expirer.UpdateExpire(key, value, time.Now().Add(ttl))
+}
+
+// StartSweeper removes the expired keys of s every interval until stop is called
+// they are removed a chunk at a time, so the lock of a SyncStore is not held while every one of them is removed
+// it does nothing for stores that do not implement Expirer
+func StartSweeper(s Store, interval time.Duration) (stop func()) {
+	expirer, ok := s.(Expirer)
+	if !ok {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				for len(expirer.RemoveExpired(sweepChunk)) == sweepChunk {
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
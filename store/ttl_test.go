@@ -0,0 +1,42 @@
+package store_test
+
+import (
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"testing"
+	"time"
+)
+
+func TestStartSweeper(t *testing.T) {
+	tree := btree.NewBtree(3)
+	s := store.NewSyncStore(tree)
+
+	if err := store.InsertTTL(s, "A", store.Value{"val": "A"}, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.InsertTTL(s, "B", store.Value{"val": "B"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := store.StartSweeper(s, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	// the sweeper removed A, so the tree itself has nothing left to expire
+	if removed := len(tree.RemoveExpired(0)); removed != 0 {
+		t.Fatalf("expected [0] removed keys, got = [%v]", removed)
+	}
+
+	if v := s.Search("B"); v["val"] != "B" {
+		t.Fatalf("expected [B], got = [%v]", v)
+	}
+
+	// stores that cannot expire keys
+	plain := struct{ store.Store }{btree.NewBtree(3)}
+	if err := store.InsertTTL(plain, "A", store.Value{}, time.Second); err != store.ErrTTLNotSupported {
+		t.Fatalf("expected error = [ErrTTLNotSupported], got = [%v]", err)
+	}
+
+	store.StartSweeper(plain, time.Millisecond)()
+}
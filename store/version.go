@@ -0,0 +1,51 @@
+package store
+
+import "errors"
+
+var (
+	// ErrVersionMismatch is returned by conditional writes when the key holds another version
+	ErrVersionMismatch = errors.New("key version does not match")
+	// ErrVersionNotSupported is returned when a conditional write is requested from a store without versions
+	ErrVersionNotSupported = errors.New("store does not support versions")
+)
+
+// Versioner is implemented by stores that keep a version with every key
+// every write of a key gives it a version bigger than any version the store handed out before
+// so a key that is removed and inserted again never gets an old version back, 0 is never a version
+type Versioner interface {
+	// SearchVersion returns the value and version of key, nil and 0 if it does not exist
+	SearchVersion(key string) (Value, uint64)
+	// UpdateIf updates key only if it is at version, unlike Update it keeps the expiry of the key
+	UpdateIf(key string, value Value, version uint64) error
+	// RemoveIf removes key only if it is at version
+	RemoveIf(key string, version uint64) error
+}
+
+// SearchVersion returns the value and version of key, the version is 0 if s does not implement Versioner
+func SearchVersion(s Store, key string) (Value, uint64) {
+	if versioner, ok := s.(Versioner); ok {
+		return versioner.SearchVersion(key)
+	}
+
+	return s.Search(key), 0
+}
+
+// UpdateIf updates key only if it is at version
+func UpdateIf(s Store, key string, value Value, version uint64) error {
+	versioner, ok := s.(Versioner)
+	if !ok {
+		return ErrVersionNotSupported
+	}
+
+	return versioner.UpdateIf(key, value, version)
+}
+
+// RemoveIf removes key only if it is at version
+func RemoveIf(s Store, key string, version uint64) error {
+	versioner, ok := s.(Versioner)
+	if !ok {
+		return ErrVersionNotSupported
+	}
+
+	return versioner.RemoveIf(key, version)
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// ChangeFunc is called after a write with the value of a key before and after it, nil if missing
+type ChangeFunc func(key string, before Value, after Value)
+
+// WatchStore wraps a Store and reports every key changed through it, including by batches,
+// patches, increments and conditional writes, it forwards every optional interface of this package
+// keys removed by RemoveExpired are reported with the value they expired with
+type WatchStore struct {
+	store    Store
+	onChange ChangeFunc
+	// held by every write and its report, nil if the caller applies writes one at a time
+	mu sync.Locker
+}
+
+func NewWatchStore(s Store, onChange ChangeFunc) *WatchStore {
+	return &WatchStore{store: s, onChange: onChange}
+}
+
+// NewLockedWatchStore holds mu for every write and its report, so changes are reported in the order they are made
+// the WatchStore is safe for concurrent use if s is, and so are other stores sharing mu, even around the same s
+func NewLockedWatchStore(s Store, onChange ChangeFunc, mu sync.Locker) *WatchStore {
+	return &WatchStore{store: s, onChange: onChange, mu: mu}
+}
+
+func (w *WatchStore) Insert(key string, value Value) error {
+	return w.write(func() error {
+		return w.store.Insert(key, value)
+	}, key)
+}
+
+func (w *WatchStore) Update(key string, value Value) error {
+	return w.write(func() error {
+		return w.store.Update(key, value)
+	}, key)
+}
+
+func (w *WatchStore) Search(key string) Value {
+	return w.store.Search(key)
+}
+
+func (w *WatchStore) Remove(key string) error {
+	return w.write(func() error {
+		return w.store.Remove(key)
+	}, key)
+}
+
+func (w *WatchStore) Scan(opts ScanOptions, fn ScanFunc) error {
+	return w.store.Scan(opts, fn)
+}
+
+// keys of the batch are reported once each, in the order they first appear
+func (w *WatchStore) ApplyBatch(b *Batch) error {
+	seen := make(map[string]bool)
+	keys := make([]string, 0, b.Len())
+	for _, op := range b.Operations() {
+		if op.Type != OpCheck && !seen[op.Key] {
+			seen[op.Key] = true
+			keys = append(keys, op.Key)
+		}
+	}
+
+	return w.write(func() error {
+		return ApplyBatch(w.store, b)
+	}, keys...)
+}
+
+func (w *WatchStore) InsertExpire(key string, value Value, at time.Time) error {
+	expirer, ok := w.store.(Expirer)
+	if !ok {
+		return ErrTTLNotSupported
+	}
+
+	return w.write(func() error {
+		return expirer.InsertExpire(key, value, at)
+	}, key)
+}
+
+func (w *WatchStore) UpdateExpire(key string, value Value, at time.Time) error {
+	expirer, ok := w.store.(Expirer)
+	if !ok {
+		return ErrTTLNotSupported
+	}
+
+	return w.write(func() error {
+		return expirer.UpdateExpire(key, value, at)
+	}, key)
+}
+
+func (w *WatchStore) RemoveExpired(limit int) []Entry {
+	expirer, ok := w.store.(Expirer)
+	if !ok {
+		return nil
+	}
+
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	removed := expirer.RemoveExpired(limit)
+	for _, e := range removed {
+		w.onChange(e.Key, e.Value, nil)
+	}
+
+	return removed
+}
+
+func (w *WatchStore) SearchEntry(key string) (Entry, bool) {
+	return SearchEntry(w.store, key)
+}
+
+func (w *WatchStore) ScanEntries(opts ScanOptions, fn func(Entry) bool) error {
+	return ScanEntries(w.store, opts, fn)
+}
+
+func (w *WatchStore) Restore(e Entry) error {
+	return w.write(func() error {
+		return Restore(w.store, e)
+	}, e.Key)
+}
+
+func (w *WatchStore) SearchVersion(key string) (Value, uint64) {
+	return SearchVersion(w.store, key)
+}
+
+func (w *WatchStore) UpdateIf(key string, value Value, version uint64) error {
+	return w.write(func() error {
+		return UpdateIf(w.store, key, value, version)
+	}, key)
+}
+
+func (w *WatchStore) RemoveIf(key string, version uint64) error {
+	return w.write(func() error {
+		return RemoveIf(w.store, key, version)
+	}, key)
+}
+
+func (w *WatchStore) Patch(key string, set Value, remove []string) error {
+	return w.write(func() error {
+		return Patch(w.store, key, set, remove)
+	}, key)
+}
+
+func (w *WatchStore) Increment(key string, field string, delta int64) (int64, error) {
+	var n int64
+	err := w.write(func() error {
+		var err error
+		n, err = Increment(w.store, key, field, delta)
+		return err
+	}, key)
+
+	return n, err
+}
+
+func (w *WatchStore) ScanConsistent(opts ScanOptions, fn ScanFunc) error {
+	return ScanConsistent(w.store, opts, fn)
+}
+
+func (w *WatchStore) Query(field string, value string, opts ScanOptions, fn ScanFunc) error {
+	return Query(w.store, field, value, opts, fn)
+}
+
+// runs fn then reports keys, every key if fn succeeded, only the keys that changed if it failed part way
+func (w *WatchStore) write(fn func() error, keys ...string) error {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	before := make([]Value, len(keys))
+	for i, key := range keys {
+		before[i] = w.store.Search(key)
+	}
+
+	err := fn()
+
+	for i, key := range keys {
+		after := w.store.Search(key)
+		if before[i] == nil && after == nil {
+			continue
+		}
+
+		if err != nil && EqualValues(before[i], after) {
+			continue
+		}
+
+		w.onChange(key, before[i], after)
+	}
+
+	return err
+}
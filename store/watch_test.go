@@ -0,0 +1,35 @@
+package store_test
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"testing"
+)
+
+func TestWatchStore(t *testing.T) {
+	var changes []string
+	s := store.NewWatchStore(btree.NewBtree(3), func(key string, before store.Value, after store.Value) {
+		changes = append(changes, fmt.Sprintf("%v:%v->%v", key, before["n"], after["n"]))
+	})
+
+	s.Insert("A", store.Value{"n": "1"})
+	store.Increment(s, "A", "n", 1)
+
+	// a failed write changes nothing
+	if err := s.Update("B", store.Value{"n": "1"}); err != store.KeyDoesNotExist {
+		t.Fatalf("expected %v, got = %v", store.KeyDoesNotExist, err)
+	}
+
+	// every key of a batch is reported once
+	b := store.NewBatch()
+	b.Insert("B", store.Value{"n": "1"})
+	b.Update("B", store.Value{"n": "2"})
+	b.Remove("A")
+	s.ApplyBatch(b)
+
+	expected := "[A:->1 A:1->2 B:->2 A:2->]"
+	if fmt.Sprint(changes) != expected {
+		t.Fatalf("expected %v, got = %v", expected, changes)
+	}
+}
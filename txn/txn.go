@@ -0,0 +1,157 @@
+package txn
+
+import (
+	"errors"
+	"github.com/tPhume/gokv/store"
+	"sort"
+)
+
+// Package contains optimistic multi-key transactions over any store.Store
+// a transaction reads each key from the store the first time it is used and keeps that value and its version
+// writes are buffered until Commit, which applies them as one store batch together with a check of every key read
+// if another writer changed any of those keys in the meantime nothing is applied and ErrConflict is returned
+// read-only transactions are checked the same way, so a transaction that commits saw every key as it was at
+// one point in time, even though keys were read at different times
+// there is no snapshot before Commit: keys are read lazily, so values returned by Get may come from different
+// points in time, a transaction seeing such values cannot commit but must not act on them before it does
+// keys of a store.Versioner are checked by version, so a key changed and changed back is a conflict too
+// other stores only have their values compared
+
+var (
+	ErrConflict = errors.New("txn: conflict, a key used by the transaction was changed by another writer")
+	ErrDone     = errors.New("txn: transaction already committed or rolled back")
+)
+
+type Txn struct {
+	store store.Store
+	// value of every key when the transaction first used it, nil if it did not exist
+	reads map[string]store.Value
+	// version of every key when the transaction first used it, 0 if it did not exist or s has no versions
+	versions map[string]uint64
+	// value written by the transaction, nil if removed
+	writes map[string]store.Value
+	done   bool
+}
+
+// Begin starts a transaction over s
+// s must apply batches atomically with respect to other writers, like store.SyncStore or btree.CowBtree
+func Begin(s store.Store) *Txn {
+	return &Txn{
+		store:    s,
+		reads:    make(map[string]store.Value),
+		versions: make(map[string]uint64),
+		writes:   make(map[string]store.Value),
+	}
+}
+
+// Get returns the value of key as seen by the transaction, nil if it does not exist
+func (t *Txn) Get(key string) (store.Value, error) {
+	if t.done {
+		return nil, ErrDone
+	}
+
+	if value, ok := t.writes[key]; ok {
+		return store.CopyValue(value), nil
+	}
+
+	return store.CopyValue(t.read(key)), nil
+}
+
+// Put sets the value of key, inserting it if needed
+func (t *Txn) Put(key string, value store.Value) error {
+	if t.done {
+		return ErrDone
+	}
+
+	t.read(key)
+	t.writes[key] = store.CopyValue(value)
+
+	return nil
+}
+
+// Delete removes key, store.KeyDoesNotExist is returned if the transaction does not see it
+func (t *Txn) Delete(key string) error {
+	if t.done {
+		return ErrDone
+	}
+
+	current, written := t.writes[key]
+	if !written {
+		current = t.read(key)
+	}
+
+	if current == nil {
+		return store.KeyDoesNotExist
+	}
+
+	t.writes[key] = nil
+
+	return nil
+}
+
+// Commit applies the writes if no key used by the transaction was changed since it was first read
+// a transaction without writes only checks its reads
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrDone
+	}
+	t.done = true
+
+	if len(t.reads) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(t.reads))
+	for key := range t.reads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	b := store.NewBatch()
+	for _, key := range keys {
+		if version := t.versions[key]; version != 0 {
+			b.CheckVersion(key, version)
+		} else {
+			b.Check(key, t.reads[key])
+		}
+	}
+
+	for _, key := range keys {
+		value, ok := t.writes[key]
+		if !ok {
+			continue
+		}
+
+		if value != nil {
+			b.Insert(key, value)
+		} else if t.reads[key] != nil {
+			b.Remove(key)
+		}
+	}
+
+	err := store.ApplyBatch(t.store, b)
+	if errors.Is(err, store.ErrCheckFailed) {
+		return ErrConflict
+	}
+
+	return err
+}
+
+// Rollback discards the writes, it can be called after Commit and does nothing then
+func (t *Txn) Rollback() {
+	t.done = true
+	t.writes = nil
+}
+
+// returns the value of key when the transaction first used it
+func (t *Txn) read(key string) store.Value {
+	if value, ok := t.reads[key]; ok {
+		return value
+	}
+
+	value, version := store.SearchVersion(t.store, key)
+	t.reads[key] = value
+	t.versions[key] = version
+
+	return value
+}
@@ -0,0 +1,209 @@
+package txn
+
+import (
+	"fmt"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestTxn_Commit(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	s.Insert("A", store.Value{"val": "A"})
+	s.Insert("B", store.Value{"val": "B"})
+
+	tx := Begin(s)
+	if err := tx.Put("A", store.Value{"val": "new A"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Delete("B"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Put("C", store.Value{"val": "C"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the transaction sees its own writes, the store does not until commit
+	if v, _ := tx.Get("A"); v["val"] != "new A" {
+		t.Fatalf("expected [new A], got = [%v]", v)
+	}
+
+	if v, _ := tx.Get("B"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	if err := tx.Delete("B"); err != store.KeyDoesNotExist {
+		t.Fatalf("expected error = [KeyDoesNotExist], got = [%v]", err)
+	}
+
+	if v := s.Search("A"); v["val"] != "A" {
+		t.Fatalf("expected [A], got = [%v]", v)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := s.Search("A"); v["val"] != "new A" {
+		t.Fatalf("expected [new A], got = [%v]", v)
+	}
+
+	if v := s.Search("B"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	if v := s.Search("C"); v["val"] != "C" {
+		t.Fatalf("expected [C], got = [%v]", v)
+	}
+
+	if err := tx.Put("D", store.Value{"val": "D"}); err != ErrDone {
+		t.Fatalf("expected error = [ErrDone], got = [%v]", err)
+	}
+}
+
+func TestTxn_Rollback(t *testing.T) {
+	s := btree.NewCowBtree(3)
+
+	tx := Begin(s)
+	tx.Put("A", store.Value{"val": "A"})
+	tx.Rollback()
+
+	if err := tx.Commit(); err != ErrDone {
+		t.Fatalf("expected error = [ErrDone], got = [%v]", err)
+	}
+
+	if v := s.Search("A"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+}
+
+func TestTxn_Conflict(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	s.Insert("A", store.Value{"val": "A"})
+
+	// a key once read is not read again, a concurrent write to it is not visible to the transaction
+	tx := Begin(s)
+	if v, _ := tx.Get("A"); v["val"] != "A" {
+		t.Fatalf("expected [A], got = [%v]", v)
+	}
+
+	s.Insert("A", store.Value{"val": "other A"})
+
+	if v, _ := tx.Get("A"); v["val"] != "A" {
+		t.Fatalf("expected [A], got = [%v]", v)
+	}
+
+	tx.Put("B", store.Value{"val": "B"})
+	if err := tx.Commit(); err != ErrConflict {
+		t.Fatalf("expected error = [ErrConflict], got = [%v]", err)
+	}
+
+	if v := s.Search("B"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	// a key that did not exist when it was read conflicts with a concurrent insert
+	tx = Begin(s)
+	tx.Put("C", store.Value{"val": "C"})
+	s.Insert("C", store.Value{"val": "other C"})
+	if err := tx.Commit(); err != ErrConflict {
+		t.Fatalf("expected error = [ErrConflict], got = [%v]", err)
+	}
+
+	if v := s.Search("C"); v["val"] != "other C" {
+		t.Fatalf("expected [other C], got = [%v]", v)
+	}
+}
+
+func TestTxn_ReadOnly(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	s.Insert("A", store.Value{"val": "1"})
+	s.Insert("B", store.Value{"val": "1"})
+
+	// A is read before and B after a writer moved both, a commit would accept a state that never existed
+	tx := Begin(s)
+	tx.Get("A")
+	s.Insert("A", store.Value{"val": "2"})
+	s.Insert("B", store.Value{"val": "2"})
+	tx.Get("B")
+
+	if err := tx.Commit(); err != ErrConflict {
+		t.Fatalf("expected error = [ErrConflict], got = [%v]", err)
+	}
+
+	tx = Begin(s)
+	tx.Get("A")
+	tx.Get("B")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// a key changed and changed back since it was read still conflicts
+func TestTxn_ChangedBack(t *testing.T) {
+	s := store.NewSyncStore(btree.NewBtree(3))
+	s.Insert("A", store.Value{"val": "A"})
+
+	tx := Begin(s)
+	tx.Get("A")
+	s.Insert("A", store.Value{"val": "other A"})
+	s.Insert("A", store.Value{"val": "A"})
+
+	tx.Put("B", store.Value{"val": "B"})
+	if err := tx.Commit(); err != ErrConflict {
+		t.Fatalf("expected error = [ErrConflict], got = [%v]", err)
+	}
+
+	if v := s.Search("B"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+}
+
+func TestTxn_ConcurrentIncrement(t *testing.T) {
+	stores := map[string]store.Store{
+		"sync btree": store.NewSyncStore(btree.NewBtree(3)),
+		"cow btree":  btree.NewCowBtree(3),
+	}
+
+	for name, s := range stores {
+		s.Insert("counter", store.Value{"n": "0"})
+
+		workers, increments := 8, 50
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < increments; j++ {
+					// retry until the read-modify-write commits without conflict
+					for {
+						tx := Begin(s)
+						v, _ := tx.Get("counter")
+						n, _ := strconv.Atoi(v["n"])
+						tx.Put("counter", store.Value{"n": fmt.Sprint(n + 1)})
+
+						err := tx.Commit()
+						if err == nil {
+							break
+						}
+
+						if err != ErrConflict {
+							t.Error(err)
+							return
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if v := s.Search("counter"); v["n"] != fmt.Sprint(workers*increments) {
+			t.Fatalf("%v, expected [%v], got = [%v]", name, workers*increments, v)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package wal
+
+import (
+	"github.com/tPhume/gokv/store"
+	"time"
+)
+
+// Store wraps a store.Store so every mutation is logged before it is applied
+type Store struct {
+	log   *Log
+	store store.Store
+	// size the log grows to before it is compacted again, 0 never compacts it
+	compactAt int64
+}
+
+// NewStore replays the log into s, which should be empty, and returns s wrapped by the log
+// it fails with ErrTTLRecords rather than drop the expiry of a key that s cannot expire
+func NewStore(log *Log, s store.Store) (*Store, error) {
+	err := log.Replay(func(r Record) error {
+		if err := apply(s, r); err != store.ErrTTLNotSupported {
+			return err
+		}
+
+		return ErrTTLRecords
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Store{log: log, store: s}
+	w.scheduleCompaction()
+
+	return w, nil
+}
+
+// OpenStore opens the log at path and replays it into s
+func OpenStore(path string, s store.Store, opts Options) (*Store, error) {
+	log, err := Open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := NewStore(log, s)
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+func (w *Store) Insert(key string, value store.Value) error {
+	return w.logAndApply(Record{Op: OpInsert, Key: key, Value: value})
+}
+
+// update and remove of a missing key are rejected before anything is logged
+func (w *Store) Update(key string, value store.Value) error {
+	if w.store.Search(key) == nil {
+		return store.KeyDoesNotExist
+	}
+
+	return w.logAndApply(Record{Op: OpUpdate, Key: key, Value: value})
+}
+
+// InsertExpire logs the time key expires at, so a replay after that time leaves it expired
+func (w *Store) InsertExpire(key string, value store.Value, at time.Time) error {
+	if _, ok := w.store.(store.Expirer); !ok {
+		return store.ErrTTLNotSupported
+	}
+
+	return w.logAndApply(Record{Op: OpInsertExpire, Key: key, Value: value, Expires: at.UnixNano()})
+}
+
+func (w *Store) UpdateExpire(key string, value store.Value, at time.Time) error {
+	if _, ok := w.store.(store.Expirer); !ok {
+		return store.ErrTTLNotSupported
+	}
+
+	if w.store.Search(key) == nil {
+		return store.KeyDoesNotExist
+	}
+
+	return w.logAndApply(Record{Op: OpUpdateExpire, Key: key, Value: value, Expires: at.UnixNano()})
+}
+
+// RemoveExpired is not logged, expired keys are expired again when the log is replayed
+func (w *Store) RemoveExpired(limit int) []store.Entry {
+	expirer, ok := w.store.(store.Expirer)
+	if !ok {
+		return nil
+	}
+
+	return expirer.RemoveExpired(limit)
+}
+
+// the wrapped store hands out versions in the order writes are applied
+// so replaying the log gives every key the version it had before
+func (w *Store) SearchVersion(key string) (store.Value, uint64) {
+	return store.SearchVersion(w.store, key)
+}
+
+// UpdateIf checks the version before logging, the update is logged as a plain one
+// or with the expiry the key keeps
+func (w *Store) UpdateIf(key string, value store.Value, version uint64) error {
+	if err := w.checkVersion(key, version); err != nil {
+		return err
+	}
+
+	if e, _ := store.SearchEntry(w.store, key); !e.Expires.IsZero() {
+		return w.logAndApply(Record{Op: OpUpdateExpire, Key: key, Value: value, Expires: e.Expires.UnixNano()})
+	}
+
+	return w.logAndApply(Record{Op: OpUpdate, Key: key, Value: value})
+}
+
+// RemoveIf checks the version before logging, the remove is logged as a plain one
+func (w *Store) RemoveIf(key string, version uint64) error {
+	if err := w.checkVersion(key, version); err != nil {
+		return err
+	}
+
+	return w.logAndApply(Record{Op: OpRemove, Key: key})
+}
+
+func (w *Store) checkVersion(key string, version uint64) error {
+	if _, ok := w.store.(store.Versioner); !ok {
+		return store.ErrVersionNotSupported
+	}
+
+	value, current := store.SearchVersion(w.store, key)
+	if value == nil {
+		return store.KeyDoesNotExist
+	}
+
+	if current != version {
+		return store.ErrVersionMismatch
+	}
+
+	return nil
+}
+
+func (w *Store) Search(key string) store.Value {
+	return w.store.Search(key)
+}
+
+func (w *Store) Scan(opts store.ScanOptions, fn store.ScanFunc) error {
+	return w.store.Scan(opts, fn)
+}
+
+func (w *Store) Remove(key string) error {
+	if w.store.Search(key) == nil {
+		return store.KeyDoesNotExist
+	}
+
+	return w.logAndApply(Record{Op: OpRemove, Key: key})
+}
+
+// SearchEntry returns key with its expiry and version, see store.Restorer
+func (w *Store) SearchEntry(key string) (store.Entry, bool) {
+	return store.SearchEntry(w.store, key)
+}
+
+func (w *Store) ScanEntries(opts store.ScanOptions, fn func(store.Entry) bool) error {
+	return store.ScanEntries(w.store, opts, fn)
+}
+
+// Restore logs the entry with its expiry and version, so a replay restores it the same way
+func (w *Store) Restore(e store.Entry) error {
+	if _, ok := w.store.(store.Expirer); !ok && !e.Expires.IsZero() {
+		return store.ErrTTLNotSupported
+	}
+
+	return w.logAndApply(restoreRecord(e))
+}
+
+// ApplyBatch checks the batch against the store, logs it as a single record and applies it
+func (w *Store) ApplyBatch(b *store.Batch) error {
+	if err := b.Validate(w.store); err != nil {
+		return err
+	}
+
+	// checks were verified above, only mutations are logged
+	r := Record{Op: OpBatch}
+	for _, op := range b.Operations() {
+		if op.Type != store.OpCheck {
+			r.Batch = append(r.Batch, batchRecord(op))
+		}
+	}
+
+	// a batch of checks only changes nothing
+	if len(r.Batch) > 0 {
+		if err := w.log.Append(r); err != nil {
+			return err
+		}
+	}
+
+	if err := store.ApplyBatch(w.store, b); err != nil {
+		return err
+	}
+
+	w.maybeCompact()
+
+	return nil
+}
+
+// Compact rewrites the log as a single OpRestore record per key of the store, holding its expiry and version
+// so the log stops growing with every write, it is done by the writes themselves once the log grows past
+// Options.CompactSize and twice the size it had after the last compaction
+// the whole store is written out meanwhile, which holds up the writes waiting behind it
+func (w *Store) Compact() error {
+	err := w.log.Rewrite(func(write func(Record) error) error {
+		var writeErr error
+		err := store.ScanEntries(w.store, store.ScanOptions{}, func(e store.Entry) bool {
+			writeErr = write(restoreRecord(e))
+			return writeErr == nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return writeErr
+	})
+
+	// a failed compaction left the log as it was, it is tried again once the log doubled
+	w.scheduleCompaction()
+
+	return err
+}
+
+// Close syncs and closes the log, the wrapped store is left untouched
+func (w *Store) Close() error {
+	return w.log.Close()
+}
+
+func (w *Store) logAndApply(r Record) error {
+	if err := w.log.Append(r); err != nil {
+		return err
+	}
+
+	if err := apply(w.store, r); err != nil {
+		return err
+	}
+
+	w.maybeCompact()
+
+	return nil
+}
+
+// the write that triggered the compaction is already logged and applied, so it succeeds even if the compaction fails
+func (w *Store) maybeCompact() {
+	if w.compactAt > 0 && w.log.Size() >= w.compactAt {
+		w.Compact()
+	}
+}
+
+func (w *Store) scheduleCompaction() {
+	if w.log.opts.CompactSize <= 0 {
+		return
+	}
+
+	w.compactAt = 2 * w.log.Size()
+	if w.compactAt < w.log.opts.CompactSize {
+		w.compactAt = w.log.opts.CompactSize
+	}
+}
+
+// updates are only logged once the key is known to exist, so they are applied as inserts
+// a replay would otherwise fail on keys that expired since they were updated
+func apply(s store.Store, r Record) error {
+	switch r.Op {
+	case OpInsert, OpUpdate:
+		return s.Insert(r.Key, r.Value)
+	case OpInsertExpire, OpUpdateExpire:
+		expirer, ok := s.(store.Expirer)
+		if !ok {
+			return store.ErrTTLNotSupported
+		}
+
+		return expirer.InsertExpire(r.Key, r.Value, time.Unix(0, r.Expires))
+	case OpRestore:
+		e := store.Entry{Key: r.Key, Value: r.Value, Version: r.Version}
+		if r.Expires != 0 {
+			e.Expires = time.Unix(0, r.Expires)
+		}
+
+		return store.Restore(s, e)
+	case OpRemove:
+		// a key that expired since is already missing
+		if err := s.Remove(r.Key); err != store.KeyDoesNotExist {
+			return err
+		}
+
+		return nil
+	case OpBatch:
+		// the batch was validated before it was logged, so its operations can be replayed one at a time
+		for _, op := range r.Batch {
+			if op.Op != OpInsert && op.Op != OpUpdate && op.Op != OpRemove && op.Op != OpInsertExpire {
+				return ErrCorrupted
+			}
+
+			if err := apply(s, op); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return ErrCorrupted
+}
+
+func restoreRecord(e store.Entry) Record {
+	r := Record{Op: OpRestore, Key: e.Key, Value: e.Value, Version: e.Version}
+	if !e.Expires.IsZero() {
+		r.Expires = e.Expires.UnixNano()
+	}
+
+	return r
+}
+
+func batchRecord(op store.Operation) Record {
+	switch op.Type {
+	case store.OpInsert:
+		if !op.Expires.IsZero() {
+			return Record{Op: OpInsertExpire, Key: op.Key, Value: op.Value, Expires: op.Expires.UnixNano()}
+		}
+
+		return Record{Op: OpInsert, Key: op.Key, Value: op.Value}
+	case store.OpUpdate:
+		return Record{Op: OpUpdate, Key: op.Key, Value: op.Value}
+	}
+
+	return Record{Op: OpRemove, Key: op.Key}
+}
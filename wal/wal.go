@@ -0,0 +1,622 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/tPhume/gokv/store"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Package contains an append-only write-ahead log
+// every mutation is appended as a checksummed record before it is applied to a store
+// so the store can be rebuilt by replaying the log on startup
+// every record starts with a header, the length has a checksum of its own so a damaged length is told from a torn record
+// | crc32 of the length (4) | length (uvarint) | crc32 of the body (4) | body |
+// followed by its body
+// | op (1) | key | value |
+// a batch is a single record holding every operation, so it is replayed entirely or not at all
+// | OpBatch (1) | count | op (1) | key | value | ... |
+// an insert or update with an expiry is followed by the time it expires at
+// | OpInsertExpire (1) | key | value | expires (uvarint, unix nano) |
+// a compacted log holds one record per key, with its expiry (0 never expires) and version
+// | OpRestore (1) | key | value | expires (uvarint, unix nano) | version (uvarint) |
+
+var (
+	ErrCorrupted = errors.New("wal: corrupted record")
+	ErrClosed    = errors.New("wal: log is closed")
+	// returned by NewStore when the log was written through a store that can expire keys, such as the btree
+	// and is replayed into one that cannot, the expiries would otherwise be lost
+	ErrTTLRecords = errors.New("wal: log holds keys that expire, the store they are replayed into does not support ttl")
+
+	// returned by decodeRecord for a record cut short by the end of the file
+	errTorn = errors.New("wal: torn record")
+)
+
+const (
+	// records longer than this are taken for corruption rather than allocated
+	maxRecordLength = 1 << 30
+	// smallest encoding of an operation in a body, the op and the length of an empty key
+	minOpLength = 2
+	// smallest encoding of a field in a value, the lengths of an empty name and an empty value
+	minFieldLength = 2
+)
+
+// Op is the kind of mutation a record holds
+type Op byte
+
+const (
+	OpInsert Op = iota + 1
+	OpUpdate
+	OpRemove
+	OpBatch
+	OpInsertExpire
+	OpUpdateExpire
+	OpRestore
+)
+
+// Record is a single logged mutation, Value is nil for OpRemove
+// an OpBatch record has no key or value, its operations are in Batch
+// Expires is only set by OpInsertExpire, OpUpdateExpire and OpRestore, in unix nano
+// Version is only set by OpRestore
+type Record struct {
+	Op      Op
+	Key     string
+	Value   store.Value
+	Batch   []Record
+	Expires int64
+	Version uint64
+}
+
+// SyncPolicy decides when appended records are forced to stable storage
+type SyncPolicy int
+
+const (
+	// fsync after every append, nothing acknowledged is ever lost
+	SyncAlways SyncPolicy = iota
+	// fsync every Options.Interval, a crash loses at most one interval of writes
+	SyncInterval
+	// leave flushing to the operating system
+	SyncNever
+)
+
+type Options struct {
+	Sync     SyncPolicy
+	Interval time.Duration
+	// bytes the log of a Store grows to before it is compacted, 0 never compacts it
+	CompactSize int64
+}
+
+func DefaultOptions() Options {
+	return Options{Sync: SyncAlways, CompactSize: 64 << 20}
+}
+
+// Log is safe for concurrent use
+type Log struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	opts   Options
+	size   int64
+	dirty  bool
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Open opens or creates the log at path
+// a torn record at the end of the file, left by a crash in the middle of an append, is truncated
+// a damaged record followed by others is not, Open fails with ErrCorrupted instead of dropping them
+func Open(path string, opts Options) (*Log, error) {
+	// leftover of an interrupted rewrite, the log itself was not replaced
+	if err := os.Remove(path + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := validLength(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l := &Log{
+		path: path,
+		file: file,
+		opts: opts,
+		size: end,
+		done: make(chan struct{}),
+	}
+
+	if opts.Sync == SyncInterval {
+		if opts.Interval <= 0 {
+			l.opts.Interval = time.Second
+		}
+
+		l.wg.Add(1)
+		go l.syncLoop()
+	}
+
+	return l, nil
+}
+
+// Append writes the record to the log, honouring the sync policy
+func (l *Log) Append(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	buf := encodeRecord(r)
+	if _, err := l.file.Write(buf); err != nil {
+		return err
+	}
+
+	l.size += int64(len(buf))
+
+	if l.opts.Sync == SyncAlways {
+		return l.file.Sync()
+	}
+
+	l.dirty = true
+
+	return nil
+}
+
+// Replay calls fn for every record in the log, in the order they were appended
+func (l *Log) Replay(fn func(Record) error) error {
+	return ReplayFile(l.path, fn)
+}
+
+// ReplayFile calls fn for every record of the log at path without opening it for appends
+// a torn record at the end is reported as ErrCorrupted, since only Open truncates it
+func ReplayFile(path string, fn func(Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	left := info.Size()
+	reader := bufio.NewReader(file)
+	for {
+		r, n, err := decodeRecord(reader, left)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err == errTorn {
+			return ErrCorrupted
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(r); err != nil {
+			return err
+		}
+
+		left -= int64(n)
+	}
+}
+
+// Rewrite replaces every record of the log by the ones records passes to write, with a single rename
+// appends wait until it is done, and the log is left as it was if records or the rewrite fails
+func (l *Log) Rewrite(records func(write func(Record) error) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	tmp := l.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	writer := bufio.NewWriter(file)
+	err = records(func(r Record) error {
+		buf := encodeRecord(r)
+		size += int64(len(buf))
+
+		_, err := writer.Write(buf)
+		return err
+	})
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, l.path)
+	}
+
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	// makes the rename durable
+	if dir, err := os.Open(filepath.Dir(l.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	// file is at its end, appends go after the new records
+	l.file.Close()
+	l.file, l.size, l.dirty = file, size, false
+
+	return nil
+}
+
+// Size returns the number of bytes in the log
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.size
+}
+
+// Sync forces appended records to stable storage
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+
+	return l.sync()
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+
+	err := l.sync()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	l.closed = true
+	close(l.done)
+	l.mu.Unlock()
+
+	l.wg.Wait()
+
+	return err
+}
+
+func (l *Log) sync() error {
+	if !l.dirty {
+		return nil
+	}
+
+	l.dirty = false
+	return l.file.Sync()
+}
+
+func (l *Log) syncLoop() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			if !l.closed {
+				l.sync()
+			}
+			l.mu.Unlock()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// utility function that returns the length of the file up to the last complete record
+// only the last record of the file can be torn, a damaged record anywhere else is an error
+func validLength(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var end int64
+	reader := bufio.NewReader(file)
+	for {
+		_, n, err := decodeRecord(reader, info.Size()-end)
+		if err == io.EOF || err == errTorn {
+			return end, nil
+		}
+
+		// a crash can leave the body of the last record written only in part
+		if err == ErrCorrupted && n > 0 && end+int64(n) == info.Size() {
+			return end, nil
+		}
+
+		if err == ErrCorrupted {
+			return 0, fmt.Errorf("%w at offset %d", ErrCorrupted, end)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		end += int64(n)
+	}
+}
+
+func encodeRecord(r Record) []byte {
+	body := appendBody(nil, r)
+
+	buf := make([]byte, 4, 8+binary.MaxVarintLen64+len(body))
+	buf = appendUvarint(buf, uint64(len(body)))
+	binary.LittleEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(body))
+	buf = append(buf, sum[:]...)
+
+	return append(buf, body...)
+}
+
+func appendBody(buf []byte, r Record) []byte {
+	buf = append(buf, byte(r.Op))
+
+	switch r.Op {
+	case OpBatch:
+		buf = appendUvarint(buf, uint64(len(r.Batch)))
+		for _, op := range r.Batch {
+			buf = appendBody(buf, op)
+		}
+	case OpRemove:
+		buf = appendString(buf, r.Key)
+	default:
+		buf = appendString(buf, r.Key)
+
+		fields := make([]string, 0, len(r.Value))
+		for field := range r.Value {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		buf = appendUvarint(buf, uint64(len(fields)))
+		for _, field := range fields {
+			buf = appendString(buf, field)
+			buf = appendString(buf, r.Value[field])
+		}
+
+		if r.Op == OpInsertExpire || r.Op == OpUpdateExpire || r.Op == OpRestore {
+			buf = appendUvarint(buf, uint64(r.Expires))
+		}
+
+		if r.Op == OpRestore {
+			buf = appendUvarint(buf, r.Version)
+		}
+	}
+
+	return buf
+}
+
+// returns the record and its encoded length, io.EOF if the reader is exhausted
+// errTorn if the record is cut short by the end of the reader, left is the number of bytes the reader has left
+// and ErrCorrupted for a damaged record, with the encoded length if only its body is damaged
+func decodeRecord(reader *bufio.Reader, left int64) (Record, int, error) {
+	var lengthSum [4]byte
+	if n, err := io.ReadFull(reader, lengthSum[:]); err != nil {
+		if err == io.EOF && n == 0 {
+			return Record{}, 0, io.EOF
+		}
+
+		return Record{}, 0, errTorn
+	}
+
+	length, err := binary.ReadUvarint(reader)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return Record{}, 0, errTorn
+	}
+
+	if err != nil {
+		return Record{}, 0, ErrCorrupted
+	}
+
+	var tmp [binary.MaxVarintLen64]byte
+	header := 8 + binary.PutUvarint(tmp[:], length)
+	if crc32.ChecksumIEEE(tmp[:header-8]) != binary.LittleEndian.Uint32(lengthSum[:]) || length > maxRecordLength {
+		return Record{}, 0, ErrCorrupted
+	}
+
+	// the length is checked, so a record longer than the rest of the file was cut short
+	if int64(header)+int64(length) > left {
+		return Record{}, 0, errTorn
+	}
+
+	var sum [4]byte
+	if _, err := io.ReadFull(reader, sum[:]); err != nil {
+		return Record{}, 0, errTorn
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return Record{}, 0, errTorn
+	}
+
+	n := header + int(length)
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(sum[:]) {
+		return Record{}, n, ErrCorrupted
+	}
+
+	r, err := parseRecord(body)
+	if err != nil {
+		return Record{}, n, err
+	}
+
+	return r, n, nil
+}
+
+func parseRecord(body []byte) (Record, error) {
+	r, rest, err := readBody(body)
+	if err != nil {
+		return Record{}, err
+	}
+
+	if len(rest) != 0 {
+		return Record{}, ErrCorrupted
+	}
+
+	return r, nil
+}
+
+// utility function that reads one record body and returns what follows it
+func readBody(body []byte) (Record, []byte, error) {
+	if len(body) == 0 {
+		return Record{}, nil, ErrCorrupted
+	}
+
+	r := Record{Op: Op(body[0])}
+	body = body[1:]
+
+	switch r.Op {
+	case OpBatch:
+		count, n := binary.Uvarint(body)
+		if n <= 0 || count > uint64(len(body)-n)/minOpLength {
+			return Record{}, nil, ErrCorrupted
+		}
+		body = body[n:]
+
+		r.Batch = make([]Record, 0, count)
+		for i := uint64(0); i < count; i++ {
+			var op Record
+			var err error
+			if op, body, err = readBody(body); err != nil {
+				return Record{}, nil, err
+			}
+
+			r.Batch = append(r.Batch, op)
+		}
+
+		return r, body, nil
+	case OpInsert, OpUpdate, OpRemove, OpInsertExpire, OpUpdateExpire, OpRestore:
+	default:
+		return Record{}, nil, ErrCorrupted
+	}
+
+	key, body, err := readString(body)
+	if err != nil {
+		return Record{}, nil, err
+	}
+	r.Key = key
+
+	if r.Op == OpRemove {
+		return r, body, nil
+	}
+
+	count, n := binary.Uvarint(body)
+	if n <= 0 || count > uint64(len(body)-n)/minFieldLength {
+		return Record{}, nil, ErrCorrupted
+	}
+	body = body[n:]
+
+	r.Value = make(store.Value, count)
+	for i := uint64(0); i < count; i++ {
+		var field, value string
+		if field, body, err = readString(body); err != nil {
+			return Record{}, nil, err
+		}
+
+		if value, body, err = readString(body); err != nil {
+			return Record{}, nil, err
+		}
+
+		r.Value[field] = value
+	}
+
+	if r.Op == OpInsertExpire || r.Op == OpUpdateExpire || r.Op == OpRestore {
+		expires, n := binary.Uvarint(body)
+		if n <= 0 {
+			return Record{}, nil, ErrCorrupted
+		}
+
+		r.Expires = int64(expires)
+		body = body[n:]
+	}
+
+	if r.Op == OpRestore {
+		version, n := binary.Uvarint(body)
+		if n <= 0 {
+			return Record{}, nil, ErrCorrupted
+		}
+
+		r.Version = version
+		body = body[n:]
+	}
+
+	return r, body, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(buf []byte) (string, []byte, error) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < length {
+		return "", nil, ErrCorrupted
+	}
+
+	return string(buf[n : n+int(length)]), buf[n+int(length):], nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
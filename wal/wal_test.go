@@ -0,0 +1,499 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tPhume/gokv/bplustree"
+	"github.com/tPhume/gokv/btree"
+	"github.com/tPhume/gokv/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempLogPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "gokv.wal"), func() { os.RemoveAll(dir) }
+}
+
+func TestLog_AppendReplay(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	records := []Record{
+		{Op: OpInsert, Key: "A", Value: store.Value{"val": "A"}},
+		{Op: OpUpdate, Key: "A", Value: store.Value{"val": "new A", "other": ""}},
+		{Op: OpRemove, Key: "A"},
+	}
+
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		os.Remove(path)
+
+		log, err := Open(path, Options{Sync: policy, Interval: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range records {
+			if err := log.Append(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		log, err = Open(path, DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var replayed []Record
+		err = log.Replay(func(r Record) error {
+			replayed = append(replayed, r)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Close()
+
+		if len(replayed) != len(records) {
+			t.Fatalf("policy [%v], expected [%v] records, got = [%v]", policy, len(records), len(replayed))
+		}
+
+		for i, r := range replayed {
+			if r.Op != records[i].Op || r.Key != records[i].Key || len(r.Value) != len(records[i].Value) {
+				t.Fatalf("policy [%v], expected [%v], got = [%v]", policy, records[i], r)
+			}
+
+			for field, value := range records[i].Value {
+				if r.Value[field] != value {
+					t.Fatalf("policy [%v], expected [%v], got = [%v]", policy, records[i], r)
+				}
+			}
+		}
+	}
+}
+
+func TestLog_TornTail(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	log, err := Open(path, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Append(Record{Op: OpInsert, Key: "A", Value: store.Value{"val": "A"}}); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash in the middle of the second append
+	partial := encodeRecord(Record{Op: OpInsert, Key: "B", Value: store.Value{"val": "B"}})
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(partial[:len(partial)-2])
+	file.Close()
+
+	log, err = Open(path, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	if after, _ := os.Stat(path); after.Size() != stat.Size() {
+		t.Fatalf("expected torn record to be truncated to [%v] bytes, got = [%v]", stat.Size(), after.Size())
+	}
+
+	count := 0
+	log.Replay(func(r Record) error {
+		count++
+		return nil
+	})
+
+	if count != 1 {
+		t.Fatalf("expected [1] record, got = [%v]", count)
+	}
+}
+
+// a damaged record followed by others is not a torn tail, nothing is truncated
+func TestLog_Corrupted(t *testing.T) {
+	first := len(encodeRecord(Record{Op: OpInsert, Key: "A", Value: store.Value{"val": "A"}}))
+
+	tests := []struct {
+		name   string
+		offset int
+		mask   byte
+	}{
+		{"body", 2*first - 1, 0xff},
+		// a longer length would otherwise point past the end of the file, like a torn record
+		{"length", first + 4, 0x40},
+		{"length checksum", first, 0x01},
+	}
+
+	for _, test := range tests {
+		path, cleanup := tempLogPath(t)
+
+		log, err := Open(path, DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, key := range []string{"A", "B", "C"} {
+			if err := log.Append(Record{Op: OpInsert, Key: key, Value: store.Value{"val": key}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		log.Close()
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// damage the second record
+		data[test.offset] ^= test.mask
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Open(path, DefaultOptions()); !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("%v: expected error = [ErrCorrupted], got = [%v]", test.name, err)
+		}
+
+		if after, _ := os.Stat(path); after.Size() != int64(len(data)) {
+			t.Fatalf("%v: expected [%v] bytes left, got = [%v]", test.name, len(data), after.Size())
+		}
+
+		cleanup()
+	}
+
+	// counts bigger than the body could hold are not allocated
+	for _, body := range [][]byte{
+		{byte(OpBatch), 0xff, 0xff, 0xff, 0xff, 0x0f},
+		{byte(OpInsert), 1, 'A', 0xff, 0xff, 0xff, 0xff, 0x0f},
+	} {
+		if _, err := parseRecord(body); err != ErrCorrupted {
+			t.Fatalf("body %v: expected error = [ErrCorrupted], got = [%v]", body, err)
+		}
+	}
+}
+
+func TestStore_Restart(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	s, err := OpenStore(path, btree.NewBtree(3), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Insert("A", store.Value{"val": "A"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Insert("B", store.Value{"val": "B"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Update("A", store.Value{"val": "new A"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Remove("B"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Update("C", store.Value{"val": "C"}); err != store.KeyDoesNotExist {
+		t.Fatalf("expected error = [KeyDoesNotExist], got = [%v]", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replay into a fresh btree
+	s, err = OpenStore(path, btree.NewBtree(3), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if v := s.Search("A"); v["val"] != "new A" {
+		t.Fatalf("expected [new A], got = [%v]", v)
+	}
+
+	if v := s.Search("B"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	if v := s.Search("C"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+}
+
+func TestStore_Batch(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	s, err := OpenStore(path, btree.NewBtree(3), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := store.NewBatch()
+	b.Insert("A", store.Value{"val": "A"})
+	b.Insert("B", store.Value{"val": "B"})
+	b.Remove("A")
+	if err := store.ApplyBatch(s, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// a batch that cannot be applied is not logged
+	b = store.NewBatch()
+	b.Insert("C", store.Value{"val": "C"})
+	b.Update("A", store.Value{"val": "A"})
+	if err := store.ApplyBatch(s, b); !errors.Is(err, store.KeyDoesNotExist) {
+		t.Fatalf("expected error = [KeyDoesNotExist], got = [%v]", err)
+	}
+	s.Close()
+
+	s, err = OpenStore(path, btree.NewBtree(3), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if v := s.Search("B"); v["val"] != "B" {
+		t.Fatalf("expected [B], got = [%v]", v)
+	}
+
+	if v := s.Search("A"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	if v := s.Search("C"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+}
+
+func TestStore_Expire(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	s, err := OpenStore(path, btree.NewBtree(3), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.InsertTTL(s, "A", store.Value{"val": "A"}, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.InsertTTL(s, "B", store.Value{"val": "B"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// replayed once A expired, the update and remove that follow must not fail
+	if err := s.Update("A", store.Value{"val": "new A"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.UpdateTTL(s, "A", store.Value{"val": "newer A"}, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	b := store.NewBatch()
+	b.Remove("A")
+	b.InsertExpire("D", store.Value{"val": "D"}, time.Now().Add(time.Hour))
+	if err := store.ApplyBatch(s, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.InsertTTL(s, "C", store.Value{"val": "C"}, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	time.Sleep(30 * time.Millisecond)
+
+	// C expired while the store was closed
+	s, err = OpenStore(path, btree.NewBtree(3), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if v := s.Search("A"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	if v := s.Search("B"); v["val"] != "B" {
+		t.Fatalf("expected [B], got = [%v]", v)
+	}
+
+	if v := s.Search("C"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	// the expiry of a batch insert is replayed
+	if e, _ := store.SearchEntry(s, "D"); e.Expires.IsZero() {
+		t.Fatal("expected D to keep its expiry")
+	}
+
+	if removed := len(s.RemoveExpired(0)); removed != 1 {
+		t.Fatalf("expected [1] removed key, got = [%v]", removed)
+	}
+
+	// a store that cannot expire keys would keep B forever
+	if _, err := OpenStore(path, bplustree.NewBPlusTree(4), DefaultOptions()); err != ErrTTLRecords {
+		t.Fatalf("expected %v, got = %v", ErrTTLRecords, err)
+	}
+}
+
+func TestStore_Version(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	s, err := OpenStore(path, btree.NewBtree(3), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Insert("A", store.Value{"val": "A"})
+	s.Insert("B", store.Value{"val": "B"})
+
+	_, version := s.SearchVersion("A")
+	if err := s.UpdateIf("A", store.Value{"val": "new A"}, version); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UpdateIf("A", store.Value{"val": "stale"}, version); err != store.ErrVersionMismatch {
+		t.Fatalf("expected error = [ErrVersionMismatch], got = [%v]", err)
+	}
+
+	_, version = s.SearchVersion("B")
+	if err := s.RemoveIf("B", version); err != nil {
+		t.Fatal(err)
+	}
+
+	// a conditional update keeps the expiry, after a replay too
+	at := time.Now().Add(time.Hour)
+	s.InsertExpire("D", store.Value{"val": "D"}, at)
+	_, version = s.SearchVersion("D")
+	if err := s.UpdateIf("D", store.Value{"val": "new D"}, version); err != nil {
+		t.Fatal(err)
+	}
+
+	_, version = s.SearchVersion("A")
+	s.Close()
+
+	// versions are handed out again in the same order on replay
+	s, err = OpenStore(path, btree.NewBtree(3), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	value, replayed := s.SearchVersion("A")
+	if value["val"] != "new A" || replayed != version {
+		t.Fatalf("expected [new A] at [%v], got = [%v] at [%v]", version, value, replayed)
+	}
+
+	if v := s.Search("B"); v != nil {
+		t.Fatalf("expected nil, got = [%v]", v)
+	}
+
+	if e, _ := s.SearchEntry("D"); e.Value["val"] != "new D" || !e.Expires.Equal(at) {
+		t.Fatalf("expected [new D] expiring at [%v], got = [%+v]", at, e)
+	}
+}
+
+func TestStore_Compact(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	opts := Options{Sync: SyncNever, CompactSize: 4096}
+	s, err := OpenStore(path, btree.NewBtree(3), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every key is written many times, the log is compacted along the way
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprint(i % 20)
+		if err := s.Insert(key, store.Value{"val": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Remove("0"); err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Now().Add(time.Hour)
+	if err := s.UpdateExpire("1", store.Value{"val": "expires"}, at); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := s.log.Size(); size >= 2*opts.CompactSize {
+		t.Fatalf("expected the log to be compacted, got = [%v] bytes", size)
+	}
+
+	expected := make(map[string]store.Entry)
+	s.ScanEntries(store.ScanOptions{}, func(e store.Entry) bool {
+		expected[e.Key] = e
+		return true
+	})
+
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Insert("new", store.Value{"val": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// keys come back with their expiry and version
+	s, err = OpenStore(path, btree.NewBtree(3), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if len(expected) != 19 {
+		t.Fatalf("expected [19] keys, got = [%v]", len(expected))
+	}
+
+	for key, e := range expected {
+		got, ok := s.SearchEntry(key)
+		if !ok || got.Value["val"] != e.Value["val"] || got.Version != e.Version || !got.Expires.Equal(e.Expires) {
+			t.Fatalf("expected [%+v], got = [%+v]", e, got)
+		}
+	}
+
+	if e := expected["1"]; !e.Expires.Equal(at) {
+		t.Fatalf("expected [1] to expire at [%v], got = [%v]", at, e.Expires)
+	}
+
+	if v := s.Search("new"); v["val"] != "new" {
+		t.Fatalf("expected [new], got = [%v]", v)
+	}
+}